@@ -0,0 +1,19 @@
+// Command networkapi-simulator serves an in-memory NetworkAPI, for local runs
+// of the controller without a NetworkAPI instance.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+)
+
+func main() {
+	addr := flag.String("addr", ":8081", "Address the simulator listens on")
+	flag.Parse()
+
+	log.Printf("NetworkAPI simulator listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, networkapi.NewSimulator()))
+}
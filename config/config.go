@@ -3,6 +3,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"reflect"
 	"strings"
@@ -13,22 +14,55 @@ import (
 )
 
 const (
-	IngressControllerName   = "kube-napi-ingress"
-	FinalizerName           = IngressControllerName + ".tsuru.io/cleanup"
-	TakeOverAnnotation      = IngressControllerName + ".tsuru.io/take-over-vip-name"
-	defaultIngressClassName = "globo-networkapi"
-	annotationsConfigPrefix = IngressControllerName + ".tsuru.io/"
+	IngressControllerName    = "kube-napi-ingress"
+	ServiceControllerName    = IngressControllerName + "-service"
+	GatewayControllerName    = IngressControllerName + "-gateway"
+	FinalizerName            = IngressControllerName + ".tsuru.io/cleanup"
+	TakeOverAnnotation       = IngressControllerName + ".tsuru.io/take-over-vip-name"
+	MemberWeightKey          = IngressControllerName + ".tsuru.io/weight"
+	MemberPriorityKey        = IngressControllerName + ".tsuru.io/priority"
+	VIPIDAnnotation          = IngressControllerName + ".tsuru.io/vip-id"
+	PoolIDsAnnotation        = IngressControllerName + ".tsuru.io/pool-ids"
+	VIPCreatedAnnotation     = IngressControllerName + ".tsuru.io/vip-created"
+	PoolCreatedAnnotation    = IngressControllerName + ".tsuru.io/pool-created"
+	LastReconcileAnnotation  = IngressControllerName + ".tsuru.io/last-reconcile-time"
+	LastErrorAnnotation      = IngressControllerName + ".tsuru.io/last-error"
+	defaultIngressClassName  = "globo-networkapi"
+	defaultLoadBalancerClass = IngressControllerName + ".tsuru.io/networkapi"
+	defaultGatewayController = IngressControllerName + ".tsuru.io/gateway-controller"
+	annotationsConfigPrefix  = IngressControllerName + ".tsuru.io/"
 )
 
 type Config struct {
 	NetworkAPIURL            string
 	NetworkAPIUsername       string
 	NetworkAPIPassword       string
+	NetworkAPIAuth           AuthConfig
+	NetworkAPITimeout        time.Duration
+	NetworkAPICAFile         string
+	NetworkAPICertFile       string
+	NetworkAPIKeyFile        string
+	NetworkAPIProxyURL       string
+	NetworkAPIInsecure       bool
+	NetworkAPIRateLimit      float64
+	NetworkAPIRateBurst      int
+	NetworkAPIMaxInFlight    int
+	NetworkAPICacheTTL       time.Duration
+	NetworkAPIRecordFile     string
 	ClusterName              string
 	IngressClassName         string
+	LoadBalancerClass        string
+	EnableGatewayAPI         bool
+	GatewayClassController   string
 	PodNetworkID             int
 	LBNetworkID              int
+	PodNetworkIPv6ID         int
+	LBNetworkIPv6ID          int
 	ReconcileInterval        time.Duration
+	DrainPeriod              time.Duration
+	OrphanSweepInterval      time.Duration
+	OrphanSweepDryRun        bool
+	DryRun                   bool
 	Equipment                EquipmentConfig
 	DefaultVIPEnvironmentID  int
 	DefaultPoolEnvironmentID int
@@ -37,12 +71,25 @@ type Config struct {
 	DefaultTimeoutID         int
 	DefaultPersistenceID     int
 	DefaultVIPL7RuleID       int
+	DefaultVIPL7PathRuleID   int
 	DefaultVIPL4ProtocolID   int
 	DefaultVIPL7ProtocolID   int
 	DebugReconcileOnce       bool
 	DebugDisableCleanup      bool
 }
 
+// AuthConfig selects how the controller authenticates to NetworkAPI, with
+// NetworkAPIUsername and NetworkAPIPassword by default.
+type AuthConfig struct {
+	Type         string
+	Token        string
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	SecretDir    string
+}
+
 type EquipmentConfig struct {
 	Type        int
 	Model       int
@@ -66,6 +113,18 @@ func (cfg Config) validate() error {
 	if cfg.NetworkAPIURL == "" {
 		return errors.New("networkAPIURL cannot be empty")
 	}
+	if (cfg.NetworkAPICertFile == "") != (cfg.NetworkAPIKeyFile == "") {
+		return errors.New("networkAPICertFile and networkAPIKeyFile must be set together")
+	}
+	if cfg.NetworkAPIRateLimit < 0 {
+		return errors.New("networkAPIRateLimit cannot be negative")
+	}
+	if cfg.NetworkAPIRateBurst < 0 {
+		return errors.New("networkAPIRateBurst cannot be negative")
+	}
+	if cfg.NetworkAPIMaxInFlight < 0 {
+		return errors.New("networkAPIMaxInFlight cannot be negative")
+	}
 	if cfg.DefaultVIPEnvironmentID == 0 {
 		return errors.New("defaultVIPEnvironmentID cannot be empty")
 	}
@@ -115,12 +174,30 @@ func setDefaults(cfg *Config) {
 	if cfg.IngressClassName == "" {
 		cfg.IngressClassName = defaultIngressClassName
 	}
+	if cfg.LoadBalancerClass == "" {
+		cfg.LoadBalancerClass = defaultLoadBalancerClass
+	}
+	if cfg.GatewayClassController == "" {
+		cfg.GatewayClassController = defaultGatewayController
+	}
 	if cfg.NetworkAPIUsername == "" {
 		cfg.NetworkAPIUsername = os.Getenv("NETWORK_API_USERNAME")
 	}
 	if cfg.NetworkAPIPassword == "" {
 		cfg.NetworkAPIPassword = os.Getenv("NETWORK_API_PASSWORD")
 	}
+	if cfg.NetworkAPIAuth.Token == "" {
+		cfg.NetworkAPIAuth.Token = os.Getenv("NETWORK_API_TOKEN")
+	}
+	if cfg.NetworkAPIAuth.ClientSecret == "" {
+		cfg.NetworkAPIAuth.ClientSecret = os.Getenv("NETWORK_API_CLIENT_SECRET")
+	}
+	if cfg.NetworkAPITimeout == 0 {
+		cfg.NetworkAPITimeout = 1 * time.Minute
+	}
+	if cfg.NetworkAPIRateLimit > 0 && cfg.NetworkAPIRateBurst == 0 {
+		cfg.NetworkAPIRateBurst = int(math.Ceil(cfg.NetworkAPIRateLimit))
+	}
 }
 
 func Get(configFileName string) (Config, error) {
@@ -139,16 +216,26 @@ func Get(configFileName string) (Config, error) {
 }
 
 type InstanceConfig struct {
-	VIPEnvironmentID  int
-	PoolEnvironmentID int
-	CacheGroupID      int
-	TrafficReturnID   int
-	TimeoutID         int
-	PersistenceID     int
-	VIPL7RuleID       int
-	VIPL4ProtocolID   int
-	VIPL7ProtocolID   int
-	BaseConfig        Config
+	VIPEnvironmentID              int
+	PoolEnvironmentID             int
+	CacheGroupID                  int
+	TrafficReturnID               int
+	TimeoutID                     int
+	PersistenceID                 int
+	VIPL7RuleID                   int
+	VIPL7PathRuleID               int
+	VIPL4ProtocolID               int
+	VIPL7ProtocolID               int
+	VIPPorts                      string
+	IPFamilies                    string
+	LBMethod                      string
+	TrafficSplit                  string
+	HealthCheckType               string
+	HealthCheckRequest            string
+	HealthCheckExpect             string
+	HealthCheckDestination        string
+	HealthCheckFromReadinessProbe bool
+	BaseConfig                    Config
 }
 
 func FromInstance(obj metav1.Object, cfg Config) InstanceConfig {
@@ -160,6 +247,7 @@ func FromInstance(obj metav1.Object, cfg Config) InstanceConfig {
 		TimeoutID:         cfg.DefaultTimeoutID,
 		PersistenceID:     cfg.DefaultPersistenceID,
 		VIPL7RuleID:       cfg.DefaultVIPL7RuleID,
+		VIPL7PathRuleID:   cfg.DefaultVIPL7PathRuleID,
 		VIPL4ProtocolID:   cfg.DefaultVIPL4ProtocolID,
 		VIPL7ProtocolID:   cfg.DefaultVIPL7ProtocolID,
 	}
@@ -177,6 +265,10 @@ func FromInstance(obj metav1.Object, cfg Config) InstanceConfig {
 		if !ok {
 			continue
 		}
+		if field := instElem.Field(i); field.Kind() == reflect.String {
+			field.SetString(annotationValue)
+			continue
+		}
 		fmt.Sscanf(annotationValue, "%v", instElem.Field(i).Addr().Interface())
 	}
 
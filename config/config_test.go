@@ -27,3 +27,13 @@ func TestFromInstance(t *testing.T) {
 		BaseConfig:        baseCfg,
 	}, cfg)
 }
+
+func TestFromInstanceStringValues(t *testing.T) {
+	m := metav1.ObjectMeta{
+		Annotations: map[string]string{
+			"kube-napi-ingress.tsuru.io/VIPPorts": "8080:http, 8443:https",
+		},
+	}
+	cfg := FromInstance(&m, Config{})
+	require.Equal(t, "8080:http, 8443:https", cfg.VIPPorts)
+}
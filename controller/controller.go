@@ -4,11 +4,15 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/tsuru/networkapi-ingress-controller/config"
 	"github.com/tsuru/networkapi-ingress-controller/networkapi"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -21,22 +25,34 @@ import (
 
 var _ reconcile.Reconciler = &reconcileIngress{}
 
-type reconcileIngress struct {
+// baseReconciler holds the dependencies shared by the reconcilers managing
+// NetworkAPI VIPs.
+type baseReconciler struct {
 	client           client.Client
-	serviceWatcher   *serviceWatcher
 	cfg              config.Config
 	events           record.EventRecorder
 	networkAPIClient networkapi.NetworkAPI
+	drain            *drainTracker
+	// targetLock is shared by the reconcilers using the same NetworkAPI
+	// client, see SharedNetworkAPI.
+	targetLock *sync.RWMutex
+}
+
+type reconcileIngress struct {
+	baseReconciler
+	serviceWatcher *serviceWatcher
 }
 
 func NewReconciler(client client.Client, evtRecorder record.EventRecorder, cfg config.Config) *reconcileIngress {
 	return &reconcileIngress{
-		client: client,
-		cfg:    cfg,
-		events: evtRecorder,
-		serviceWatcher: &serviceWatcher{
-			ingressToService: map[types.NamespacedName]types.NamespacedName{},
+		baseReconciler: baseReconciler{
+			client:     client,
+			cfg:        cfg,
+			events:     evtRecorder,
+			drain:      newDrainTracker(cfg.DrainPeriod),
+			targetLock: &sync.RWMutex{},
 		},
+		serviceWatcher: newServiceWatcher(),
 	}
 }
 
@@ -63,58 +79,26 @@ func (r *reconcileIngress) validateIngress(ing *networkingv1.Ingress) error {
 			continue
 		}
 
-		if n := len(r.HTTP.Paths); n != 1 {
-			if n > 1 {
-				return errors.New("Ingress can have only one path")
+		for _, p := range r.HTTP.Paths {
+			if p.Backend.Service == nil {
+				return errors.New("Ingress path must have a Service")
 			}
 
-			continue
-		}
-
-		p := &r.HTTP.Paths[0]
-		if p.Path != "" && p.Path != "/" && p.Path != "/*" {
-			return errors.New("Ingress path must be unset, / or /*")
-		}
-
-		if p.Backend.Service == nil {
-			return errors.New("Ingress path must have a Service")
-		}
+			if p.Backend.Service.Name == "" {
+				return errors.New("Service backend must have a name")
+			}
 
-		if p.Backend.Service.Name == "" {
-			return errors.New("Service backend must have a name")
+			services[p.Backend.Service.Name] = true
 		}
-
-		services[p.Backend.Service.Name] = true
 	}
 
-	if n := len(services); n != 1 {
-		if n == 0 {
-			return errors.New("Ingress must have either default backend or one rule")
-		}
-
-		return errors.New("Ingress cannot have different Services by rule")
+	if len(services) == 0 {
+		return errors.New("Ingress must have either default backend or one rule")
 	}
 
 	return nil
 }
 
-func backendsFromIngress(ing *networkingv1.Ingress) (backends []*networkingv1.IngressServiceBackend) {
-	if len(ing.Spec.Rules) > 0 && ing.Spec.Rules[0].HTTP != nil && len(ing.Spec.Rules[0].HTTP.Paths) > 0 {
-		backends = append(backends, ing.Spec.Rules[0].HTTP.Paths[0].Backend.Service)
-	} else if ing.Spec.DefaultBackend != nil && ing.Spec.DefaultBackend.Service != nil {
-		backends = append(backends, ing.Spec.DefaultBackend.Service)
-	}
-
-	if len(backends) > 0 && len(ing.Spec.TLS) > 0 {
-		backends = append(backends, &networkingv1.IngressServiceBackend{
-			Name: backends[0].Name,
-			Port: networkingv1.ServiceBackendPort{Number: int32(443)},
-		})
-	}
-
-	return
-}
-
 func namespacedName(obj metav1.Object) types.NamespacedName {
 	return types.NamespacedName{
 		Namespace: obj.GetNamespace(),
@@ -123,53 +107,146 @@ func namespacedName(obj metav1.Object) types.NamespacedName {
 }
 
 func (r *reconcileIngress) svcAndPortFromIngress(ctx context.Context, ing *networkingv1.Ingress) (*corev1.Service, []corev1.ServicePort, error) {
-	backends := backendsFromIngress(ing)
-	if len(backends) == 0 {
+	routes := routesFromIngress(ing)
+	if len(routes) == 0 {
 		return nil, nil, errors.Errorf("ingress has no backends")
 	}
 
+	svc, err := r.backendService(ctx, ing.Namespace, routes[0].Backend.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ports, err := defaultBackendPorts(ing, svc, routes[0].Backend)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return svc, ports, nil
+}
+
+func (r *baseReconciler) backendService(ctx context.Context, namespace, name string) (*corev1.Service, error) {
 	svcFullName := types.NamespacedName{
-		Name:      backends[0].Name,
-		Namespace: ing.Namespace,
+		Name:      name,
+		Namespace: namespace,
 	}
 	svc := &corev1.Service{}
 	err := r.client.Get(ctx, svcFullName, svc)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "could not fetch backend service")
+		return nil, errors.Wrap(err, "could not fetch backend service")
 	}
 
 	if svc.Spec.Type == corev1.ServiceTypeExternalName {
-		return nil, nil, errors.Errorf("backend service %s must not be external name type", svcFullName.String())
+		return nil, errors.Errorf("backend service %s must not be external name type", svcFullName.String())
 	}
 
 	if len(svc.Spec.Ports) == 0 {
-		return nil, nil, errors.Errorf("backend service %s has no ports", svcFullName.String())
+		return nil, errors.Errorf("backend service %s has no ports", svcFullName.String())
+	}
+
+	return svc, nil
+}
+
+// defaultBackendPorts returns the Service ports used when no VIP ports are
+// configured: the backend port and, for Ingresses with TLS, the port 443.
+func defaultBackendPorts(ing *networkingv1.Ingress, svc *corev1.Service, backend *networkingv1.IngressServiceBackend) ([]corev1.ServicePort, error) {
+	backendPorts := []networkingv1.ServiceBackendPort{backend.Port}
+	if len(ing.Spec.TLS) > 0 {
+		backendPorts = append(backendPorts, networkingv1.ServiceBackendPort{Number: int32(443)})
 	}
 
 	var ports []corev1.ServicePort
 	for _, p := range svc.Spec.Ports {
-		for _, b := range backends {
-			if (b.Port.Name != "" && b.Port.Name == p.Name) || b.Port.Number == p.Port {
+		for _, bp := range backendPorts {
+			if servicePortMatches(p, bp) {
 				ports = append(ports, p)
+				break
 			}
 		}
 	}
 
 	if len(ports) == 0 {
-		return nil, nil, errors.Errorf("cannot match backend port with service ports")
+		return nil, errors.Errorf("cannot match backend port with service ports")
 	}
 
-	return svc, ports, nil
+	return ports, nil
+}
+
+type vipServicePorts struct {
+	vipPort int
+	ports   []corev1.ServicePort
+}
+
+// vipPortsForBackend maps the VIP ports to the backend Service ports. Without
+// configured VIP ports the Service port 443 is exposed on the VIP port 443 and
+// any other on the VIP port 80.
+func vipPortsForBackend(ing *networkingv1.Ingress, svc *corev1.Service, backend *networkingv1.IngressServiceBackend, listeners []vipListener) ([]vipServicePorts, error) {
+	var result []vipServicePorts
+
+	if len(listeners) == 0 {
+		ports, err := defaultBackendPorts(ing, svc, backend)
+		if err != nil {
+			return nil, err
+		}
+
+		vipIndex := map[int]int{}
+		for _, p := range ports {
+			vipPort := 80
+			if p.Port == int32(443) {
+				vipPort = 443
+			}
+			i, ok := vipIndex[vipPort]
+			if !ok {
+				i = len(result)
+				vipIndex[vipPort] = i
+				result = append(result, vipServicePorts{vipPort: vipPort})
+			}
+			result[i].ports = append(result[i].ports, p)
+		}
+
+		return result, nil
+	}
+
+	for _, l := range listeners {
+		backendPort := backend.Port
+		if l.ServicePort != nil {
+			backendPort = *l.ServicePort
+		}
+
+		port, ok := matchServicePort(svc, backendPort)
+		if !ok {
+			return nil, errors.Errorf("cannot match service port %s for VIP port %d", formatBackendPort(backendPort), l.VIPPort)
+		}
+
+		result = append(result, vipServicePorts{vipPort: l.VIPPort, ports: []corev1.ServicePort{port}})
+	}
+
+	return result, nil
 }
 
 type target struct {
 	IP        net.IP
 	Port      int
 	NetworkID int
-	TLS       bool
+	Draining  bool
+	// DrainLeft is the time left until a draining target is removed.
+	DrainLeft time.Duration
+	Weight    int
+	Priority  int
 }
 
-func (r *reconcileIngress) targetsForService(ctx context.Context, ing *networkingv1.Ingress, svc *corev1.Service, ports []corev1.ServicePort) ([]target, error) {
+// routeTargets are the targets of a route on a VIP port. A nil healthCheck
+// means the health check configured for the instance. Weighted routes split
+// the traffic through the member weights.
+type routeTargets struct {
+	route       ingressRoute
+	vipPort     int
+	targets     []target
+	healthCheck *networkapi.HealthCheck
+	weighted    bool
+}
+
+func (r *baseReconciler) targetsForService(ctx context.Context, svc *corev1.Service, ports []corev1.ServicePort) ([]target, error) {
 	var targets []target
 
 	if svc.Spec.Type == corev1.ServiceTypeLoadBalancer {
@@ -177,22 +254,26 @@ func (r *reconcileIngress) targetsForService(ctx context.Context, ing *networkin
 			return targets, nil
 		}
 
-		ip := svc.Status.LoadBalancer.Ingress[0].IP
-		if ip == "" {
+		ip := net.ParseIP(svc.Status.LoadBalancer.Ingress[0].IP)
+		if len(ip) == 0 {
+			return targets, nil
+		}
+
+		networkID := r.networkID(ip, true)
+		if isIPv6(ip) && networkID == 0 {
 			return targets, nil
 		}
 
 		uniqueTargets := map[string]bool{}
 		for _, p := range ports {
-			key := fmt.Sprintf("%s:%d", ip, p.Port)
+			key := fmt.Sprintf("%s:%d", ip.String(), p.Port)
 			if uniqueTargets[key] {
 				continue
 			}
 			targets = append(targets, target{
-				IP:        net.ParseIP(ip),
+				IP:        ip,
 				Port:      int(p.Port),
-				TLS:       p.Port == int32(443),
-				NetworkID: r.cfg.LBNetworkID,
+				NetworkID: networkID,
 			})
 			uniqueTargets[key] = true
 		}
@@ -200,55 +281,193 @@ func (r *reconcileIngress) targetsForService(ctx context.Context, ing *networkin
 		return targets, nil
 	}
 
-	var endpoints corev1.Endpoints
-	err := r.client.Get(ctx, namespacedName(svc), &endpoints)
-	if err != nil {
-		return nil, errors.Wrap(err, "could not fetch endpoints")
+	return r.endpointTargets(ctx, svc, ports)
+}
+
+func endpointReady(ep discoveryv1.Endpoint) bool {
+	return ep.Conditions.Ready == nil || *ep.Conditions.Ready
+}
+
+func endpointServing(ep discoveryv1.Endpoint) bool {
+	if ep.Conditions.Serving != nil {
+		return *ep.Conditions.Serving
 	}
+	return endpointReady(ep)
+}
 
-	for _, p := range ports {
-		var svcPortNumber int32
-		if p.TargetPort.IntVal == 0 && p.TargetPort.StrVal == "" {
-			svcPortNumber = p.Port
+func endpointTerminating(ep discoveryv1.Endpoint) bool {
+	return ep.Conditions.Terminating != nil && *ep.Conditions.Terminating
+}
+
+// slicePortNumber returns the endpoint port number for the Service port, the
+// EndpointSlice ports have the same names as the Service ports.
+func slicePortNumber(slice discoveryv1.EndpointSlice, p corev1.ServicePort) int {
+	for _, sp := range slice.Ports {
+		var name string
+		if sp.Name != nil {
+			name = *sp.Name
 		}
+		if name == p.Name && sp.Port != nil {
+			return int(*sp.Port)
+		}
+	}
+	return 0
+}
 
-		for _, s := range endpoints.Subsets {
-			var portNumber int
-			for _, sp := range s.Ports {
-				if p.Name != "" && p.Name == sp.Name {
-					portNumber = int(sp.Port)
-					break
-				}
+// podMemberValue reads a positive member setting from the pod annotations,
+// falling back to its labels.
+func podMemberValue(pod *corev1.Pod, key string) int {
+	value, ok := pod.Annotations[key]
+	if !ok {
+		value = pod.Labels[key]
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0
+	}
+	return n
+}
 
-				if svcPortNumber == sp.Port {
-					portNumber = int(sp.Port)
-					break
-				}
+// targetPod returns the pod behind an endpoint, if any.
+func (r *baseReconciler) targetPod(ctx context.Context, ep discoveryv1.Endpoint, pods map[string]*corev1.Pod) (*corev1.Pod, error) {
+	if ep.TargetRef == nil || ep.TargetRef.Kind != "Pod" {
+		return nil, nil
+	}
+	podName := types.NamespacedName{Namespace: ep.TargetRef.Namespace, Name: ep.TargetRef.Name}
+	if pod, ok := pods[podName.String()]; ok {
+		return pod, nil
+	}
+	pod := &corev1.Pod{}
+	err := r.client.Get(ctx, podName, pod)
+	if k8sErrors.IsNotFound(err) {
+		pod = nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "could not fetch endpoint pod")
+	}
+	pods[podName.String()] = pod
+	return pod, nil
+}
+
+// endpointTargets returns the targets of the Service ports aggregating all the
+// Service EndpointSlices. Only ready endpoints are used, unless the Service
+// publishes not ready addresses. Terminating endpoints still serving are used
+// when a port has no ready endpoint left, otherwise they are kept as draining
+// targets during the drain period. The member weight and priority are read from
+// the endpoint pods. IPv6 endpoints are ignored unless an IPv6 pod network is
+// configured.
+func (r *baseReconciler) endpointTargets(ctx context.Context, svc *corev1.Service, ports []corev1.ServicePort) ([]target, error) {
+	var slices discoveryv1.EndpointSliceList
+	err := r.client.List(ctx, &slices,
+		client.InNamespace(svc.Namespace),
+		client.MatchingLabels{discoveryv1.LabelServiceName: svc.Name},
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list endpoint slices")
+	}
+
+	type terminatingTarget struct {
+		target
+		serving bool
+	}
+
+	pods := map[string]*corev1.Pod{}
+	var targets []target
+	for _, p := range ports {
+		var ready []target
+		var terminating []terminatingTarget
+		seen := map[string]bool{}
+
+		for _, slice := range slices.Items {
+			if slice.AddressType == discoveryv1.AddressTypeFQDN {
+				continue
 			}
 
+			portNumber := slicePortNumber(slice, p)
 			if portNumber == 0 {
 				continue
 			}
 
-			for _, address := range s.Addresses {
-				ip := net.ParseIP(address.IP)
-				if len(ip) == 0 {
-					continue
+			for _, ep := range slice.Endpoints {
+				pod, err := r.targetPod(ctx, ep, pods)
+				if err != nil {
+					return nil, err
 				}
 
-				targets = append(targets, target{
-					IP:        ip,
-					Port:      portNumber,
-					TLS:       p.Port == int32(443),
-					NetworkID: r.cfg.PodNetworkID,
-				})
+				for _, address := range ep.Addresses {
+					ip := net.ParseIP(address)
+					if len(ip) == 0 {
+						continue
+					}
+					networkID := r.networkID(ip, false)
+					if isIPv6(ip) && networkID == 0 {
+						continue
+					}
+
+					key := fmt.Sprintf("%s:%d", ip.String(), portNumber)
+					if seen[key] {
+						continue
+					}
+					seen[key] = true
+
+					tg := target{
+						IP:        ip,
+						Port:      portNumber,
+						NetworkID: networkID,
+					}
+					if pod != nil {
+						tg.Weight = podMemberValue(pod, config.MemberWeightKey)
+						tg.Priority = podMemberValue(pod, config.MemberPriorityKey)
+					}
+					switch {
+					case svc.Spec.PublishNotReadyAddresses || endpointReady(ep):
+						ready = append(ready, tg)
+					case endpointTerminating(ep):
+						terminating = append(terminating, terminatingTarget{target: tg, serving: endpointServing(ep)})
+					}
+				}
+			}
+		}
+
+		useServing := len(ready) == 0
+		for _, tg := range terminating {
+			if useServing && tg.serving {
+				ready = append(ready, tg.target)
+				continue
+			}
+			if left, ok := r.drain.draining(fmt.Sprintf("%s/%s:%d", namespacedName(svc).String(), tg.IP.String(), tg.Port)); ok {
+				tg.Draining = true
+				tg.DrainLeft = left
+				ready = append(ready, tg.target)
 			}
 		}
+		targets = append(targets, ready...)
 	}
 
 	return targets, nil
 }
 
+// requeueAfter returns the reconcile interval, or less when one of the
+// draining targets must be removed before that.
+func (r *baseReconciler) requeueAfter(targets []target) time.Duration {
+	next := r.cfg.ReconcileInterval
+	for _, tg := range targets {
+		if tg.Draining && tg.DrainLeft < next {
+			next = tg.DrainLeft
+		}
+	}
+	return next
+}
+
+// routesRequeueAfter returns the requeue interval for the targets of the
+// routes.
+func (r *baseReconciler) routesRequeueAfter(routes []routeTargets) time.Duration {
+	var targets []target
+	for _, rt := range routes {
+		targets = append(targets, rt.targets...)
+	}
+	return r.requeueAfter(targets)
+}
+
 func (r *reconcileIngress) reconcileIngress(ctx context.Context, ing *networkingv1.Ingress) (reconcile.Result, error) {
 	lg := log.FromContext(ctx)
 	lg.Info("Reconciling Ingress")
@@ -259,35 +478,90 @@ func (r *reconcileIngress) reconcileIngress(ctx context.Context, ing *networking
 		return result, err
 	}
 
-	svc, port, err := r.svcAndPortFromIngress(ctx, ing)
+	ingRoutes := routesFromIngress(ing)
+
+	instCfg := config.FromInstance(ing, r.cfg)
+	split, err := parseTrafficSplit(instCfg.TrafficSplit)
 	if err != nil {
 		return result, err
 	}
-	r.serviceWatcher.addIngressService(namespacedName(ing), namespacedName(svc))
 
-	targets, err := r.targetsForService(ctx, ing, svc, port)
+	var svcNames []types.NamespacedName
+	for _, route := range ingRoutes {
+		svcNames = append(svcNames, types.NamespacedName{Namespace: ing.Namespace, Name: route.Backend.Name})
+	}
+	for _, b := range split {
+		svcNames = append(svcNames, types.NamespacedName{Namespace: ing.Namespace, Name: b.Service})
+	}
+	r.serviceWatcher.setServices(namespacedName(ing), svcNames)
+
+	listeners, err := parseVIPPorts(instCfg.VIPPorts)
 	if err != nil {
 		return result, err
 	}
 
-	err = r.reconcileNetworkAPI(ctx, ing, targets)
+	var routes []routeTargets
+	for _, route := range ingRoutes {
+		svc, err := r.backendService(ctx, ing.Namespace, route.Backend.Name)
+		if err != nil {
+			return result, err
+		}
+
+		vipPorts, err := vipPortsForBackend(ing, svc, route.Backend, listeners)
+		if err != nil {
+			return result, err
+		}
+
+		routeSplit := splitFor(split, route.Backend.Name)
+		for _, vp := range vipPorts {
+			var targets []target
+			if len(routeSplit) > 0 {
+				targets, err = r.splitRouteTargets(ctx, ing, routeSplit, vp.ports)
+			} else {
+				targets, err = r.targetsForService(ctx, svc, vp.ports)
+			}
+			if err != nil {
+				return result, err
+			}
+
+			healthCheck, err := r.backendHealthCheck(ctx, instCfg, svc, vp.ports[0])
+			if err != nil {
+				return result, err
+			}
+
+			routes = append(routes, routeTargets{
+				route:       route,
+				vipPort:     vp.vipPort,
+				targets:     targets,
+				healthCheck: healthCheck,
+				weighted:    len(routeSplit) > 0,
+			})
+		}
+	}
+
+	result.RequeueAfter = r.routesRequeueAfter(routes)
+	err = r.reconcileNetworkAPI(ctx, ing, routes)
 	return result, err
 }
 
 func (r *reconcileIngress) cleanUp(ctx context.Context, ingName types.NamespacedName, ing *networkingv1.Ingress) (reconcile.Result, error) {
 	var result reconcile.Result
 
-	if takeOverVIPName := ing.Annotations[config.TakeOverAnnotation]; takeOverVIPName != "" {
-		// We wont remove the VIP, cause we use take over
-	} else {
-		err := r.cleanupNetworkAPI(ctx, ingName)
-		if err != nil {
-			return result, err
-		}
+	var takeOverVIPName string
+	if ing != nil {
+		takeOverVIPName = ing.Annotations[config.TakeOverAnnotation]
+	}
+	err := r.cleanupNetworkAPI(ctx, ingName, takeOverVIPName)
+	if err != nil {
+		return result, err
 	}
 
 	if ing == nil {
-		r.serviceWatcher.removeIngress(ingName)
+		r.serviceWatcher.remove(ingName)
+		return result, nil
+	}
+	if r.cfg.DryRun {
+		r.reportPlan(ctx, ing)
 		return result, nil
 	}
 
@@ -298,17 +572,23 @@ func (r *reconcileIngress) cleanUp(ctx context.Context, ingName types.Namespaced
 		}
 	}
 	ing.ObjectMeta.Finalizers = newFinalizers
-	err := r.client.Update(ctx, ing)
+	err = r.client.Update(ctx, ing)
 	if err != nil {
 		return result, err
 	}
-	r.serviceWatcher.removeIngress(ingName)
+	r.serviceWatcher.remove(ingName)
 	return result, nil
 }
 
 func (r *reconcileIngress) Reconcile(ctx context.Context, request reconcile.Request) (result reconcile.Result, err error) {
 	lg := log.FromContext(ctx).WithName("reconcile").WithValues("ingress", request.NamespacedName.String())
 	ctx = log.IntoContext(ctx, lg)
+	defer func() {
+		recordReconcileError("ingress", err)
+	}()
+	if r.cfg.DryRun {
+		ctx = withPlan(ctx)
+	}
 
 	if r.cfg.DebugReconcileOnce {
 		defer func() {
@@ -339,7 +619,7 @@ func (r *reconcileIngress) Reconcile(ctx context.Context, request reconcile.Requ
 			break
 		}
 	}
-	if !hasFinalizer {
+	if !hasFinalizer && !r.cfg.DryRun {
 		ing.ObjectMeta.Finalizers = append(ing.ObjectMeta.Finalizers, config.FinalizerName)
 		err = r.client.Update(ctx, ing)
 		if err != nil {
@@ -349,13 +629,17 @@ func (r *reconcileIngress) Reconcile(ctx context.Context, request reconcile.Requ
 
 	r.events.Event(ing, corev1.EventTypeNormal, "NetworkAPIIngressReconciling", "Ingress reconciling")
 	result, err = r.reconcileIngress(ctx, ing)
+	r.reportPlan(ctx, ing)
+	if !r.cfg.DryRun {
+		if statusErr := r.patchAnnotations(ctx, ing, lastErrorAnnotations(err)); statusErr != nil && err == nil {
+			err = statusErr
+		}
+	}
 	if err != nil {
 		r.events.Eventf(ing, corev1.EventTypeWarning, "NetworkAPIIngressReconcileFailed", "Failed to reconcile Ingress: %v", err)
 		return result, err
 	}
 	r.events.Event(ing, corev1.EventTypeNormal, "NetworkAPIIngressReconciled", "Ingress reconciled")
 
-	result.RequeueAfter = r.cfg.ReconcileInterval
-
 	return result, nil
 }
@@ -2,6 +2,9 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,6 +12,7 @@ import (
 	"github.com/tsuru/networkapi-ingress-controller/config"
 	"github.com/tsuru/networkapi-ingress-controller/networkapi"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
@@ -79,7 +83,6 @@ func TestReconcileIngress_validateIngress(t *testing.T) {
 					},
 				},
 			},
-			expectedError: "Ingress cannot have different Services by rule",
 		},
 
 		"with only default backend": {
@@ -108,9 +111,22 @@ func TestReconcileIngress_validateIngress(t *testing.T) {
 							IngressRuleValue: networkingv1.IngressRuleValue{
 								HTTP: &networkingv1.HTTPIngressRuleValue{
 									Paths: []networkingv1.HTTPIngressPath{
-										{Path: "/app1"},
-										{Path: "/app2"},
-										{Path: "/app3"},
+										{
+											Path: "/app1",
+											Backend: networkingv1.IngressBackend{
+												Service: &networkingv1.IngressServiceBackend{
+													Name: "example-service",
+												},
+											},
+										},
+										{
+											Path: "/app2/foo/bar",
+											Backend: networkingv1.IngressBackend{
+												Service: &networkingv1.IngressServiceBackend{
+													Name: "example-service",
+												},
+											},
+										},
 									},
 								},
 							},
@@ -118,10 +134,9 @@ func TestReconcileIngress_validateIngress(t *testing.T) {
 					},
 				},
 			},
-			expectedError: "Ingress can have only one path",
 		},
 
-		"with invalid path": {
+		"with more than one path per rule without backend": {
 			ingress: &networkingv1.Ingress{
 				Spec: networkingv1.IngressSpec{
 					IngressClassName: StringPtr("globo-networkapi"),
@@ -131,7 +146,9 @@ func TestReconcileIngress_validateIngress(t *testing.T) {
 							IngressRuleValue: networkingv1.IngressRuleValue{
 								HTTP: &networkingv1.HTTPIngressRuleValue{
 									Paths: []networkingv1.HTTPIngressPath{
-										{Path: "/app/foo/bar"},
+										{Path: "/app1"},
+										{Path: "/app2"},
+										{Path: "/app3"},
 									},
 								},
 							},
@@ -139,7 +156,7 @@ func TestReconcileIngress_validateIngress(t *testing.T) {
 					},
 				},
 			},
-			expectedError: "Ingress path must be unset, / or /*",
+			expectedError: "Ingress path must have a Service",
 		},
 
 		"path without backend service": {
@@ -231,7 +248,6 @@ func TestReconcileIngress_validateIngress(t *testing.T) {
 					},
 				},
 			},
-			expectedError: "Ingress cannot have different Services by rule",
 		},
 
 		"with more than one HTTP rule backing to the same Service": {
@@ -288,8 +304,10 @@ func TestReconcileIngress_validateIngress(t *testing.T) {
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			r := &reconcileIngress{
-				cfg: config.Config{
-					IngressClassName: "globo-networkapi",
+				baseReconciler: baseReconciler{
+					cfg: config.Config{
+						IngressClassName: "globo-networkapi",
+					},
 				},
 			}
 
@@ -330,11 +348,13 @@ func TestReconcileIngress_svcAndPortFromIngress(t *testing.T) {
 	}
 
 	r := &reconcileIngress{
-		client: fake.NewClientBuilder().
-			WithObjects(svc).
-			Build(),
-		cfg: config.Config{
-			IngressClassName: "globo-networkapi",
+		baseReconciler: baseReconciler{
+			client: fake.NewClientBuilder().
+				WithObjects(svc).
+				Build(),
+			cfg: config.Config{
+				IngressClassName: "globo-networkapi",
+			},
 		},
 	}
 
@@ -378,13 +398,12 @@ func TestReconcileIngress_svcAndPortFromIngress(t *testing.T) {
 		},
 	}, ports)
 
-	targets, err := r.targetsForService(context.TODO(), ing, foundSvc, ports)
+	targets, err := r.targetsForService(context.TODO(), foundSvc, ports)
 	assert.NoError(t, err)
 	assert.Len(t, targets, 1)
 	assert.Equal(t, "10.1.1.1", targets[0].IP.String())
 	assert.Equal(t, 443, targets[0].Port)
 	assert.Equal(t, 0, targets[0].NetworkID)
-	assert.True(t, targets[0].TLS)
 
 }
 
@@ -643,6 +662,382 @@ func TestReconcileTakeOverOverHTTPS(t *testing.T) {
 
 }
 
+func TestReconcileIngressLifecycle(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1",
+			Namespace: "default",
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: StringPtr("globo-networkapi"),
+			DefaultBackend: &networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: "app",
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				},
+			},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	slice := endpointSlice("app", "app-1", "http", 8080, "192.168.0.1", "192.168.0.2")
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress, svc, slice).Build()
+
+	r := NewReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:      "my-cluster",
+			IngressClassName: "globo-networkapi",
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+	req := reconcile.Request{NamespacedName: namespacedName(ingress)}
+
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	vip, err := fakeNetworkAPIClient.GetVIP(ctx, vipName)
+	require.NoError(t, err)
+	assert.True(t, vip.Created)
+	pool, err := fakeNetworkAPIClient.GetPool(ctx, vipName+"_http")
+	require.NoError(t, err)
+	assert.True(t, pool.PoolCreated)
+	require.Len(t, pool.Members, 2)
+	assert.Equal(t, vip.Ports[0].Pools[0].ServerPool.ID, pool.ID)
+	assert.Len(t, fakeNetworkAPIClient.Equipments, 2)
+	assert.Len(t, fakeNetworkAPIClient.IPsByID, 3)
+
+	var updatedIngress networkingv1.Ingress
+	err = client.Get(ctx, req.NamespacedName, &updatedIngress)
+	require.NoError(t, err)
+	require.Len(t, updatedIngress.Status.LoadBalancer.Ingress, 1)
+	vipIP, err := fakeNetworkAPIClient.GetIPByID(ctx, vip.IPv4.ID)
+	require.NoError(t, err)
+	assert.Equal(t, vipIP.ToNetIP().String(), updatedIngress.Status.LoadBalancer.Ingress[0].IP)
+
+	fakeNetworkAPIClient.Calls = nil
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, fakeNetworkAPIClient.Calls, "nothing changes on resync")
+
+	slice.Endpoints = slice.Endpoints[:1]
+	err = client.Update(ctx, slice)
+	require.NoError(t, err)
+
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		fmt.Sprintf("UpdatePool %d", pool.ID),
+		fmt.Sprintf("DeleteIP %d", pool.Members[1].IP.ID),
+		fmt.Sprintf("DeleteEquipment %d", fakeNetworkAPIClient.EquipmentDeletes[0]),
+	}, fakeNetworkAPIClient.Calls)
+	assert.Len(t, fakeNetworkAPIClient.Equipments, 1)
+
+	err = client.Delete(ctx, &updatedIngress)
+	require.NoError(t, err)
+
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, fakeNetworkAPIClient.VIPs)
+	assert.Empty(t, fakeNetworkAPIClient.Pools)
+	assert.Empty(t, fakeNetworkAPIClient.IPsByID)
+	assert.Empty(t, fakeNetworkAPIClient.Equipments)
+}
+
+func TestReconcileIngressWithSimulator(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	sim := networkapi.NewSimulator()
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1",
+			Namespace: "default",
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: StringPtr("globo-networkapi"),
+			DefaultBackend: &networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: "app",
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				},
+			},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	slice := endpointSlice("app", "app-1", "http", 8080, "192.168.0.1", "192.168.0.2")
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress, svc, slice).Build()
+
+	cfg := config.Config{
+		ClusterName:      "my-cluster",
+		IngressClassName: "globo-networkapi",
+		NetworkAPIURL:    srv.URL,
+	}
+	r := NewReconciler(client, &record.FakeRecorder{Events: make(chan string, 10000)}, cfg)
+	cli, err := NewNetworkAPI(cfg)
+	require.NoError(t, err)
+	r.SetNetworkAPI(cli)
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+	req := reconcile.Request{NamespacedName: namespacedName(ingress)}
+
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+
+	vip, err := sim.State.GetVIP(ctx, vipName)
+	require.NoError(t, err)
+	assert.True(t, vip.Created)
+	pool, err := sim.State.GetPool(ctx, vipName+"_http")
+	require.NoError(t, err)
+	assert.True(t, pool.PoolCreated)
+	assert.Len(t, pool.Members, 2)
+
+	var updatedIngress networkingv1.Ingress
+	err = client.Get(ctx, req.NamespacedName, &updatedIngress)
+	require.NoError(t, err)
+	require.Len(t, updatedIngress.Status.LoadBalancer.Ingress, 1)
+	assert.Equal(t, "10.0.0.1", updatedIngress.Status.LoadBalancer.Ingress[0].IP)
+
+	sim.State.Calls = nil
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, sim.State.Calls, "nothing changes on resync")
+
+	err = client.Delete(ctx, &updatedIngress)
+	require.NoError(t, err)
+
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, sim.State.VIPs)
+	assert.Empty(t, sim.State.Pools)
+	assert.Empty(t, sim.State.IPsByID)
+	assert.Empty(t, sim.State.Equipments)
+}
+
+func TestReconcileIngressReplay(t *testing.T) {
+	sim := networkapi.NewSimulator()
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+	cassette := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	reconcileIngress := func(cli *SharedNetworkAPI) networkingv1.Ingress {
+		ingress := &networkingv1.Ingress{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "ingress-1",
+				Namespace: "default",
+			},
+			Spec: networkingv1.IngressSpec{
+				IngressClassName: StringPtr("globo-networkapi"),
+				DefaultBackend: &networkingv1.IngressBackend{
+					Service: &networkingv1.IngressServiceBackend{
+						Name: "app",
+						Port: networkingv1.ServiceBackendPort{Number: 80},
+					},
+				},
+			},
+		}
+		svc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+		}
+		slice := endpointSlice("app", "app-1", "http", 8080, "192.168.0.1")
+
+		client := fake.NewClientBuilder().
+			WithScheme(scheme.Scheme).
+			WithObjects(ingress, svc, slice).Build()
+
+		r := NewReconciler(
+			client,
+			&record.FakeRecorder{
+				Events: make(chan string, 10000),
+			},
+			config.Config{
+				ClusterName:      "my-cluster",
+				IngressClassName: "globo-networkapi",
+			},
+		)
+		r.SetNetworkAPI(cli)
+
+		ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+		_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(ingress)})
+		require.NoError(t, err)
+
+		var updatedIngress networkingv1.Ingress
+		err = client.Get(ctx, namespacedName(ingress), &updatedIngress)
+		require.NoError(t, err)
+		return updatedIngress
+	}
+
+	cli, err := NewNetworkAPI(config.Config{NetworkAPIURL: srv.URL, NetworkAPIRecordFile: cassette})
+	require.NoError(t, err)
+	recorded := reconcileIngress(cli)
+	srv.Close()
+
+	replayCli, err := networkapi.Client(networkapi.ClientOptions{
+		BaseURL:   "http://networkapi.invalid",
+		Transport: networkapi.TransportOptions{ReplayFile: cassette},
+	})
+	require.NoError(t, err)
+	replayed := reconcileIngress(NewSharedNetworkAPI(replayCli))
+	assert.Equal(t, recorded.Status, replayed.Status)
+	assert.Equal(t, recorded.Annotations[config.VIPIDAnnotation], replayed.Annotations[config.VIPIDAnnotation])
+	assert.Equal(t, recorded.Annotations[config.PoolIDsAnnotation], replayed.Annotations[config.PoolIDsAnnotation])
+}
+
 func StringPtr(s string) *string {
 	return &s
 }
+
+func endpointSlice(svcName, name, portName string, port int32, ips ...string) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			Labels:    map[string]string{discoveryv1.LabelServiceName: svcName},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports:       []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+	}
+	for _, ip := range ips {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{Addresses: []string{ip}})
+	}
+	return slice
+}
+
+func TestEndpointTargets(t *testing.T) {
+	yes, no := true, false
+
+	tests := map[string]struct {
+		publishNotReady bool
+		conditions      []discoveryv1.EndpointConditions
+		expected        []string
+	}{
+		"only ready endpoints": {
+			conditions: []discoveryv1.EndpointConditions{
+				{Ready: &yes},
+				{Ready: &no},
+				{Ready: &no, Serving: &yes, Terminating: &yes},
+			},
+			expected: []string{"192.168.0.1"},
+		},
+		"terminating serving endpoints without ready endpoints": {
+			conditions: []discoveryv1.EndpointConditions{
+				{Ready: &no},
+				{Ready: &no, Serving: &yes, Terminating: &yes},
+				{Ready: &no, Serving: &no, Terminating: &yes},
+			},
+			expected: []string{"192.168.0.2"},
+		},
+		"publish not ready addresses": {
+			publishNotReady: true,
+			conditions: []discoveryv1.EndpointConditions{
+				{Ready: &yes},
+				{Ready: &no},
+			},
+			expected: []string{"192.168.0.1", "192.168.0.2"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+				Spec: corev1.ServiceSpec{
+					PublishNotReadyAddresses: tt.publishNotReady,
+					Ports:                    []corev1.ServicePort{{Name: "http", Port: 80}},
+				},
+			}
+
+			slice1 := endpointSlice("app", "app-1", "http", 8080)
+			for i, cond := range tt.conditions {
+				slice1.Endpoints = append(slice1.Endpoints, discoveryv1.Endpoint{
+					Addresses:  []string{fmt.Sprintf("192.168.0.%d", i+1)},
+					Conditions: cond,
+				})
+			}
+			// Endpoints may be duplicated across slices while they are moved.
+			slice2 := endpointSlice("app", "app-2", "http", 8080, "192.168.0.1")
+			slice2.Endpoints[0].Conditions = tt.conditions[0]
+			otherSlice := endpointSlice("other", "other-1", "http", 8080, "192.168.0.9")
+
+			client := fake.NewClientBuilder().
+				WithScheme(scheme.Scheme).
+				WithObjects(svc, slice1, slice2, otherSlice).Build()
+
+			r := NewReconciler(client, &record.FakeRecorder{}, config.Config{PodNetworkID: 10})
+
+			targets, err := r.endpointTargets(context.TODO(), svc, svc.Spec.Ports)
+			require.NoError(t, err)
+
+			var ips []string
+			for _, tg := range targets {
+				assert.Equal(t, 8080, tg.Port)
+				assert.Equal(t, 10, tg.NetworkID)
+				ips = append(ips, tg.IP.String())
+			}
+			assert.Equal(t, tt.expected, ips)
+		})
+	}
+}
+
+func TestEndpointTargetsPodWeights(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+	slice := endpointSlice("app", "app-1", "http", 8080, "192.168.0.1", "192.168.0.2", "192.168.0.3")
+	for i, podName := range []string{"pod-1", "pod-2", "pod-3"} {
+		slice.Endpoints[i].TargetRef = &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: podName}
+	}
+
+	pod1 := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "pod-1",
+		Namespace:   "default",
+		Annotations: map[string]string{config.MemberWeightKey: "3", config.MemberPriorityKey: "2"},
+		Labels:      map[string]string{config.MemberWeightKey: "5"},
+	}}
+	pod2 := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "pod-2",
+		Namespace: "default",
+		Labels:    map[string]string{config.MemberWeightKey: "5", config.MemberPriorityKey: "invalid"},
+	}}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(svc, slice, pod1, pod2).Build()
+
+	r := NewReconciler(client, &record.FakeRecorder{}, config.Config{})
+
+	targets, err := r.endpointTargets(context.TODO(), svc, svc.Spec.Ports)
+	require.NoError(t, err)
+	require.Len(t, targets, 3)
+	assert.Equal(t, [2]int{3, 2}, [2]int{targets[0].Weight, targets[0].Priority})
+	assert.Equal(t, [2]int{5, 0}, [2]int{targets[1].Weight, targets[1].Priority})
+	assert.Equal(t, [2]int{0, 0}, [2]int{targets[2].Weight, targets[2].Priority})
+
+	member := newPoolMember(targets[2], 1)
+	assert.Equal(t, 1, member.Weight)
+	assert.Equal(t, 1, member.Priority)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"sync"
+	"time"
+)
+
+// drainForgetAfter is how long a terminating endpoint no longer seen is kept
+// in the drain tracker.
+const drainForgetAfter = time.Hour
+
+type drainEntry struct {
+	since    time.Time
+	lastSeen time.Time
+}
+
+// drainTracker records when endpoints were first seen terminating, so their
+// pool members are kept with new connections disabled during the drain period
+// before being removed.
+type drainTracker struct {
+	sync.Mutex
+	period  time.Duration
+	now     func() time.Time
+	entries map[string]drainEntry
+}
+
+func newDrainTracker(period time.Duration) *drainTracker {
+	return &drainTracker{
+		period:  period,
+		now:     time.Now,
+		entries: map[string]drainEntry{},
+	}
+}
+
+// draining returns whether the terminating endpoint is still within its drain
+// period, along with the time left until the period ends. A nil tracker or a
+// zero period disables draining.
+func (d *drainTracker) draining(key string) (time.Duration, bool) {
+	if d == nil || d.period <= 0 {
+		return 0, false
+	}
+
+	d.Lock()
+	defer d.Unlock()
+
+	now := d.now()
+	for k, entry := range d.entries {
+		if now.Sub(entry.lastSeen) > drainForgetAfter {
+			delete(d.entries, k)
+		}
+	}
+
+	entry, ok := d.entries[key]
+	if !ok {
+		entry.since = now
+	}
+	entry.lastSeen = now
+	d.entries[key] = entry
+
+	left := d.period - now.Sub(entry.since)
+	return left, left > 0
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDrainTracker(t *testing.T) {
+	now := time.Date(2021, 8, 1, 10, 0, 0, 0, time.UTC)
+	d := newDrainTracker(time.Minute)
+	d.now = func() time.Time { return now }
+
+	left, ok := d.draining("a")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, left)
+
+	now = now.Add(40 * time.Second)
+	left, ok = d.draining("a")
+	assert.True(t, ok)
+	assert.Equal(t, 20*time.Second, left)
+	left, ok = d.draining("b")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, left)
+
+	now = now.Add(20 * time.Second)
+	_, ok = d.draining("a")
+	assert.False(t, ok)
+	_, ok = d.draining("b")
+	assert.True(t, ok)
+
+	now = now.Add(2 * time.Hour)
+	_, ok = d.draining("a")
+	assert.True(t, ok, "forgotten endpoints start a new drain period")
+}
+
+func TestDrainTrackerDisabled(t *testing.T) {
+	var d *drainTracker
+	_, ok := d.draining("a")
+	assert.False(t, ok)
+	_, ok = newDrainTracker(0).draining("a")
+	assert.False(t, ok)
+}
+
+func TestEndpointTargetsDraining(t *testing.T) {
+	yes, no := true, false
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+		},
+	}
+	slice := endpointSlice("app", "app-1", "http", 8080, "192.168.0.1", "192.168.0.2")
+	slice.Endpoints[1].Conditions = discoveryv1.EndpointConditions{Ready: &no, Serving: &yes, Terminating: &yes}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(svc, slice).Build()
+
+	now := time.Date(2021, 8, 1, 10, 0, 0, 0, time.UTC)
+	r := NewServiceReconciler(client, &record.FakeRecorder{}, config.Config{
+		ReconcileInterval: 5 * time.Minute,
+		DrainPeriod:       30 * time.Second,
+	})
+	r.drain.now = func() time.Time { return now }
+
+	targets, err := r.endpointTargets(context.TODO(), svc, svc.Spec.Ports)
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+	assert.False(t, targets[0].Draining)
+	assert.True(t, targets[1].Draining)
+	assert.Equal(t, 0b010, newPoolMember(targets[1], 1).MemberStatus)
+	assert.Equal(t, 30*time.Second, r.requeueAfter(targets))
+
+	otherSvc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}}
+	otherTargets, err := r.endpointTargets(context.TODO(), otherSvc, svc.Spec.Ports)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Minute, r.requeueAfter(otherTargets), "endpoints draining for other Services do not requeue")
+
+	now = now.Add(30 * time.Second)
+	targets, err = r.endpointTargets(context.TODO(), svc, svc.Spec.Ports)
+	require.NoError(t, err)
+	require.Len(t, targets, 1)
+	assert.Equal(t, "192.168.0.1", targets[0].IP.String())
+	assert.Equal(t, 5*time.Minute, r.requeueAfter(targets))
+}
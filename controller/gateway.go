@@ -0,0 +1,972 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+)
+
+const (
+	httpRouteKind = "HTTPRoute"
+	tcpRouteKind  = "TCPRoute"
+)
+
+var _ reconcile.Reconciler = &reconcileGateway{}
+
+// reconcileGateway provisions a VIP for each Gateway whose GatewayClass is
+// handled by this controller. Listeners are exposed as VIP ports and the
+// HTTPRoutes and TCPRoutes attached to them are bound as pools.
+type reconcileGateway struct {
+	baseReconciler
+	serviceWatcher *serviceWatcher
+}
+
+func NewGatewayReconciler(client client.Client, evtRecorder record.EventRecorder, cfg config.Config) *reconcileGateway {
+	return &reconcileGateway{
+		baseReconciler: baseReconciler{
+			client:     client,
+			cfg:        cfg,
+			events:     evtRecorder,
+			drain:      newDrainTracker(cfg.DrainPeriod),
+			targetLock: &sync.RWMutex{},
+		},
+		serviceWatcher: newServiceWatcher(),
+	}
+}
+
+func (r *reconcileGateway) vipName(gw types.NamespacedName) string {
+	return fmt.Sprintf("%s_%s_gw_%s_%s", config.IngressControllerName, r.cfg.ClusterName, gw.Namespace, gw.Name)
+}
+
+func hasGatewayFinalizer(gw *gatewayv1alpha1.Gateway) bool {
+	for _, finalizer := range gw.ObjectMeta.Finalizers {
+		if finalizer == config.FinalizerName {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *reconcileGateway) isManagedGateway(ctx context.Context, gw *gatewayv1alpha1.Gateway) (bool, error) {
+	gwClass := &gatewayv1alpha1.GatewayClass{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: gw.Spec.GatewayClassName}, gwClass)
+	if k8sErrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "could not fetch GatewayClass")
+	}
+	return gwClass.Spec.Controller == r.cfg.GatewayClassController, nil
+}
+
+func validateListener(l gatewayv1alpha1.Listener) error {
+	if l.Routes.Group != nil && *l.Routes.Group != gatewayv1alpha1.GroupName {
+		return errors.Errorf("listener on port %d has unsupported route group %q", l.Port, *l.Routes.Group)
+	}
+
+	switch l.Routes.Kind {
+	case httpRouteKind:
+		if l.Protocol != gatewayv1alpha1.HTTPProtocolType && l.Protocol != gatewayv1alpha1.HTTPSProtocolType {
+			return errors.Errorf("listener on port %d must use HTTP or HTTPS protocol for HTTPRoutes", l.Port)
+		}
+	case tcpRouteKind:
+		if l.Protocol != gatewayv1alpha1.TCPProtocolType && l.Protocol != gatewayv1alpha1.TLSProtocolType {
+			return errors.Errorf("listener on port %d must use TCP or TLS protocol for TCPRoutes", l.Port)
+		}
+	default:
+		return errors.Errorf("listener on port %d has unsupported route kind %q", l.Port, l.Routes.Kind)
+	}
+
+	return nil
+}
+
+// unsupportedListener returns why the listener cannot be provisioned, or an
+// empty string. VIPs do not terminate TLS, so HTTPS listeners and TLS
+// listeners not passing the TLS session through to the backends are not
+// supported.
+func unsupportedListener(l gatewayv1alpha1.Listener) string {
+	switch l.Protocol {
+	case gatewayv1alpha1.HTTPSProtocolType:
+		return fmt.Sprintf("listener on port %d uses HTTPS, TLS termination is not supported", l.Port)
+	case gatewayv1alpha1.TLSProtocolType:
+		if l.TLS == nil || l.TLS.Mode == nil || *l.TLS.Mode != gatewayv1alpha1.TLSModePassthrough {
+			return fmt.Sprintf("listener on port %d terminates TLS, only the Passthrough TLS mode is supported", l.Port)
+		}
+	}
+	return ""
+}
+
+// listenerStatus returns the status of the listener, Ready unless a reason
+// for the listener to be unsupported is given.
+func listenerStatus(l gatewayv1alpha1.Listener, generation int64, unsupported string) gatewayv1alpha1.ListenerStatus {
+	status := gatewayv1alpha1.ListenerStatus{
+		Port:     l.Port,
+		Protocol: l.Protocol,
+		Hostname: l.Hostname,
+	}
+	if unsupported == "" {
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               string(gatewayv1alpha1.ListenerConditionReady),
+			Status:             metav1.ConditionTrue,
+			Reason:             string(gatewayv1alpha1.ListenerConditionReady),
+			ObservedGeneration: generation,
+		})
+		return status
+	}
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               string(gatewayv1alpha1.ListenerConditionDetached),
+		Status:             metav1.ConditionTrue,
+		Reason:             string(gatewayv1alpha1.ListenerReasonUnsupportedProtocol),
+		Message:            unsupported,
+		ObservedGeneration: generation,
+	})
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               string(gatewayv1alpha1.ListenerConditionReady),
+		Status:             metav1.ConditionFalse,
+		Reason:             string(gatewayv1alpha1.ListenerReasonInvalid),
+		Message:            unsupported,
+		ObservedGeneration: generation,
+	})
+	return status
+}
+
+// routeAllowsGateway checks the gateways a route accepts to be bound to, by
+// default only Gateways in the route namespace.
+func routeAllowsGateway(route metav1.Object, gateways *gatewayv1alpha1.RouteGateways, gw *gatewayv1alpha1.Gateway) bool {
+	allow := gatewayv1alpha1.GatewayAllowSameNamespace
+	if gateways != nil && gateways.Allow != nil {
+		allow = *gateways.Allow
+	}
+
+	switch allow {
+	case gatewayv1alpha1.GatewayAllowAll:
+		return true
+	case gatewayv1alpha1.GatewayAllowFromList:
+		for _, ref := range gateways.GatewayRefs {
+			if ref.Name == gw.Name && ref.Namespace == gw.Namespace {
+				return true
+			}
+		}
+		return false
+	}
+	return route.GetNamespace() == gw.Namespace
+}
+
+// listenerSelectsRoute checks the listener route namespaces and labels
+// selectors, along with the gateways allowed by the route.
+func (r *reconcileGateway) listenerSelectsRoute(ctx context.Context, gw *gatewayv1alpha1.Gateway, l gatewayv1alpha1.Listener, route metav1.Object, gateways *gatewayv1alpha1.RouteGateways) (bool, error) {
+	if !routeAllowsGateway(route, gateways, gw) {
+		return false, nil
+	}
+
+	if l.Routes.Selector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(l.Routes.Selector)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid route selector on listener port %d", l.Port)
+		}
+		if !selector.Matches(labels.Set(route.GetLabels())) {
+			return false, nil
+		}
+	}
+
+	from := gatewayv1alpha1.RouteSelectSame
+	if l.Routes.Namespaces != nil && l.Routes.Namespaces.From != nil {
+		from = *l.Routes.Namespaces.From
+	}
+
+	switch from {
+	case gatewayv1alpha1.RouteSelectAll:
+		return true, nil
+	case gatewayv1alpha1.RouteSelectSelector:
+		if l.Routes.Namespaces.Selector == nil {
+			return false, nil
+		}
+		selector, err := metav1.LabelSelectorAsSelector(l.Routes.Namespaces.Selector)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid namespace selector on listener port %d", l.Port)
+		}
+		ns := &corev1.Namespace{}
+		err = r.client.Get(ctx, types.NamespacedName{Name: route.GetNamespace()}, ns)
+		if err != nil {
+			return false, errors.Wrap(err, "could not fetch route namespace")
+		}
+		return selector.Matches(labels.Set(ns.Labels)), nil
+	}
+	return route.GetNamespace() == gw.Namespace, nil
+}
+
+// gatewayRulePoolKey returns a short stable identifier for a route rule to be
+// used in pool names.
+func gatewayRulePoolKey(route metav1.Object, ruleIndex int) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s/%s:%d", route.GetNamespace(), route.GetName(), ruleIndex)
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+func routeObjectLess(o1, o2 metav1.Object) bool {
+	if o1.GetNamespace() != o2.GetNamespace() {
+		return o1.GetNamespace() < o2.GetNamespace()
+	}
+	return o1.GetName() < o2.GetName()
+}
+
+func pathTypeFromMatch(path *gatewayv1alpha1.HTTPPathMatch) (string, networkingv1.PathType, error) {
+	value, pathType := "/", networkingv1.PathTypePrefix
+	if path == nil {
+		return value, pathType, nil
+	}
+	if path.Value != nil {
+		value = *path.Value
+	}
+	if path.Type != nil {
+		switch *path.Type {
+		case gatewayv1alpha1.PathMatchExact:
+			pathType = networkingv1.PathTypeExact
+		case gatewayv1alpha1.PathMatchPrefix:
+			pathType = networkingv1.PathTypePrefix
+		case gatewayv1alpha1.PathMatchImplementationSpecific:
+			pathType = networkingv1.PathTypeImplementationSpecific
+		default:
+			return "", "", errors.Errorf("unsupported path match type %q", *path.Type)
+		}
+	}
+	return value, pathType, nil
+}
+
+// forwardBackend returns the Service and port of a route backend, the port
+// may be omitted for Services with a single port. Backends with weight 0 have
+// no Service.
+func (r *reconcileGateway) forwardBackend(ctx context.Context, namespace string, serviceName *string, port *gatewayv1alpha1.PortNumber, weight *int32) (*corev1.Service, corev1.ServicePort, error) {
+	if serviceName == nil {
+		return nil, corev1.ServicePort{}, errors.New("route forwardTo must have a serviceName")
+	}
+	if weight != nil && *weight == 0 {
+		return nil, corev1.ServicePort{}, nil
+	}
+
+	svc, err := r.backendService(ctx, namespace, *serviceName)
+	if err != nil {
+		return nil, corev1.ServicePort{}, err
+	}
+
+	switch {
+	case port != nil:
+		svcPort, ok := matchServicePort(svc, networkingv1.ServiceBackendPort{Number: int32(*port)})
+		if !ok {
+			return svc, svcPort, errors.Errorf("cannot match service port %d for service %s", *port, namespacedName(svc).String())
+		}
+		return svc, svcPort, nil
+	case len(svc.Spec.Ports) == 1:
+		return svc, svc.Spec.Ports[0], nil
+	}
+	return svc, corev1.ServicePort{}, errors.Errorf("route forwardTo must set a port for service %s with multiple ports", namespacedName(svc).String())
+}
+
+// forwardTargets returns the targets of each route backend along with its
+// weight, 1 when omitted. The health check is derived from the first backend,
+// when enabled.
+func (r *reconcileGateway) forwardTargets(ctx context.Context, namespace string, instCfg config.InstanceConfig, forwardTo []gatewayv1alpha1.RouteForwardTo, svcNames *[]types.NamespacedName) ([]serviceTargets, *networkapi.HealthCheck, error) {
+	var services []serviceTargets
+	var healthCheck *networkapi.HealthCheck
+	for _, fw := range forwardTo {
+		svc, svcPort, err := r.forwardBackend(ctx, namespace, fw.ServiceName, fw.Port, fw.Weight)
+		if svc != nil {
+			*svcNames = append(*svcNames, namespacedName(svc))
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if svc == nil {
+			continue
+		}
+
+		targets, err := r.targetsForService(ctx, svc, []corev1.ServicePort{svcPort})
+		if err != nil {
+			return nil, nil, err
+		}
+		weight := 1
+		if fw.Weight != nil {
+			weight = int(*fw.Weight)
+		}
+		services = append(services, serviceTargets{weight: weight, targets: targets})
+
+		if healthCheck == nil {
+			healthCheck, err = r.backendHealthCheck(ctx, instCfg, svc, svcPort)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return services, healthCheck, nil
+}
+
+// setForwardTargets sets the route targets from its backends. The traffic is
+// split by the backend weights when there is more than one backend.
+func setForwardTargets(rt *routeTargets, services []serviceTargets) {
+	if len(services) == 1 {
+		rt.targets = services[0].targets
+		return
+	}
+	rt.targets = splitTargets(services)
+	rt.weighted = len(services) > 1
+}
+
+func httpForwardTo(forwardTo []gatewayv1alpha1.HTTPRouteForwardTo) []gatewayv1alpha1.RouteForwardTo {
+	var result []gatewayv1alpha1.RouteForwardTo
+	for _, fw := range forwardTo {
+		result = append(result, gatewayv1alpha1.RouteForwardTo{
+			ServiceName: fw.ServiceName,
+			BackendRef:  fw.BackendRef,
+			Port:        fw.Port,
+			Weight:      fw.Weight,
+		})
+	}
+	return result
+}
+
+// httpListenerRoutes returns the routes of the HTTPRoutes attached to the
+// listener. Each route rule has its own pool, with one route for each host and
+// path match. The first hostless catch-all match becomes the default route.
+// Routes without hostnames use the listener hostname, if any.
+func (r *reconcileGateway) httpListenerRoutes(ctx context.Context, gw *gatewayv1alpha1.Gateway, l gatewayv1alpha1.Listener, instCfg config.InstanceConfig, svcNames *[]types.NamespacedName, admissions routeAdmissions) ([]routeTargets, error) {
+	var httpRoutes gatewayv1alpha1.HTTPRouteList
+	err := r.client.List(ctx, &httpRoutes)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list HTTPRoutes")
+	}
+	sort.Slice(httpRoutes.Items, func(i, j int) bool {
+		return routeObjectLess(&httpRoutes.Items[i], &httpRoutes.Items[j])
+	})
+
+	var defaultRoute *routeTargets
+	var routes []routeTargets
+	// claimed holds the route owning each match on the listener, the default
+	// route being claimed with an empty key.
+	claimed := map[string]string{}
+
+	for i := range httpRoutes.Items {
+		httpRoute := &httpRoutes.Items[i]
+		selected, err := r.listenerSelectsRoute(ctx, gw, l, httpRoute, httpRoute.Spec.Gateways)
+		if err != nil {
+			return nil, err
+		}
+		if !selected {
+			admissions.skip(httpRouteKind, httpRoute, &httpRoute.Status.RouteStatus)
+			continue
+		}
+		routeName := namespacedName(httpRoute).String()
+
+		hosts := []string{""}
+		if len(httpRoute.Spec.Hostnames) > 0 {
+			hosts = nil
+			for _, h := range httpRoute.Spec.Hostnames {
+				hosts = append(hosts, string(h))
+			}
+		} else if l.Hostname != nil {
+			hosts = []string{string(*l.Hostname)}
+		}
+
+		var routeDefault *routeTargets
+		var routeRoutes []routeTargets
+		routeClaims := map[string]bool{}
+		var conflict error
+		for ruleIndex, rule := range httpRoute.Spec.Rules {
+			backends, healthCheck, err := r.forwardTargets(ctx, httpRoute.Namespace, instCfg, httpForwardTo(rule.ForwardTo), svcNames)
+			if err != nil {
+				admissions.observe(httpRouteKind, httpRoute, &httpRoute.Status.RouteStatus, err)
+				return nil, err
+			}
+
+			matches := rule.Matches
+			if len(matches) == 0 {
+				matches = []gatewayv1alpha1.HTTPRouteMatch{{}}
+			}
+
+			for _, match := range matches {
+				path, pathType, err := pathTypeFromMatch(match.Path)
+				if err != nil {
+					err = errors.Wrapf(err, "invalid HTTPRoute %s", routeName)
+					admissions.observe(httpRouteKind, httpRoute, &httpRoute.Status.RouteStatus, err)
+					return nil, err
+				}
+
+				for _, host := range hosts {
+					rt := routeTargets{
+						route: ingressRoute{
+							PoolKey:  gatewayRulePoolKey(httpRoute, ruleIndex),
+							Host:     host,
+							Path:     path,
+							PathType: pathType,
+						},
+						vipPort:     int(l.Port),
+						healthCheck: healthCheck,
+					}
+					setForwardTargets(&rt, backends)
+					if host == "" && isCatchAllPath(path) && pathType != networkingv1.PathTypeExact {
+						rt.route.Default = true
+					}
+
+					key := rt.route.l7Value()
+					if owner, ok := claimed[key]; ok {
+						if conflict == nil {
+							conflict = errors.Errorf("match %q is already bound to HTTPRoute %s on listener port %d", host+path, owner, l.Port)
+						}
+						continue
+					}
+					if routeClaims[key] {
+						continue
+					}
+					routeClaims[key] = true
+					if rt.route.Default {
+						routeDefault = &rt
+						continue
+					}
+					routeRoutes = append(routeRoutes, rt)
+				}
+			}
+		}
+
+		// Routes are bound as a whole, a route with matches already bound
+		// to other routes is not bound at all.
+		if conflict != nil {
+			admissions.conflict(httpRouteKind, httpRoute, &httpRoute.Status.RouteStatus, conflict)
+			continue
+		}
+		for key := range routeClaims {
+			claimed[key] = routeName
+		}
+		if routeDefault != nil {
+			defaultRoute = routeDefault
+		}
+		routes = append(routes, routeRoutes...)
+		admissions.observe(httpRouteKind, httpRoute, &httpRoute.Status.RouteStatus, nil)
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		return routeLess(routes[i].route, routes[j].route)
+	})
+
+	if defaultRoute != nil {
+		routes = append([]routeTargets{*defaultRoute}, routes...)
+	}
+
+	return routes, nil
+}
+
+// tcpListenerRoutes returns a single default route with the targets of every
+// TCPRoute attached to the listener, split by the weights of all their
+// backends.
+func (r *reconcileGateway) tcpListenerRoutes(ctx context.Context, gw *gatewayv1alpha1.Gateway, l gatewayv1alpha1.Listener, instCfg config.InstanceConfig, svcNames *[]types.NamespacedName, admissions routeAdmissions) ([]routeTargets, error) {
+	var tcpRoutes gatewayv1alpha1.TCPRouteList
+	err := r.client.List(ctx, &tcpRoutes)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list TCPRoutes")
+	}
+	sort.Slice(tcpRoutes.Items, func(i, j int) bool {
+		return routeObjectLess(&tcpRoutes.Items[i], &tcpRoutes.Items[j])
+	})
+
+	rt := routeTargets{
+		route:   ingressRoute{Default: true},
+		vipPort: int(l.Port),
+	}
+	var services []serviceTargets
+
+	for i := range tcpRoutes.Items {
+		tcpRoute := &tcpRoutes.Items[i]
+		selected, err := r.listenerSelectsRoute(ctx, gw, l, tcpRoute, tcpRoute.Spec.Gateways)
+		if err != nil {
+			return nil, err
+		}
+		if !selected {
+			admissions.skip(tcpRouteKind, tcpRoute, &tcpRoute.Status.RouteStatus)
+			continue
+		}
+
+		for _, rule := range tcpRoute.Spec.Rules {
+			backends, healthCheck, err := r.forwardTargets(ctx, tcpRoute.Namespace, instCfg, rule.ForwardTo, svcNames)
+			if err != nil {
+				admissions.observe(tcpRouteKind, tcpRoute, &tcpRoute.Status.RouteStatus, err)
+				return nil, err
+			}
+			services = append(services, backends...)
+			if rt.healthCheck == nil {
+				rt.healthCheck = healthCheck
+			}
+		}
+		admissions.observe(tcpRouteKind, tcpRoute, &tcpRoute.Status.RouteStatus, nil)
+	}
+
+	setForwardTargets(&rt, services)
+	return []routeTargets{rt}, nil
+}
+
+// Reasons of routes not admitted by the Gateway.
+const (
+	routeReasonInvalid    = "InvalidRoute"
+	routeReasonConflicted = "Conflicted"
+)
+
+// routeAdmission is the result of binding a route to the Gateway listeners,
+// reported in the route Admitted condition. Routes not selected by any
+// listener have their status for the Gateway removed.
+type routeAdmission struct {
+	route    client.Object
+	status   *gatewayv1alpha1.RouteStatus
+	selected bool
+	err      error
+	reason   string
+}
+
+// routeAdmissions holds the admission of each route seen while binding routes
+// to the Gateway, by route kind, namespace and name.
+type routeAdmissions map[string]*routeAdmission
+
+func (a routeAdmissions) admission(kind string, route client.Object, status *gatewayv1alpha1.RouteStatus) *routeAdmission {
+	key := kind + "/" + namespacedName(route).String()
+	adm, ok := a[key]
+	if !ok {
+		adm = &routeAdmission{route: route, status: status}
+		a[key] = adm
+	}
+	return adm
+}
+
+// observe records a route selected by a listener, err is the reason the route
+// could not be bound, if any.
+func (a routeAdmissions) observe(kind string, route client.Object, status *gatewayv1alpha1.RouteStatus, err error) {
+	a.notAdmitted(kind, route, status, routeReasonInvalid, err)
+}
+
+// conflict records a selected route not bound because its matches are
+// already bound to other routes.
+func (a routeAdmissions) conflict(kind string, route client.Object, status *gatewayv1alpha1.RouteStatus, err error) {
+	a.notAdmitted(kind, route, status, routeReasonConflicted, err)
+}
+
+func (a routeAdmissions) notAdmitted(kind string, route client.Object, status *gatewayv1alpha1.RouteStatus, reason string, err error) {
+	adm := a.admission(kind, route, status)
+	adm.selected = true
+	if adm.err == nil && err != nil {
+		adm.err = err
+		adm.reason = reason
+	}
+}
+
+// skip records a route not selected by a listener.
+func (a routeAdmissions) skip(kind string, route client.Object, status *gatewayv1alpha1.RouteStatus) {
+	a.admission(kind, route, status)
+}
+
+// updateRouteStatuses writes the Admitted condition of the selected routes
+// for the Gateway and removes the Gateway from the status of the others.
+// Statuses are left untouched in dry-run mode.
+func (r *reconcileGateway) updateRouteStatuses(ctx context.Context, gwName types.NamespacedName, admissions routeAdmissions) error {
+	if r.cfg.DryRun {
+		return nil
+	}
+
+	keys := make([]string, 0, len(admissions))
+	for key := range admissions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		adm := admissions[key]
+		gateways := []gatewayv1alpha1.RouteGatewayStatus{}
+		var conditions []metav1.Condition
+		for _, gwStatus := range adm.status.Gateways {
+			if gwStatus.GatewayRef.Name == gwName.Name && gwStatus.GatewayRef.Namespace == gwName.Namespace {
+				conditions = gwStatus.Conditions
+				continue
+			}
+			gateways = append(gateways, gwStatus)
+		}
+
+		if adm.selected {
+			condition := metav1.Condition{
+				Type:               string(gatewayv1alpha1.ConditionRouteAdmitted),
+				Status:             metav1.ConditionTrue,
+				Reason:             "Admitted",
+				ObservedGeneration: adm.route.GetGeneration(),
+			}
+			if adm.err != nil {
+				condition.Status = metav1.ConditionFalse
+				condition.Reason = adm.reason
+				condition.Message = adm.err.Error()
+			}
+			controllerName := r.cfg.GatewayClassController
+			conditions = append([]metav1.Condition(nil), conditions...)
+			meta.SetStatusCondition(&conditions, condition)
+			gateways = append(gateways, gatewayv1alpha1.RouteGatewayStatus{
+				GatewayRef: gatewayv1alpha1.RouteStatusGatewayReference{
+					Name:       gwName.Name,
+					Namespace:  gwName.Namespace,
+					Controller: &controllerName,
+				},
+				Conditions: conditions,
+			})
+		}
+
+		if equality.Semantic.DeepEqual(gateways, adm.status.Gateways) {
+			continue
+		}
+		adm.status.Gateways = gateways
+		err := r.client.Status().Update(ctx, adm.route)
+		if err != nil {
+			return errors.Wrapf(err, "could not update status of route %s", namespacedName(adm.route).String())
+		}
+	}
+	return nil
+}
+
+// allRouteAdmissions returns the admissions of every route, none of them
+// selected by a listener yet.
+func (r *reconcileGateway) allRouteAdmissions(ctx context.Context) (routeAdmissions, error) {
+	admissions := routeAdmissions{}
+
+	var httpRoutes gatewayv1alpha1.HTTPRouteList
+	err := r.client.List(ctx, &httpRoutes)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list HTTPRoutes")
+	}
+	for i := range httpRoutes.Items {
+		admissions.skip(httpRouteKind, &httpRoutes.Items[i], &httpRoutes.Items[i].Status.RouteStatus)
+	}
+
+	var tcpRoutes gatewayv1alpha1.TCPRouteList
+	err = r.client.List(ctx, &tcpRoutes)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list TCPRoutes")
+	}
+	for i := range tcpRoutes.Items {
+		admissions.skip(tcpRouteKind, &tcpRoutes.Items[i], &tcpRoutes.Items[i].Status.RouteStatus)
+	}
+	return admissions, nil
+}
+
+// releaseRoutes removes the Gateway from the status of every route.
+func (r *reconcileGateway) releaseRoutes(ctx context.Context, gwName types.NamespacedName) error {
+	admissions, err := r.allRouteAdmissions(ctx)
+	if err != nil {
+		return err
+	}
+	return r.updateRouteStatuses(ctx, gwName, admissions)
+}
+
+func (r *reconcileGateway) reconcileGateway(ctx context.Context, gw *gatewayv1alpha1.Gateway) (reconcile.Result, error) {
+	lg := log.FromContext(ctx)
+	lg.Info("Reconciling Gateway")
+	result := reconcile.Result{}
+
+	if len(gw.Spec.Listeners) == 0 {
+		return result, errors.New("Gateway must have at least one listener")
+	}
+
+	instCfg := config.FromInstance(gw, r.cfg)
+	var svcNames []types.NamespacedName
+	var routes []routeTargets
+	var listeners []gatewayv1alpha1.ListenerStatus
+	// Every route starts as not selected, so routes only selected by
+	// unsupported listeners are not left admitted.
+	admissions, err := r.allRouteAdmissions(ctx)
+	if err != nil {
+		return result, err
+	}
+	supported := false
+	for _, l := range gw.Spec.Listeners {
+		err = validateListener(l)
+		if err != nil {
+			break
+		}
+		unsupported := unsupportedListener(l)
+		listeners = append(listeners, listenerStatus(l, gw.Generation, unsupported))
+		if unsupported != "" {
+			lg.Info("Skipping unsupported listener", "reason", unsupported)
+			continue
+		}
+		supported = true
+
+		var listenerRoutes []routeTargets
+		if l.Routes.Kind == httpRouteKind {
+			listenerRoutes, err = r.httpListenerRoutes(ctx, gw, l, instCfg, &svcNames, admissions)
+		} else {
+			listenerRoutes, err = r.tcpListenerRoutes(ctx, gw, l, instCfg, &svcNames, admissions)
+		}
+		if err != nil {
+			break
+		}
+		routes = append(routes, listenerRoutes...)
+	}
+	r.serviceWatcher.setServices(namespacedName(gw), svcNames)
+	statusErr := r.updateRouteStatuses(ctx, namespacedName(gw), admissions)
+	if err != nil {
+		return result, err
+	}
+	if statusErr != nil {
+		return result, statusErr
+	}
+	if !supported {
+		status := gw.Status.DeepCopy()
+		status.Listeners = listeners
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               string(gatewayv1alpha1.GatewayConditionReady),
+			Status:             metav1.ConditionFalse,
+			Reason:             string(gatewayv1alpha1.GatewayReasonListenersNotValid),
+			ObservedGeneration: gw.Generation,
+		})
+		err = r.updateGatewayStatus(ctx, gw, status)
+		if err != nil {
+			return result, err
+		}
+		return result, errors.New("Gateway has no supported listener")
+	}
+	result.RequeueAfter = r.routesRequeueAfter(routes)
+
+	vipName := r.vipName(namespacedName(gw))
+
+	entries, err := r.routePoolEntries(ctx, vipName, instCfg, routes)
+	if err != nil {
+		return result, err
+	}
+
+	if len(entries) == 0 {
+		return result, errors.New("no pool with targets found to create")
+	}
+
+	vip, ips, err := r.ensureVIP(ctx, vipName, instCfg, entries)
+	if err != nil {
+		return result, err
+	}
+
+	err = r.deployVIP(ctx, vip)
+	if err != nil || r.cfg.DryRun {
+		return result, err
+	}
+
+	ipType := gatewayv1alpha1.IPAddressType
+	status := gw.Status.DeepCopy()
+	status.Addresses = nil
+	for _, address := range ips.addresses() {
+		status.Addresses = append(status.Addresses, gatewayv1alpha1.GatewayAddress{Type: &ipType, Value: address})
+	}
+	status.Listeners = listeners
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               string(gatewayv1alpha1.GatewayConditionReady),
+		Status:             metav1.ConditionTrue,
+		Reason:             string(gatewayv1alpha1.GatewayConditionReady),
+		ObservedGeneration: gw.Generation,
+	})
+	return result, r.updateGatewayStatus(ctx, gw, status)
+}
+
+// updateGatewayStatus writes the Gateway status if it changed, statuses are
+// left untouched in dry-run mode.
+func (r *reconcileGateway) updateGatewayStatus(ctx context.Context, gw *gatewayv1alpha1.Gateway, status *gatewayv1alpha1.GatewayStatus) error {
+	if r.cfg.DryRun || equality.Semantic.DeepEqual(*status, gw.Status) {
+		return nil
+	}
+	gw.Status = *status
+	return r.client.Status().Update(ctx, gw)
+}
+
+func (r *reconcileGateway) cleanUp(ctx context.Context, gwName types.NamespacedName, gw *gatewayv1alpha1.Gateway) (reconcile.Result, error) {
+	var result reconcile.Result
+
+	if r.cfg.DebugDisableCleanup {
+		log.FromContext(ctx).Info("Would cleanup gateway from network api")
+	} else {
+		err := r.cleanupVIP(ctx, r.vipName(gwName))
+		if err != nil {
+			return result, err
+		}
+	}
+
+	err := r.releaseRoutes(ctx, gwName)
+	if err != nil {
+		return result, err
+	}
+
+	if gw == nil || !hasGatewayFinalizer(gw) {
+		r.serviceWatcher.remove(gwName)
+		return result, nil
+	}
+	if r.cfg.DryRun {
+		r.reportPlan(ctx, gw)
+		return result, nil
+	}
+
+	var newFinalizers []string
+	for _, finalizer := range gw.ObjectMeta.Finalizers {
+		if finalizer != config.FinalizerName {
+			newFinalizers = append(newFinalizers, finalizer)
+		}
+	}
+	gw.ObjectMeta.Finalizers = newFinalizers
+	err = r.client.Update(ctx, gw)
+	if err != nil {
+		return result, err
+	}
+	r.serviceWatcher.remove(gwName)
+	return result, nil
+}
+
+func (r *reconcileGateway) Reconcile(ctx context.Context, request reconcile.Request) (result reconcile.Result, err error) {
+	lg := log.FromContext(ctx).WithName("reconcile").WithValues("gateway", request.NamespacedName.String())
+	ctx = log.IntoContext(ctx, lg)
+	defer func() {
+		recordReconcileError("gateway", err)
+	}()
+	if r.cfg.DryRun {
+		ctx = withPlan(ctx)
+	}
+
+	gw := &gatewayv1alpha1.Gateway{}
+	err = r.client.Get(ctx, request.NamespacedName, gw)
+	if k8sErrors.IsNotFound(err) {
+		lg.Error(nil, "Could not find Gateway")
+		return r.cleanUp(ctx, request.NamespacedName, nil)
+	}
+	if err != nil {
+		return result, errors.Wrap(err, "could not fetch Gateway")
+	}
+	if gw.DeletionTimestamp != nil {
+		return r.cleanUp(ctx, request.NamespacedName, gw)
+	}
+
+	managed, err := r.isManagedGateway(ctx, gw)
+	if err != nil {
+		return result, err
+	}
+	if !managed {
+		if hasGatewayFinalizer(gw) {
+			return r.cleanUp(ctx, request.NamespacedName, gw)
+		}
+		return result, nil
+	}
+
+	if !hasGatewayFinalizer(gw) && !r.cfg.DryRun {
+		gw.ObjectMeta.Finalizers = append(gw.ObjectMeta.Finalizers, config.FinalizerName)
+		err = r.client.Update(ctx, gw)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	r.events.Event(gw, corev1.EventTypeNormal, "NetworkAPIGatewayReconciling", "Gateway reconciling")
+	result, err = r.reconcileGateway(ctx, gw)
+	r.reportPlan(ctx, gw)
+	if err != nil {
+		r.events.Eventf(gw, corev1.EventTypeWarning, "NetworkAPIGatewayReconcileFailed", "Failed to reconcile Gateway: %v", err)
+		return result, err
+	}
+	r.events.Event(gw, corev1.EventTypeNormal, "NetworkAPIGatewayReconciled", "Gateway reconciled")
+
+	return result, nil
+}
+
+// gatewaysMapFunc enqueues the Gateways of a GatewayClass, or the Gateways a
+// route allows to be bound to along with the ones it was admitted by, so a
+// route moved away from a Gateway is released from it.
+func (r *reconcileGateway) gatewaysMapFunc(obj client.Object) []reconcile.Request {
+	var gateways gatewayv1alpha1.GatewayList
+	err := r.client.List(context.Background(), &gateways)
+	if err != nil {
+		log.Log.WithName("gateway-watcher").Error(err, "Unable to list Gateways", "kind", fmt.Sprintf("%T", obj), "object", namespacedName(obj).String())
+		return nil
+	}
+
+	var selectedBy func(gw *gatewayv1alpha1.Gateway) bool
+	switch o := obj.(type) {
+	case *gatewayv1alpha1.GatewayClass:
+		selectedBy = func(gw *gatewayv1alpha1.Gateway) bool {
+			return gw.Spec.GatewayClassName == o.Name
+		}
+	case *gatewayv1alpha1.HTTPRoute:
+		selectedBy = routeSelectsGateway(o, o.Spec.Gateways, &o.Status.RouteStatus)
+	case *gatewayv1alpha1.TCPRoute:
+		selectedBy = routeSelectsGateway(o, o.Spec.Gateways, &o.Status.RouteStatus)
+	default:
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for i := range gateways.Items {
+		gw := &gateways.Items[i]
+		if selectedBy(gw) {
+			reqs = append(reqs, reconcile.Request{NamespacedName: namespacedName(gw)})
+		}
+	}
+	return reqs
+}
+
+// routeSelectsGateway matches the Gateways a route may be bound to or has an
+// admission condition from.
+func routeSelectsGateway(route metav1.Object, gateways *gatewayv1alpha1.RouteGateways, status *gatewayv1alpha1.RouteStatus) func(gw *gatewayv1alpha1.Gateway) bool {
+	return func(gw *gatewayv1alpha1.Gateway) bool {
+		if routeAllowsGateway(route, gateways, gw) {
+			return true
+		}
+		for _, gwStatus := range status.Gateways {
+			if gwStatus.GatewayRef.Name == gw.Name && gwStatus.GatewayRef.Namespace == gw.Namespace {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (r *reconcileGateway) Watch(c controller.Controller) error {
+	err := c.Watch(&source.Kind{Type: &gatewayv1alpha1.Gateway{}}, &handler.EnqueueRequestForObject{}, predicate.Funcs{UpdateFunc: metadataChanged})
+	if err != nil {
+		return errors.Wrap(err, "unable to watch Gateway")
+	}
+
+	for _, obj := range []client.Object{&gatewayv1alpha1.GatewayClass{}, &gatewayv1alpha1.HTTPRoute{}, &gatewayv1alpha1.TCPRoute{}} {
+		err = c.Watch(&source.Kind{Type: obj}, handler.EnqueueRequestsFromMapFunc(r.gatewaysMapFunc), predicate.Funcs{UpdateFunc: metadataChanged})
+		if err != nil {
+			return errors.Wrapf(err, "unable to watch %T", obj)
+		}
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Service{}}, handler.EnqueueRequestsFromMapFunc(r.serviceWatcher.mapFunc))
+	if err != nil {
+		return errors.Wrap(err, "unable to watch Service")
+	}
+
+	err = c.Watch(&source.Kind{Type: &discoveryv1.EndpointSlice{}}, handler.EnqueueRequestsFromMapFunc(r.serviceWatcher.endpointSliceMapFunc))
+	if err != nil {
+		return errors.Wrap(err, "unable to watch EndpointSlice")
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(r.serviceWatcher.podMapFunc(r.client)), predicate.Funcs{UpdateFunc: metadataChanged})
+	if err != nil {
+		return errors.Wrap(err, "unable to watch Pod")
+	}
+	return nil
+}
@@ -0,0 +1,555 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+)
+
+func gatewayScheme(t *testing.T) *runtime.Scheme {
+	s := runtime.NewScheme()
+	require.NoError(t, clientgoscheme.AddToScheme(s))
+	require.NoError(t, gatewayv1alpha1.AddToScheme(s))
+	return s
+}
+
+func serviceWithEndpoints(name string, port int32, ips ...string) (*corev1.Service, *discoveryv1.EndpointSlice) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{Name: "main", Port: port}},
+		},
+	}
+	return svc, endpointSlice(name, name+"-1", "main", port, ips...)
+}
+
+func TestReconcileGateway(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_gw_default_gateway-1"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			vipName: {
+				ID:   99,
+				Name: vipName,
+				IPv4: &networkapi.IntOrID{ID: 8000},
+			},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10, Description: vipName},
+		},
+	}
+
+	gwClass := &gatewayv1alpha1.GatewayClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "networkapi"},
+		Spec:       gatewayv1alpha1.GatewayClassSpec{Controller: "kube-napi-ingress.tsuru.io/gateway-controller"},
+	}
+
+	gw := &gatewayv1alpha1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway-1", Namespace: "default"},
+		Spec: gatewayv1alpha1.GatewaySpec{
+			GatewayClassName: "networkapi",
+			Listeners: []gatewayv1alpha1.Listener{
+				{
+					Port:     80,
+					Protocol: gatewayv1alpha1.HTTPProtocolType,
+					Routes:   gatewayv1alpha1.RouteBindingSelector{Kind: "HTTPRoute"},
+				},
+				{
+					Port:     5432,
+					Protocol: gatewayv1alpha1.TCPProtocolType,
+					Routes:   gatewayv1alpha1.RouteBindingSelector{Kind: "TCPRoute"},
+				},
+			},
+		},
+	}
+
+	prefix := gatewayv1alpha1.PathMatchPrefix
+	httpRoute := &gatewayv1alpha1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: gatewayv1alpha1.HTTPRouteSpec{
+			Hostnames: []gatewayv1alpha1.Hostname{"app.example.com"},
+			Rules: []gatewayv1alpha1.HTTPRouteRule{
+				{
+					Matches: []gatewayv1alpha1.HTTPRouteMatch{
+						{Path: &gatewayv1alpha1.HTTPPathMatch{Type: &prefix, Value: StringPtr("/api")}},
+					},
+					ForwardTo: []gatewayv1alpha1.HTTPRouteForwardTo{{ServiceName: StringPtr("api")}},
+				},
+				{
+					ForwardTo: []gatewayv1alpha1.HTTPRouteForwardTo{{ServiceName: StringPtr("web")}},
+				},
+			},
+		},
+	}
+
+	otherNamespaceRoute := &gatewayv1alpha1.HTTPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "other"},
+		Spec: gatewayv1alpha1.HTTPRouteSpec{
+			Rules: []gatewayv1alpha1.HTTPRouteRule{
+				{ForwardTo: []gatewayv1alpha1.HTTPRouteForwardTo{{ServiceName: StringPtr("web")}}},
+			},
+		},
+	}
+
+	tcpRoute := &gatewayv1alpha1.TCPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres", Namespace: "default"},
+		Spec: gatewayv1alpha1.TCPRouteSpec{
+			Rules: []gatewayv1alpha1.TCPRouteRule{
+				{ForwardTo: []gatewayv1alpha1.RouteForwardTo{{ServiceName: StringPtr("postgres")}}},
+			},
+		},
+	}
+
+	apiSvc, apiEndpoints := serviceWithEndpoints("api", 8080, "192.168.0.1")
+	webSvc, webEndpoints := serviceWithEndpoints("web", 8888, "192.168.0.2", "192.168.0.3")
+	pgSvc, pgEndpoints := serviceWithEndpoints("postgres", 5432, "192.168.0.4")
+
+	client := fake.NewClientBuilder().
+		WithScheme(gatewayScheme(t)).
+		WithObjects(gwClass, gw, httpRoute, otherNamespaceRoute, tcpRoute,
+			apiSvc, apiEndpoints, webSvc, webEndpoints, pgSvc, pgEndpoints).Build()
+
+	r := NewGatewayReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:            "my-cluster",
+			GatewayClassController: "kube-napi-ingress.tsuru.io/gateway-controller",
+			DefaultVIPL7RuleID:     1,
+			DefaultVIPL7PathRuleID: 2,
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(gw)})
+	require.NoError(t, err)
+
+	apiPool := vipName + "_" + gatewayRulePoolKey(httpRoute, 0) + "_http"
+	webPool := vipName + "_" + gatewayRulePoolKey(httpRoute, 1) + "_http"
+	require.Len(t, fakeNetworkAPIClient.Pools, 3)
+	assert.Len(t, fakeNetworkAPIClient.Pools[apiPool].Members, 1)
+	assert.Len(t, fakeNetworkAPIClient.Pools[webPool].Members, 2)
+	assert.Equal(t, 8888, fakeNetworkAPIClient.Pools[webPool].Members[0].PortReal)
+	assert.Len(t, fakeNetworkAPIClient.Pools[vipName+"_5432"].Members, 1)
+
+	require.Len(t, fakeNetworkAPIClient.VIPUpdates, 1)
+	vip := fakeNetworkAPIClient.VIPUpdates[0]
+	require.Len(t, vip.Ports, 2)
+	assert.Equal(t, 80, vip.Ports[0].Port)
+	require.Len(t, vip.Ports[0].Pools, 3)
+	assert.Equal(t, "app.example.com/api", vip.Ports[0].Pools[0].L7Value)
+	assert.Equal(t, 2, vip.Ports[0].Pools[0].L7Rule.ID)
+	assert.Equal(t, "app.example.com/api/*", vip.Ports[0].Pools[1].L7Value)
+	assert.Equal(t, vip.Ports[0].Pools[0].ServerPool, vip.Ports[0].Pools[1].ServerPool)
+	assert.Equal(t, "app.example.com/*", vip.Ports[0].Pools[2].L7Value)
+	assert.Equal(t, 5432, vip.Ports[1].Port)
+	require.Len(t, vip.Ports[1].Pools, 1)
+	assert.Equal(t, 1, vip.Ports[1].Pools[0].L7Rule.ID)
+	assert.Equal(t, []int{99}, fakeNetworkAPIClient.VIPDeploys)
+
+	updatedGw := &gatewayv1alpha1.Gateway{}
+	err = client.Get(ctx, namespacedName(gw), updatedGw)
+	require.NoError(t, err)
+	assert.Equal(t, []string{config.FinalizerName}, updatedGw.Finalizers)
+	require.Len(t, updatedGw.Status.Addresses, 1)
+	assert.Equal(t, "100.10.10.10", updatedGw.Status.Addresses[0].Value)
+
+	updatedRoute := &gatewayv1alpha1.HTTPRoute{}
+	err = client.Get(ctx, namespacedName(httpRoute), updatedRoute)
+	require.NoError(t, err)
+	require.Len(t, updatedRoute.Status.Gateways, 1)
+	assert.Equal(t, "gateway-1", updatedRoute.Status.Gateways[0].GatewayRef.Name)
+	assert.True(t, meta.IsStatusConditionTrue(updatedRoute.Status.Gateways[0].Conditions, string(gatewayv1alpha1.ConditionRouteAdmitted)))
+
+	err = client.Get(ctx, namespacedName(otherNamespaceRoute), updatedRoute)
+	require.NoError(t, err)
+	assert.Empty(t, updatedRoute.Status.Gateways)
+}
+
+func TestReconcileGatewayUnsupportedListenersAndConflicts(t *testing.T) {
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{}
+
+	gwClass := &gatewayv1alpha1.GatewayClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "networkapi"},
+		Spec:       gatewayv1alpha1.GatewayClassSpec{Controller: "kube-napi-ingress.tsuru.io/gateway-controller"},
+	}
+	terminate := gatewayv1alpha1.TLSModeTerminate
+	passthrough := gatewayv1alpha1.TLSModePassthrough
+	gw := &gatewayv1alpha1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway-1", Namespace: "default"},
+		Spec: gatewayv1alpha1.GatewaySpec{
+			GatewayClassName: "networkapi",
+			Listeners: []gatewayv1alpha1.Listener{
+				{
+					Port:     80,
+					Protocol: gatewayv1alpha1.HTTPProtocolType,
+					Routes:   gatewayv1alpha1.RouteBindingSelector{Kind: "HTTPRoute"},
+				},
+				{
+					Port:     443,
+					Protocol: gatewayv1alpha1.HTTPSProtocolType,
+					TLS:      &gatewayv1alpha1.GatewayTLSConfig{Mode: &terminate},
+					Routes:   gatewayv1alpha1.RouteBindingSelector{Kind: "HTTPRoute"},
+				},
+				{
+					Port:     8443,
+					Protocol: gatewayv1alpha1.TLSProtocolType,
+					Routes:   gatewayv1alpha1.RouteBindingSelector{Kind: "TCPRoute"},
+				},
+				{
+					Port:     9443,
+					Protocol: gatewayv1alpha1.TLSProtocolType,
+					TLS:      &gatewayv1alpha1.GatewayTLSConfig{Mode: &passthrough},
+					Routes:   gatewayv1alpha1.RouteBindingSelector{Kind: "TCPRoute"},
+				},
+			},
+		},
+	}
+
+	catchAllRoute := func(name string) *gatewayv1alpha1.HTTPRoute {
+		return &gatewayv1alpha1.HTTPRoute{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: gatewayv1alpha1.HTTPRouteSpec{
+				Rules: []gatewayv1alpha1.HTTPRouteRule{
+					{ForwardTo: []gatewayv1alpha1.HTTPRouteForwardTo{{ServiceName: StringPtr("web")}}},
+				},
+			},
+		}
+	}
+	webRoute := catchAllRoute("a-web")
+	conflictingRoute := catchAllRoute("b-web")
+	tlsRoute := &gatewayv1alpha1.TCPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"},
+		Spec: gatewayv1alpha1.TCPRouteSpec{
+			Rules: []gatewayv1alpha1.TCPRouteRule{
+				{ForwardTo: []gatewayv1alpha1.RouteForwardTo{{ServiceName: StringPtr("tls")}}},
+			},
+		},
+	}
+
+	webSvc, webEndpoints := serviceWithEndpoints("web", 8888, "192.168.0.1")
+	tlsSvc, tlsEndpoints := serviceWithEndpoints("tls", 8443, "192.168.0.2")
+
+	client := fake.NewClientBuilder().
+		WithScheme(gatewayScheme(t)).
+		WithObjects(gwClass, gw, webRoute, conflictingRoute, tlsRoute,
+			webSvc, webEndpoints, tlsSvc, tlsEndpoints).Build()
+
+	r := NewGatewayReconciler(client, &record.FakeRecorder{Events: make(chan string, 10000)}, config.Config{
+		ClusterName:            "my-cluster",
+		GatewayClassController: "kube-napi-ingress.tsuru.io/gateway-controller",
+		DefaultVIPL7RuleID:     1,
+		DefaultVIPL7PathRuleID: 2,
+	})
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(gw)})
+	require.NoError(t, err)
+
+	vip := fakeNetworkAPIClient.VIPs["kube-napi-ingress_my-cluster_gw_default_gateway-1"]
+	require.Len(t, vip.Ports, 2)
+	assert.Equal(t, 80, vip.Ports[0].Port)
+	assert.Equal(t, 9443, vip.Ports[1].Port)
+
+	updatedGw := &gatewayv1alpha1.Gateway{}
+	err = client.Get(ctx, namespacedName(gw), updatedGw)
+	require.NoError(t, err)
+	require.Len(t, updatedGw.Status.Listeners, 4)
+	for i, ready := range []bool{true, false, false, true} {
+		listener := updatedGw.Status.Listeners[i]
+		assert.Equal(t, ready, meta.IsStatusConditionTrue(listener.Conditions, string(gatewayv1alpha1.ListenerConditionReady)), "listener %d", listener.Port)
+		if !ready {
+			detached := meta.FindStatusCondition(listener.Conditions, string(gatewayv1alpha1.ListenerConditionDetached))
+			require.NotNil(t, detached)
+			assert.Equal(t, string(gatewayv1alpha1.ListenerReasonUnsupportedProtocol), detached.Reason)
+		}
+	}
+
+	updatedRoute := &gatewayv1alpha1.HTTPRoute{}
+	err = client.Get(ctx, namespacedName(webRoute), updatedRoute)
+	require.NoError(t, err)
+	require.Len(t, updatedRoute.Status.Gateways, 1)
+	assert.True(t, meta.IsStatusConditionTrue(updatedRoute.Status.Gateways[0].Conditions, string(gatewayv1alpha1.ConditionRouteAdmitted)))
+
+	err = client.Get(ctx, namespacedName(conflictingRoute), updatedRoute)
+	require.NoError(t, err)
+	require.Len(t, updatedRoute.Status.Gateways, 1)
+	admitted := meta.FindStatusCondition(updatedRoute.Status.Gateways[0].Conditions, string(gatewayv1alpha1.ConditionRouteAdmitted))
+	require.NotNil(t, admitted)
+	assert.Equal(t, metav1.ConditionFalse, admitted.Status)
+	assert.Equal(t, "Conflicted", admitted.Reason)
+	assert.Contains(t, admitted.Message, "default/a-web")
+}
+
+func TestReconcileGatewayWeightedBackends(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_gw_default_gateway-1"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			vipName: {ID: 99, Name: vipName, IPv4: &networkapi.IntOrID{ID: 8000}},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10, Description: vipName},
+		},
+	}
+
+	gwClass := &gatewayv1alpha1.GatewayClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "networkapi"},
+		Spec:       gatewayv1alpha1.GatewayClassSpec{Controller: "kube-napi-ingress.tsuru.io/gateway-controller"},
+	}
+	gw := &gatewayv1alpha1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway-1", Namespace: "default"},
+		Spec: gatewayv1alpha1.GatewaySpec{
+			GatewayClassName: "networkapi",
+			Listeners: []gatewayv1alpha1.Listener{
+				{
+					Port:     5432,
+					Protocol: gatewayv1alpha1.TCPProtocolType,
+					Routes:   gatewayv1alpha1.RouteBindingSelector{Kind: "TCPRoute"},
+				},
+			},
+		},
+	}
+
+	stable, canary := int32(90), int32(10)
+	tcpRoute := &gatewayv1alpha1.TCPRoute{
+		ObjectMeta: metav1.ObjectMeta{Name: "postgres", Namespace: "default"},
+		Spec: gatewayv1alpha1.TCPRouteSpec{
+			Rules: []gatewayv1alpha1.TCPRouteRule{
+				{ForwardTo: []gatewayv1alpha1.RouteForwardTo{
+					{ServiceName: StringPtr("stable"), Weight: &stable},
+					{ServiceName: StringPtr("canary"), Weight: &canary},
+				}},
+			},
+		},
+	}
+
+	stableSvc, stableEndpoints := serviceWithEndpoints("stable", 5432, "192.168.0.1", "192.168.0.2", "192.168.0.3")
+	canarySvc, canaryEndpoints := serviceWithEndpoints("canary", 5432, "192.168.0.4")
+
+	client := fake.NewClientBuilder().
+		WithScheme(gatewayScheme(t)).
+		WithObjects(gwClass, gw, tcpRoute, stableSvc, stableEndpoints, canarySvc, canaryEndpoints).Build()
+
+	r := NewGatewayReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:            "my-cluster",
+			GatewayClassController: "kube-napi-ingress.tsuru.io/gateway-controller",
+			DefaultVIPL7RuleID:     1,
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(gw)})
+	require.NoError(t, err)
+
+	pool := fakeNetworkAPIClient.Pools[vipName+"_5432"]
+	assert.Equal(t, "weighted", pool.LBMethod)
+	weights := map[string]int{}
+	for _, m := range pool.Members {
+		weights[m.IP.IPFormated] = m.Weight
+	}
+	assert.Equal(t, map[string]int{
+		"192.168.0.1": 3,
+		"192.168.0.2": 3,
+		"192.168.0.3": 3,
+		"192.168.0.4": 1,
+	}, weights)
+}
+
+func TestReconcileGatewayIgnoresOtherClasses(t *testing.T) {
+	gwClass := &gatewayv1alpha1.GatewayClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "other"},
+		Spec:       gatewayv1alpha1.GatewayClassSpec{Controller: "example.com/other-controller"},
+	}
+
+	gw := &gatewayv1alpha1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway-1", Namespace: "default"},
+		Spec: gatewayv1alpha1.GatewaySpec{
+			GatewayClassName: "other",
+			Listeners: []gatewayv1alpha1.Listener{
+				{
+					Port:     80,
+					Protocol: gatewayv1alpha1.HTTPProtocolType,
+					Routes:   gatewayv1alpha1.RouteBindingSelector{Kind: "HTTPRoute"},
+				},
+			},
+		},
+	}
+
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{}
+	client := fake.NewClientBuilder().
+		WithScheme(gatewayScheme(t)).
+		WithObjects(gwClass, gw).Build()
+
+	r := NewGatewayReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:            "my-cluster",
+			GatewayClassController: "kube-napi-ingress.tsuru.io/gateway-controller",
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(gw)})
+	require.NoError(t, err)
+
+	updatedGw := &gatewayv1alpha1.Gateway{}
+	err = client.Get(ctx, namespacedName(gw), updatedGw)
+	require.NoError(t, err)
+	assert.Empty(t, updatedGw.Finalizers)
+	assert.Empty(t, fakeNetworkAPIClient.VIPUpdates)
+}
+
+func TestRouteAllowsGateway(t *testing.T) {
+	gw := &gatewayv1alpha1.Gateway{
+		ObjectMeta: metav1.ObjectMeta{Name: "gateway-1", Namespace: "default"},
+	}
+	all := gatewayv1alpha1.GatewayAllowAll
+	fromList := gatewayv1alpha1.GatewayAllowFromList
+
+	tests := []struct {
+		name      string
+		namespace string
+		gateways  *gatewayv1alpha1.RouteGateways
+		expected  bool
+	}{
+		{name: "same namespace by default", namespace: "default", expected: true},
+		{name: "other namespace by default", namespace: "other", expected: false},
+		{name: "all", namespace: "other", gateways: &gatewayv1alpha1.RouteGateways{Allow: &all}, expected: true},
+		{
+			name:      "from list",
+			namespace: "other",
+			gateways: &gatewayv1alpha1.RouteGateways{
+				Allow:       &fromList,
+				GatewayRefs: []gatewayv1alpha1.GatewayReference{{Name: "gateway-1", Namespace: "default"}},
+			},
+			expected: true,
+		},
+		{
+			name:      "not in list",
+			namespace: "default",
+			gateways: &gatewayv1alpha1.RouteGateways{
+				Allow:       &fromList,
+				GatewayRefs: []gatewayv1alpha1.GatewayReference{{Name: "gateway-2", Namespace: "default"}},
+			},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			route := &gatewayv1alpha1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{Name: "route", Namespace: tt.namespace}}
+			assert.Equal(t, tt.expected, routeAllowsGateway(route, tt.gateways, gw))
+		})
+	}
+}
+
+func TestGatewaysMapFunc(t *testing.T) {
+	gateway := func(name, namespace, class string) *gatewayv1alpha1.Gateway {
+		return &gatewayv1alpha1.Gateway{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       gatewayv1alpha1.GatewaySpec{GatewayClassName: class},
+		}
+	}
+	cli := fake.NewClientBuilder().
+		WithScheme(gatewayScheme(t)).
+		WithObjects(
+			gateway("gateway-1", "default", "napi"),
+			gateway("gateway-2", "default", "other"),
+			gateway("gateway-3", "team", "napi"),
+		).Build()
+
+	r := NewGatewayReconciler(cli, &record.FakeRecorder{Events: make(chan string, 10000)}, config.Config{})
+
+	fromList := gatewayv1alpha1.GatewayAllowFromList
+	tests := []struct {
+		name     string
+		obj      client.Object
+		expected []string
+	}{
+		{
+			name:     "gateway class",
+			obj:      &gatewayv1alpha1.GatewayClass{ObjectMeta: metav1.ObjectMeta{Name: "napi"}},
+			expected: []string{"default/gateway-1", "team/gateway-3"},
+		},
+		{
+			name:     "route in the gateways namespace",
+			obj:      &gatewayv1alpha1.HTTPRoute{ObjectMeta: metav1.ObjectMeta{Name: "route", Namespace: "default"}},
+			expected: []string{"default/gateway-1", "default/gateway-2"},
+		},
+		{
+			name:     "route without gateways in its namespace",
+			obj:      &gatewayv1alpha1.TCPRoute{ObjectMeta: metav1.ObjectMeta{Name: "route", Namespace: "apps"}},
+			expected: nil,
+		},
+		{
+			name: "route from list",
+			obj: &gatewayv1alpha1.HTTPRoute{
+				ObjectMeta: metav1.ObjectMeta{Name: "route", Namespace: "apps"},
+				Spec: gatewayv1alpha1.HTTPRouteSpec{
+					Gateways: &gatewayv1alpha1.RouteGateways{
+						Allow:       &fromList,
+						GatewayRefs: []gatewayv1alpha1.GatewayReference{{Name: "gateway-3", Namespace: "team"}},
+					},
+				},
+			},
+			expected: []string{"team/gateway-3"},
+		},
+		{
+			name: "route admitted by a gateway it no longer allows",
+			obj: &gatewayv1alpha1.TCPRoute{
+				ObjectMeta: metav1.ObjectMeta{Name: "route", Namespace: "apps"},
+				Status: gatewayv1alpha1.TCPRouteStatus{
+					RouteStatus: gatewayv1alpha1.RouteStatus{
+						Gateways: []gatewayv1alpha1.RouteGatewayStatus{
+							{GatewayRef: gatewayv1alpha1.RouteStatusGatewayReference{Name: "gateway-1", Namespace: "default"}},
+						},
+					},
+				},
+			},
+			expected: []string{"default/gateway-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for _, req := range r.gatewaysMapFunc(tt.obj) {
+				names = append(names, req.NamespacedName.String())
+			}
+			assert.ElementsMatch(t, tt.expected, names)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// allocateTargets runs fn, which ensures the target IPs and the pools using
+// them, holding the target lock for reading. fn returns the members removed
+// from the pools, whose target IPs are released afterwards, even if fn fails.
+func (r *baseReconciler) allocateTargets(ctx context.Context, fn func() ([]networkapi.PoolMember, error)) error {
+	lock := r.targetLock
+	lock.RLock()
+	removed, err := fn()
+	lock.RUnlock()
+
+	releaseErr := r.releaseTargetIPs(ctx, removed)
+	if err != nil {
+		return err
+	}
+	return releaseErr
+}
+
+// deletePools removes the pools and releases the target IPs of their
+// members. Pools already removed are skipped.
+func (r *baseReconciler) deletePools(ctx context.Context, poolIDs []int) error {
+	netapiCli := r.getNetworkAPI()
+
+	var members []networkapi.PoolMember
+	for _, poolID := range poolIDs {
+		pool, err := netapiCli.GetPoolByID(ctx, poolID)
+		if networkapi.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		members = append(members, pool.Members...)
+		if r.dryRun(ctx, plannedAction{Operation: "delete", Kind: "pool", Name: pool.Identifier}) {
+			planReleasedMembers(ctx, poolID, pool.Members)
+			continue
+		}
+		err = netapiCli.DeletePool(ctx, poolID)
+		if err != nil && !networkapi.IsNotFound(err) {
+			return err
+		}
+		objectOperations.WithLabelValues("pool", "delete").Inc()
+		poolMembers.DeleteLabelValues(pool.Identifier)
+	}
+	return r.releaseTargetIPs(ctx, members)
+}
+
+// releaseTargetIPs removes the target IPs of the members, and their
+// equipments, once they are no longer members of any pool. Pools from every
+// Ingress, Service and Gateway reference the same target IPs, so the pools
+// using an IP work as its reference count, checked holding the target lock.
+// IPs not created by the controller are never removed.
+func (r *baseReconciler) releaseTargetIPs(ctx context.Context, members []networkapi.PoolMember) error {
+	released := map[string]bool{}
+	for _, m := range members {
+		var err error
+		switch {
+		case m.IP != nil && !released["ipv4:"+m.IP.IPFormated]:
+			released["ipv4:"+m.IP.IPFormated] = true
+			err = r.releaseTargetIPv4(ctx, m.IP.ID)
+		case m.IPv6 != nil && !released["ipv6:"+m.IPv6.IPFormated]:
+			released["ipv6:"+m.IPv6.IPFormated] = true
+			err = r.releaseTargetIPv6(ctx, m.IPv6.ID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *baseReconciler) releaseTargetIPv4(ctx context.Context, ipID int) error {
+	netapiCli := r.getNetworkAPI()
+	lock := r.targetLock
+	lock.Lock()
+	defer lock.Unlock()
+
+	pools, err := netapiCli.GetPoolsByMemberIP(ctx, ipID)
+	if err != nil || heldByPools(ctx, pools, fmt.Sprintf("ipv4/%d", ipID)) {
+		return err
+	}
+
+	ip, err := netapiCli.GetIPByID(ctx, ipID)
+	if networkapi.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	targetName := r.targetName(target{IP: ip.ToNetIP()})
+	if ip.Description != targetName {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Removing target IP no longer used by any pool", "ip", targetName)
+	if !r.dryRun(ctx, plannedAction{Operation: "delete", Kind: "ip", Name: targetName}) {
+		err = netapiCli.DeleteIP(ctx, ip.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return r.releaseTargetEquipment(ctx, targetName)
+}
+
+func (r *baseReconciler) releaseTargetIPv6(ctx context.Context, ipID int) error {
+	netapiCli := r.getNetworkAPI()
+	lock := r.targetLock
+	lock.Lock()
+	defer lock.Unlock()
+
+	pools, err := netapiCli.GetPoolsByMemberIPv6(ctx, ipID)
+	if err != nil || heldByPools(ctx, pools, fmt.Sprintf("ipv6/%d", ipID)) {
+		return err
+	}
+
+	ip, err := netapiCli.GetIPv6ByID(ctx, ipID)
+	if networkapi.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	targetName := r.targetName(target{IP: ip.ToNetIP()})
+	if ip.Description != targetName {
+		return nil
+	}
+
+	log.FromContext(ctx).Info("Removing target IP no longer used by any pool", "ip", targetName)
+	if !r.dryRun(ctx, plannedAction{Operation: "delete", Kind: "ipv6", Name: targetName}) {
+		err = netapiCli.DeleteIPv6(ctx, ip.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return r.releaseTargetEquipment(ctx, targetName)
+}
+
+// releaseTargetEquipment removes the equipment created for a target, each
+// target IP has its own equipment. It must be called holding the target lock.
+func (r *baseReconciler) releaseTargetEquipment(ctx context.Context, targetName string) error {
+	netapiCli := r.getNetworkAPI()
+
+	equip, err := netapiCli.GetEquipment(ctx, targetName)
+	if networkapi.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if r.dryRun(ctx, plannedAction{Operation: "delete", Kind: "equipment", Name: targetName}) {
+		return nil
+	}
+	return netapiCli.DeleteEquipment(ctx, equip.ID)
+}
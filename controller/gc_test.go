@@ -0,0 +1,376 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestCleanupIngressReleasesTargets(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	member := func(ipID int, ip string) networkapi.PoolMember {
+		return networkapi.PoolMember{IP: &networkapi.PoolMemberIP{ID: ipID, IPFormated: ip}, PortReal: 8080}
+	}
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			vipName: {
+				ID:   99,
+				Name: vipName,
+				IPv4: &networkapi.IntOrID{ID: 8000},
+				Ports: []networkapi.VIPPort{
+					{Port: 80, Pools: []networkapi.VIPPool{{ServerPool: networkapi.IntOrID{ID: 1}}}},
+					{Port: 443, Pools: []networkapi.VIPPool{{ServerPool: networkapi.IntOrID{ID: 2}}}},
+				},
+			},
+		},
+		Pools: map[string]networkapi.Pool{
+			vipName + "_http":  {ID: 1, Identifier: vipName + "_http", Members: []networkapi.PoolMember{member(10, "192.168.0.1"), member(11, "192.168.0.2")}},
+			vipName + "_https": {ID: 2, Identifier: vipName + "_https", Members: []networkapi.PoolMember{member(11, "192.168.0.2"), member(12, "192.168.0.3")}},
+			"other_http":       {ID: 3, Identifier: "other_http", Members: []networkapi.PoolMember{member(10, "192.168.0.1")}},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10, Description: vipName},
+			10:   {ID: 10, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 1, Description: "kube-napi-ingress_my-cluster_192.168.0.1"},
+			11:   {ID: 11, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 2, Description: "kube-napi-ingress_my-cluster_192.168.0.2"},
+			12:   {ID: 12, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 3, Description: "registered by someone else"},
+		},
+		Equipments: map[string]networkapi.Equipment{
+			"kube-napi-ingress_my-cluster_192.168.0.1": {ID: 20, Name: "kube-napi-ingress_my-cluster_192.168.0.1"},
+			"kube-napi-ingress_my-cluster_192.168.0.2": {ID: 21, Name: "kube-napi-ingress_my-cluster_192.168.0.2"},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	r := NewReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:      "my-cluster",
+			IngressClassName: "globo-networkapi",
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "ingress-1"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{99}, fakeNetworkAPIClient.VIPDeletes)
+	assert.Equal(t, []int{1, 2}, fakeNetworkAPIClient.PoolDeletes)
+	assert.Equal(t, []int{8000, 11}, fakeNetworkAPIClient.IPDeletes)
+	assert.Equal(t, []int{21}, fakeNetworkAPIClient.EquipmentDeletes)
+	assert.Contains(t, fakeNetworkAPIClient.IPsByID, 10, "IP still used by another pool")
+	assert.Contains(t, fakeNetworkAPIClient.IPsByID, 12, "IP not created by the controller")
+}
+
+func TestCleanupTakeOverIngress(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	member := func(ipID int, ip string) networkapi.PoolMember {
+		return networkapi.PoolMember{IP: &networkapi.PoolMemberIP{ID: ipID, IPFormated: ip}, PortReal: 8080}
+	}
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			"vip-blah": {
+				ID:   99,
+				Name: "vip-blah",
+				IPv4: &networkapi.IntOrID{ID: 8000},
+				Ports: []networkapi.VIPPort{
+					{Port: 80, Pools: []networkapi.VIPPool{{ServerPool: networkapi.IntOrID{ID: 1}}, {ServerPool: networkapi.IntOrID{ID: 3}}}},
+					{Port: 443, Pools: []networkapi.VIPPool{{ServerPool: networkapi.IntOrID{ID: 2}}}},
+				},
+			},
+		},
+		Pools: map[string]networkapi.Pool{
+			vipName + "_http":  {ID: 1, Identifier: vipName + "_http", Members: []networkapi.PoolMember{member(10, "192.168.0.1")}},
+			vipName + "_https": {ID: 2, Identifier: vipName + "_https", Members: []networkapi.PoolMember{member(10, "192.168.0.1")}},
+			"vip-blah_http":    {ID: 3, Identifier: "vip-blah_http"},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10, Description: "vip-blah"},
+			10:   {ID: 10, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 1, Description: "kube-napi-ingress_my-cluster_192.168.0.1"},
+		},
+		Equipments: map[string]networkapi.Equipment{
+			"kube-napi-ingress_my-cluster_192.168.0.1": {ID: 20, Name: "kube-napi-ingress_my-cluster_192.168.0.1"},
+		},
+	}
+
+	now := metav1.Now()
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "ingress-1",
+			Namespace:         "default",
+			Annotations:       map[string]string{config.TakeOverAnnotation: "vip-blah"},
+			Finalizers:        []string{config.FinalizerName},
+			DeletionTimestamp: &now,
+		},
+	}
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(ingress).Build()
+	r := NewReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:      "my-cluster",
+			IngressClassName: "globo-networkapi",
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(ingress)})
+	require.NoError(t, err)
+
+	require.Len(t, fakeNetworkAPIClient.VIPUpdates, 1)
+	vip := fakeNetworkAPIClient.VIPUpdates[0]
+	require.Len(t, vip.Ports, 1)
+	assert.Equal(t, 80, vip.Ports[0].Port)
+	assert.Equal(t, []networkapi.VIPPool{{ServerPool: networkapi.IntOrID{ID: 3}}}, vip.Ports[0].Pools)
+	assert.Equal(t, []int{99}, fakeNetworkAPIClient.VIPDeploys)
+	assert.Empty(t, fakeNetworkAPIClient.VIPDeletes)
+	assert.Equal(t, []int{1, 2}, fakeNetworkAPIClient.PoolDeletes)
+	assert.Equal(t, []int{10}, fakeNetworkAPIClient.IPDeletes)
+	assert.Equal(t, []int{20}, fakeNetworkAPIClient.EquipmentDeletes)
+}
+
+func TestEnsurePoolReleasesRemovedMembers(t *testing.T) {
+	member := func(ipID int, ip string) networkapi.PoolMember {
+		return networkapi.PoolMember{IP: &networkapi.PoolMemberIP{ID: ipID, IPFormated: ip}, PortReal: 8080, Priority: 1, Weight: 1, MemberStatus: 0b011}
+	}
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		Pools: map[string]networkapi.Pool{
+			"pool-1": {ID: 1, Identifier: "pool-1", Members: []networkapi.PoolMember{member(10, "192.168.0.1"), member(11, "192.168.0.2")}},
+		},
+		IPsByID: map[int]networkapi.IP{
+			10: {ID: 10, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 1, Description: "kube-napi-ingress_my-cluster_192.168.0.1"},
+			11: {ID: 11, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 2, Description: "kube-napi-ingress_my-cluster_192.168.0.2"},
+		},
+		Equipments: map[string]networkapi.Equipment{
+			"kube-napi-ingress_my-cluster_192.168.0.1": {ID: 20, Name: "kube-napi-ingress_my-cluster_192.168.0.1"},
+			"kube-napi-ingress_my-cluster_192.168.0.2": {ID: 21, Name: "kube-napi-ingress_my-cluster_192.168.0.2"},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	r := NewServiceReconciler(client, &record.FakeRecorder{}, config.Config{ClusterName: "my-cluster"})
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	ensurePool := func() error {
+		return r.allocateTargets(ctx, func() ([]networkapi.PoolMember, error) {
+			_, removed, err := r.ensurePool(ctx, &networkapi.Pool{Identifier: "pool-1", Members: []networkapi.PoolMember{member(10, "192.168.0.1")}})
+			return removed, err
+		})
+	}
+
+	err := ensurePool()
+	require.NoError(t, err)
+
+	require.Len(t, fakeNetworkAPIClient.PoolUpdates, 1)
+	assert.Equal(t, []int{11}, fakeNetworkAPIClient.IPDeletes)
+	assert.Equal(t, []int{21}, fakeNetworkAPIClient.EquipmentDeletes)
+
+	err = ensurePool()
+	require.NoError(t, err)
+	assert.Len(t, fakeNetworkAPIClient.PoolUpdates, 1)
+	assert.Equal(t, []int{11}, fakeNetworkAPIClient.IPDeletes)
+}
+
+func TestCleanupIngressAfterFailedVIPCreation(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	sim := networkapi.NewSimulator()
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+	sim.State.Pools = map[string]networkapi.Pool{
+		"kube-napi-ingress_my-cluster_default_ingress-10_http": {ID: 1000, Identifier: "kube-napi-ingress_my-cluster_default_ingress-10_http"},
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1",
+			Namespace: "default",
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: StringPtr("globo-networkapi"),
+			DefaultBackend: &networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: "app",
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				},
+			},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	slice := endpointSlice("app", "app-1", "http", 8080, "192.168.0.1", "192.168.0.2")
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress, svc, slice).Build()
+
+	cfg := config.Config{
+		ClusterName:      "my-cluster",
+		IngressClassName: "globo-networkapi",
+		NetworkAPIURL:    srv.URL,
+	}
+	r := NewReconciler(client, &record.FakeRecorder{Events: make(chan string, 10000)}, cfg)
+	cli, err := NewNetworkAPI(cfg)
+	require.NoError(t, err)
+	r.SetNetworkAPI(cli)
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+	req := reconcile.Request{NamespacedName: namespacedName(ingress)}
+
+	sim.Fail(networkapi.Failure{Method: http.MethodPost, Path: "/api/v3/vip-request/", StatusCode: http.StatusBadRequest})
+	_, err = r.Reconcile(ctx, req)
+	require.Error(t, err)
+	assert.Empty(t, sim.State.VIPs)
+	assert.Contains(t, sim.State.Pools, vipName+"_http")
+	assert.Len(t, sim.State.Equipments, 2)
+
+	var updatedIngress networkingv1.Ingress
+	err = client.Get(ctx, req.NamespacedName, &updatedIngress)
+	require.NoError(t, err)
+	err = client.Delete(ctx, &updatedIngress)
+	require.NoError(t, err)
+
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kube-napi-ingress_my-cluster_default_ingress-10_http"}, poolNames(sim.State.Pools))
+	assert.Empty(t, sim.State.IPsByID)
+	assert.Empty(t, sim.State.Equipments)
+}
+
+func poolNames(pools map[string]networkapi.Pool) []string {
+	var names []string
+	for name := range pools {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestIsVIPPoolName(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_app"
+	assert.True(t, isVIPPoolName(vipName, vipName+"_http"))
+	assert.True(t, isVIPPoolName(vipName, vipName+"_8443"))
+	assert.True(t, isVIPPoolName(vipName, vipName+"_0a1b2c3d_https"))
+	assert.False(t, isVIPPoolName(vipName, vipName+"-2_http"))
+	assert.False(t, isVIPPoolName(vipName, vipName+"_other_http"))
+	assert.False(t, isVIPPoolName(vipName, vipName))
+}
+
+func TestPoolVIPNames(t *testing.T) {
+	r := &baseReconciler{cfg: config.Config{ClusterName: "my-cluster"}}
+	prefix := "kube-napi-ingress_my-cluster_"
+
+	assert.Equal(t, []string{prefix + "default_app"}, r.poolVIPNames(prefix+"default_app_http"))
+	assert.Equal(t, []string{prefix + "svc_web_app"}, r.poolVIPNames(prefix+"svc_web_app_80"))
+	assert.Equal(t, []string{prefix + "svc_web", prefix + "svc_web_deadbeef"}, r.poolVIPNames(prefix+"svc_web_deadbeef_80"))
+	assert.Equal(t, []string{prefix + "svc_web"}, r.poolVIPNames(prefix+"svc_web_deadbeef_http"))
+	assert.Equal(t, []string{prefix + "gw_web_gateway"}, r.poolVIPNames(prefix+"gw_web_gateway_80"))
+	assert.Equal(t, []string{prefix + "gw_web", prefix + "gw_web_0a1b2c3d"}, r.poolVIPNames(prefix+"gw_web_0a1b2c3d_http"))
+	assert.Empty(t, r.poolVIPNames("kube-napi-ingress_other-cluster_default_app_http"))
+}
+
+func TestCleanupIngressKeepsPoolsOfOtherVIPs(t *testing.T) {
+	prefix := "kube-napi-ingress_my-cluster_"
+	servicePool := prefix + "svc_web_deadbeef_80"
+	boundPool := prefix + "svc_web_http"
+	unboundPool := prefix + "svc_web_0a1b2c3d_http"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			prefix + "default_other": {
+				ID:   100,
+				Name: prefix + "default_other",
+				Ports: []networkapi.VIPPort{
+					{Port: 80, Pools: []networkapi.VIPPool{{ServerPool: networkapi.IntOrID{ID: 2}}}},
+				},
+			},
+		},
+		Pools: map[string]networkapi.Pool{
+			servicePool: {ID: 1, Identifier: servicePool},
+			boundPool:   {ID: 2, Identifier: boundPool},
+			unboundPool: {ID: 3, Identifier: unboundPool},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	r := NewReconciler(client, &record.FakeRecorder{Events: make(chan string, 10000)}, config.Config{ClusterName: "my-cluster"})
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: "svc", Name: "web"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []int{3}, fakeNetworkAPIClient.PoolDeletes)
+}
+
+func TestReleaseTargetIPWaitsForAllocation(t *testing.T) {
+	targetName := "kube-napi-ingress_my-cluster_192.168.0.1"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		IPsByID: map[int]networkapi.IP{
+			10: {ID: 10, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 1, Description: targetName},
+		},
+		Equipments: map[string]networkapi.Equipment{
+			targetName: {ID: 20, Name: targetName},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	shared := NewSharedNetworkAPI(fakeNetworkAPIClient)
+	ingresses := NewReconciler(client, &record.FakeRecorder{}, config.Config{ClusterName: "my-cluster"})
+	ingresses.SetNetworkAPI(shared)
+	services := NewServiceReconciler(client, &record.FakeRecorder{}, config.Config{ClusterName: "my-cluster"})
+	services.SetNetworkAPI(shared)
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	released := make(chan error)
+	err := services.allocateTargets(ctx, func() ([]networkapi.PoolMember, error) {
+		ipID, err := services.ensureTargetIP(ctx, target{IP: net.ParseIP("192.168.0.1"), Port: 8080}, config.InstanceConfig{}, map[string]int{})
+		if err != nil {
+			return nil, err
+		}
+
+		go func() {
+			released <- ingresses.releaseTargetIPv4(ctx, ipID)
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		_, removed, err := services.ensurePool(ctx, &networkapi.Pool{
+			Identifier: "pool-1",
+			Members:    []networkapi.PoolMember{newPoolMember(target{IP: net.ParseIP("192.168.0.1"), Port: 8080}, ipID)},
+		})
+		return removed, err
+	})
+	require.NoError(t, err)
+	require.NoError(t, <-released)
+
+	assert.Empty(t, fakeNetworkAPIClient.IPDeletes)
+	assert.Empty(t, fakeNetworkAPIClient.EquipmentDeletes)
+}
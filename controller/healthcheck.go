@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	healthCheckTCP   = "TCP"
+	healthCheckHTTP  = "HTTP"
+	healthCheckHTTPS = "HTTPS"
+)
+
+func validateHealthCheck(cfg config.InstanceConfig) error {
+	switch strings.ToUpper(cfg.HealthCheckType) {
+	case "", healthCheckTCP, healthCheckHTTP, healthCheckHTTPS:
+		return nil
+	}
+	return errors.Errorf("invalid health check type %q, must be TCP, HTTP or HTTPS", cfg.HealthCheckType)
+}
+
+func healthCheckRequest(path, host string) string {
+	if path == "" {
+		path = "/"
+	}
+	if host != "" {
+		return fmt.Sprintf("GET %s HTTP/1.1\\r\\nHost: %s\\r\\nConnection: close\\r\\n\\r\\n", path, host)
+	}
+	return fmt.Sprintf("GET %s HTTP/1.0\\r\\n\\r\\n", path)
+}
+
+// healthCheckFromConfig returns the pool health check configured for the
+// instance, a TCP check on the member port by default. HTTP checks without a
+// request check the path /.
+func healthCheckFromConfig(cfg config.InstanceConfig) networkapi.HealthCheck {
+	hc := networkapi.HealthCheck{
+		Type:        strings.ToUpper(cfg.HealthCheckType),
+		Request:     cfg.HealthCheckRequest,
+		Expect:      cfg.HealthCheckExpect,
+		Destination: cfg.HealthCheckDestination,
+	}
+	if hc.Type == "" {
+		hc.Type = healthCheckTCP
+	}
+	if hc.Type != healthCheckTCP && hc.Request == "" {
+		hc.Request = healthCheckRequest("/", "")
+	}
+	if hc.Destination == "" {
+		hc.Destination = "*:*"
+	}
+	return hc
+}
+
+// containerPortNumber resolves a port number or name to a container port.
+func containerPortNumber(container corev1.Container, port intstr.IntOrString) int32 {
+	if port.Type == intstr.Int {
+		return port.IntVal
+	}
+	for _, p := range container.Ports {
+		if p.Name == port.StrVal {
+			return p.ContainerPort
+		}
+	}
+	return 0
+}
+
+// servesTargetPort checks whether the container receives the Service port
+// traffic.
+func servesTargetPort(container corev1.Container, svcPort corev1.ServicePort) bool {
+	targetPort := svcPort.TargetPort
+	if targetPort.Type == intstr.Int && targetPort.IntVal == 0 {
+		targetPort = intstr.FromInt(int(svcPort.Port))
+	}
+	number := containerPortNumber(container, targetPort)
+	if number == 0 {
+		return false
+	}
+	if targetPort.Type == intstr.String {
+		return true
+	}
+	for _, p := range container.Ports {
+		if p.ContainerPort == number {
+			return true
+		}
+	}
+	return len(container.Ports) == 0
+}
+
+// probeHealthCheck derives an HTTP health check from the readinessProbe of the
+// container serving the Service port in the backend pods. The expected
+// response is still taken from the instance config, as probes accept any 2xx
+// or 3xx response.
+func (r *baseReconciler) probeHealthCheck(ctx context.Context, cfg config.InstanceConfig, svc *corev1.Service, svcPort corev1.ServicePort) (*networkapi.HealthCheck, error) {
+	if len(svc.Spec.Selector) == 0 {
+		return nil, nil
+	}
+
+	var pods corev1.PodList
+	err := r.client.List(ctx, &pods, client.InNamespace(svc.Namespace), client.MatchingLabels(svc.Spec.Selector))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list backend pods")
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+
+	for _, pod := range pods.Items {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, container := range pod.Spec.Containers {
+			probe := container.ReadinessProbe
+			if probe == nil || probe.HTTPGet == nil || !servesTargetPort(container, svcPort) {
+				continue
+			}
+
+			port := containerPortNumber(container, probe.HTTPGet.Port)
+			if port == 0 {
+				continue
+			}
+
+			host := probe.HTTPGet.Host
+			for _, header := range probe.HTTPGet.HTTPHeaders {
+				if strings.EqualFold(header.Name, "Host") {
+					host = header.Value
+				}
+			}
+
+			hcType := healthCheckHTTP
+			if probe.HTTPGet.Scheme == corev1.URISchemeHTTPS {
+				hcType = healthCheckHTTPS
+			}
+
+			return &networkapi.HealthCheck{
+				Type:        hcType,
+				Request:     healthCheckRequest(probe.HTTPGet.Path, host),
+				Expect:      cfg.HealthCheckExpect,
+				Destination: fmt.Sprintf("*:%d", port),
+			}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// backendHealthCheck returns the health check derived from the backend pods,
+// when enabled for the instance, or nil to use the configured health check.
+func (r *baseReconciler) backendHealthCheck(ctx context.Context, cfg config.InstanceConfig, svc *corev1.Service, svcPort corev1.ServicePort) (*networkapi.HealthCheck, error) {
+	if !cfg.HealthCheckFromReadinessProbe {
+		return nil, nil
+	}
+	return r.probeHealthCheck(ctx, cfg, svc, svcPort)
+}
@@ -0,0 +1,183 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestHealthCheckFromConfig(t *testing.T) {
+	tests := map[string]struct {
+		annotations map[string]string
+		expected    networkapi.HealthCheck
+	}{
+		"default": {
+			expected: networkapi.HealthCheck{Type: "TCP", Destination: "*:*"},
+		},
+		"http with defaults": {
+			annotations: map[string]string{
+				"kube-napi-ingress.tsuru.io/HealthCheckType": "http",
+			},
+			expected: networkapi.HealthCheck{
+				Type:        "HTTP",
+				Request:     `GET / HTTP/1.0\r\n\r\n`,
+				Destination: "*:*",
+			},
+		},
+		"https with request, expect and destination": {
+			annotations: map[string]string{
+				"kube-napi-ingress.tsuru.io/HealthCheckType":        "HTTPS",
+				"kube-napi-ingress.tsuru.io/HealthCheckRequest":     `GET /healthz HTTP/1.0\r\n\r\n`,
+				"kube-napi-ingress.tsuru.io/HealthCheckExpect":      "200 OK",
+				"kube-napi-ingress.tsuru.io/HealthCheckDestination": "*:8443",
+			},
+			expected: networkapi.HealthCheck{
+				Type:        "HTTPS",
+				Request:     `GET /healthz HTTP/1.0\r\n\r\n`,
+				Expect:      "200 OK",
+				Destination: "*:8443",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			svc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			cfg := config.FromInstance(svc, config.Config{})
+			require.NoError(t, validateHealthCheck(cfg))
+			assert.Equal(t, tt.expected, healthCheckFromConfig(cfg))
+		})
+	}
+}
+
+func TestValidateHealthCheck(t *testing.T) {
+	err := validateHealthCheck(config.InstanceConfig{HealthCheckType: "UDP"})
+	assert.EqualError(t, err, `invalid health check type "UDP", must be TCP, HTTP or HTTPS`)
+}
+
+func TestProbeHealthCheck(t *testing.T) {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Selector: map[string]string{"app": "app"},
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80, TargetPort: intstr.FromString("http")},
+				{Name: "metrics", Port: 9090},
+			},
+		},
+	}
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-1", Namespace: "default", Labels: map[string]string{"app": "app"}},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:  "sidecar",
+					Ports: []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9090}},
+				},
+				{
+					Name: "app",
+					Ports: []corev1.ContainerPort{
+						{Name: "http", ContainerPort: 8080},
+						{Name: "health", ContainerPort: 8081},
+					},
+					ReadinessProbe: &corev1.Probe{
+						Handler: corev1.Handler{
+							HTTPGet: &corev1.HTTPGetAction{
+								Path:        "/healthz",
+								Port:        intstr.FromString("health"),
+								Scheme:      corev1.URISchemeHTTPS,
+								HTTPHeaders: []corev1.HTTPHeader{{Name: "Host", Value: "app.example.com"}},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(svc, pod).Build()
+
+	r := NewServiceReconciler(client, &record.FakeRecorder{}, config.Config{})
+	cfg := config.InstanceConfig{HealthCheckFromReadinessProbe: true, HealthCheckExpect: "200 OK"}
+
+	hc, err := r.backendHealthCheck(context.TODO(), cfg, svc, svc.Spec.Ports[0])
+	require.NoError(t, err)
+	assert.Equal(t, &networkapi.HealthCheck{
+		Type:        "HTTPS",
+		Request:     `GET /healthz HTTP/1.1\r\nHost: app.example.com\r\nConnection: close\r\n\r\n`,
+		Expect:      "200 OK",
+		Destination: "*:8081",
+	}, hc)
+
+	hc, err = r.backendHealthCheck(context.TODO(), cfg, svc, svc.Spec.Ports[1])
+	require.NoError(t, err)
+	assert.Nil(t, hc, "the sidecar serving the port has no readiness probe")
+
+	hc, err = r.backendHealthCheck(context.TODO(), config.InstanceConfig{}, svc, svc.Spec.Ports[0])
+	require.NoError(t, err)
+	assert.Nil(t, hc, "readiness probes are only used when enabled")
+}
+
+func TestPodMapFunc(t *testing.T) {
+	lbClass := "kube-napi-ingress.tsuru.io/networkapi"
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "app"}},
+	}
+	lbSvc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-lb", Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type:              corev1.ServiceTypeLoadBalancer,
+			LoadBalancerClass: &lbClass,
+			Selector:          map[string]string{"app": "app"},
+		},
+	}
+	otherSvc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "blog", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Selector: map[string]string{"app": "blog"}},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-1", Namespace: "default", Labels: map[string]string{"app": "app", "version": "v1"}},
+	}
+	slices := []*discoveryv1.EndpointSlice{
+		endpointSlice("app", "app-1", "main", 80, "10.0.0.1"),
+		endpointSlice("app-lb", "app-lb-1", "main", 80, "10.0.0.1"),
+		endpointSlice("blog", "blog-1", "main", 80, "10.0.0.2"),
+	}
+	slices[0].Endpoints[0].TargetRef = &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "app-1"}
+	slices[1].Endpoints[0].TargetRef = &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "app-1"}
+	slices[2].Endpoints[0].TargetRef = &corev1.ObjectReference{Kind: "Pod", Namespace: "default", Name: "blog-1"}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(svc, lbSvc, otherSvc, pod, slices[0], slices[1], slices[2]).Build()
+
+	owner := types.NamespacedName{Namespace: "default", Name: "ingress-1"}
+	w := newServiceWatcher()
+	w.setServices(owner, []types.NamespacedName{namespacedName(svc)})
+	w.setServices(types.NamespacedName{Namespace: "default", Name: "ingress-2"}, []types.NamespacedName{namespacedName(otherSvc)})
+	assert.Equal(t, []reconcile.Request{{NamespacedName: owner}}, w.podMapFunc(client)(pod))
+
+	otherNamespacePod := pod.DeepCopy()
+	otherNamespacePod.Namespace = "other"
+	assert.Empty(t, w.podMapFunc(client)(otherNamespacePod))
+
+	r := NewServiceReconciler(client, &record.FakeRecorder{}, config.Config{LoadBalancerClass: lbClass})
+	assert.Equal(t, []reconcile.Request{{NamespacedName: namespacedName(lbSvc)}}, r.podMapFunc(pod))
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+)
+
+const (
+	ipFamilyIPv4 = "IPv4"
+	ipFamilyIPv6 = "IPv6"
+)
+
+// vipFamilies are the IP families of the VIP addresses.
+type vipFamilies struct {
+	ipv4 bool
+	ipv6 bool
+}
+
+// parseIPFamilies parses a comma separated list of IP families, a VIP has
+// only an IPv4 address by default.
+func parseIPFamilies(value string) (vipFamilies, error) {
+	var families vipFamilies
+	for _, family := range strings.Split(value, ",") {
+		family = strings.TrimSpace(family)
+		switch {
+		case family == "":
+		case strings.EqualFold(family, ipFamilyIPv4):
+			families.ipv4 = true
+		case strings.EqualFold(family, ipFamilyIPv6):
+			families.ipv6 = true
+		default:
+			return vipFamilies{}, errors.Errorf("invalid IP family %q, must be IPv4 or IPv6", family)
+		}
+	}
+	if !families.ipv4 && !families.ipv6 {
+		families.ipv4 = true
+	}
+	return families, nil
+}
+
+func isIPv6(ip net.IP) bool {
+	return ip.To4() == nil && ip.To16() != nil
+}
+
+// networkID returns the network of the target IP family, IPv6 targets have
+// no network unless an IPv6 network is configured.
+func (r *baseReconciler) networkID(ip net.IP, loadBalancer bool) int {
+	switch {
+	case isIPv6(ip) && loadBalancer:
+		return r.cfg.LBNetworkIPv6ID
+	case isIPv6(ip):
+		return r.cfg.PodNetworkIPv6ID
+	case loadBalancer:
+		return r.cfg.LBNetworkID
+	}
+	return r.cfg.PodNetworkID
+}
+
+// vipIPs are the addresses allocated to a VIP, one per IP family.
+type vipIPs struct {
+	ipv4 *networkapi.IP
+	ipv6 *networkapi.IPv6
+}
+
+// addresses returns the VIP addresses, IPv4 first.
+func (ips vipIPs) addresses() []string {
+	var addresses []string
+	if ips.ipv4 != nil {
+		addresses = append(addresses, ips.ipv4.ToNetIP().String())
+	}
+	if ips.ipv6 != nil {
+		addresses = append(addresses, ips.ipv6.ToNetIP().String())
+	}
+	return addresses
+}
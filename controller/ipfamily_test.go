@@ -0,0 +1,163 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestParseIPFamilies(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected vipFamilies
+		err      string
+	}{
+		{value: "", expected: vipFamilies{ipv4: true}},
+		{value: "IPv4", expected: vipFamilies{ipv4: true}},
+		{value: "ipv6", expected: vipFamilies{ipv6: true}},
+		{value: "IPv4, IPv6", expected: vipFamilies{ipv4: true, ipv6: true}},
+		{value: "IPv4,IPX", err: `invalid IP family "IPX", must be IPv4 or IPv6`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			families, err := parseIPFamilies(tt.value)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, families)
+		})
+	}
+}
+
+func TestReconcileIngressDualStack(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			vipName: {
+				ID:   99,
+				Name: vipName,
+				IPv4: &networkapi.IntOrID{ID: 8000},
+			},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10, Description: vipName},
+		},
+		IPv6sByID: map[int]networkapi.IPv6{
+			9000: {
+				ID:     9000,
+				Block1: "fd00", Block2: "0000", Block3: "0000", Block4: "0000",
+				Block5: "0000", Block6: "0000", Block7: "0000", Block8: "0010",
+				Description: vipName,
+			},
+		},
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"kube-napi-ingress.tsuru.io/IPFamilies": "IPv4,IPv6",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: StringPtr("globo-networkapi"),
+			DefaultBackend: &networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: "app",
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				},
+			},
+		},
+	}
+
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	v4Slice := endpointSlice("app", "app-v4", "http", 8080, "192.168.0.1")
+	v6Slice := endpointSlice("app", "app-v6", "http", 8080, "fd00:1::1")
+	v6Slice.AddressType = discoveryv1.AddressTypeIPv6
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress, svc, v4Slice, v6Slice).Build()
+
+	r := NewReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:      "my-cluster",
+			IngressClassName: "globo-networkapi",
+			PodNetworkID:     10,
+			PodNetworkIPv6ID: 20,
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(ingress)})
+	require.NoError(t, err)
+
+	pool := fakeNetworkAPIClient.Pools[vipName+"_http"]
+	require.Len(t, pool.Members, 2)
+	targetIP, err := fakeNetworkAPIClient.GetIPByNetIP(ctx, net.ParseIP("192.168.0.1"))
+	require.NoError(t, err)
+	assert.Equal(t, 10, targetIP.NetworkIPv4ID)
+	targetIPv6, err := fakeNetworkAPIClient.GetIPv6ByNetIP(ctx, net.ParseIP("fd00:1::1"))
+	require.NoError(t, err)
+	assert.Equal(t, 20, targetIPv6.NetworkIPv6ID)
+
+	assert.Equal(t, &networkapi.PoolMemberIP{ID: targetIP.ID, IPFormated: "192.168.0.1"}, pool.Members[0].IP)
+	assert.Nil(t, pool.Members[0].IPv6)
+	assert.Nil(t, pool.Members[1].IP)
+	assert.Equal(t, &networkapi.PoolMemberIP{ID: targetIPv6.ID, IPFormated: "fd00:1::1"}, pool.Members[1].IPv6)
+
+	require.Len(t, fakeNetworkAPIClient.VIPUpdates, 1)
+	assert.Equal(t, &networkapi.IntOrID{ID: 8000}, fakeNetworkAPIClient.VIPUpdates[0].IPv4)
+	assert.Equal(t, &networkapi.IntOrID{ID: 9000}, fakeNetworkAPIClient.VIPUpdates[0].IPv6)
+
+	var updatedIngress networkingv1.Ingress
+	err = client.Get(ctx, namespacedName(ingress), &updatedIngress)
+	require.NoError(t, err)
+	assert.Equal(t, []corev1.LoadBalancerIngress{{IP: "100.10.10.10"}, {IP: "fd00::10"}}, updatedIngress.Status.LoadBalancer.Ingress)
+
+	updatedIngress.Annotations["kube-napi-ingress.tsuru.io/IPFamilies"] = "IPv4"
+	err = client.Update(ctx, &updatedIngress)
+	require.NoError(t, err)
+
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(ingress)})
+	require.NoError(t, err)
+
+	require.Len(t, fakeNetworkAPIClient.VIPUpdates, 2)
+	assert.Nil(t, fakeNetworkAPIClient.VIPUpdates[1].IPv6)
+	assert.Equal(t, []int{9000}, fakeNetworkAPIClient.IPv6Deletes)
+	assert.Empty(t, fakeNetworkAPIClient.IPDeletes)
+
+	r.cfg.PodNetworkIPv6ID = 0
+	targets, err := r.endpointTargets(ctx, svc, svc.Spec.Ports)
+	require.NoError(t, err)
+	require.Len(t, targets, 1, "IPv6 endpoints are ignored without an IPv6 pod network")
+	assert.Equal(t, "192.168.0.1", targets[0].IP.String())
+}
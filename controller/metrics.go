@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	objectOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_napi_ingress_networkapi_object_operations_total",
+		Help: "Number of NetworkAPI objects created, updated, deployed and deleted by the controller.",
+	}, []string{"kind", "operation"})
+
+	driftCorrections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_napi_ingress_drift_corrections_total",
+		Help: "Number of NetworkAPI object fields updated because they differed from the wanted state.",
+	}, []string{"kind", "field"})
+
+	poolMembers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kube_napi_ingress_pool_members",
+		Help: "Number of members of each pool managed by the controller.",
+	}, []string{"pool"})
+
+	reconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kube_napi_ingress_reconcile_errors_total",
+		Help: "Number of failed reconciles by controller and reason.",
+	}, []string{"controller", "reason"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(objectOperations, driftCorrections, poolMembers, reconcileErrors)
+}
+
+// diffFields returns the sorted top level fields changed, given the
+// differences between the existing and the wanted object.
+func diffFields(diff []string) []string {
+	seen := map[string]bool{}
+	var fields []string
+	for _, d := range diff {
+		field := d
+		if i := strings.IndexAny(d, ".[:"); i >= 0 {
+			field = d[:i]
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// recordDrift counts the fields changed by an update, given the differences
+// between the existing and the wanted object.
+func recordDrift(kind string, diff []string) {
+	for _, field := range diffFields(diff) {
+		driftCorrections.WithLabelValues(kind, field).Inc()
+	}
+}
+
+// recordPoolMembers keeps the members gauge of the pool up to date.
+func recordPoolMembers(pool *networkapi.Pool) {
+	poolMembers.WithLabelValues(pool.Identifier).Set(float64(len(pool.Members)))
+}
+
+// recordReconcileError counts a failed reconcile of the controller.
+func recordReconcileError(controller string, err error) {
+	if err == nil {
+		return
+	}
+	reconcileErrors.WithLabelValues(controller, errorReason(err)).Inc()
+}
+
+// errorReason classifies the error by the component that failed and, for
+// NetworkAPI errors, by the kind of error.
+func errorReason(err error) string {
+	if k8sErrors.ReasonForError(err) != metav1.StatusReasonUnknown {
+		return "kubernetes"
+	}
+	if kind := networkapi.KindOf(err); kind != "" {
+		return "networkapi_" + string(kind)
+	}
+	return "other"
+}
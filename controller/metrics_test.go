@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestEnsurePoolMetrics(t *testing.T) {
+	member := func(ipID int, ip string, weight int) networkapi.PoolMember {
+		return networkapi.PoolMember{IP: &networkapi.PoolMemberIP{ID: ipID, IPFormated: ip}, PortReal: 8080, Priority: 1, Weight: weight, MemberStatus: 0b011}
+	}
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		Pools: map[string]networkapi.Pool{
+			"metrics-pool": {ID: 1, Identifier: "metrics-pool", Members: []networkapi.PoolMember{member(10, "192.168.0.1", 1)}},
+		},
+		IPsByID: map[int]networkapi.IP{
+			10: {ID: 10, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 1},
+			11: {ID: 11, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 2},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	r := NewServiceReconciler(client, &record.FakeRecorder{}, config.Config{ClusterName: "my-cluster"})
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	updates := testutil.ToFloat64(objectOperations.WithLabelValues("pool", "update"))
+	drift := testutil.ToFloat64(driftCorrections.WithLabelValues("pool", "Members"))
+
+	_, _, err := r.ensurePool(ctx, &networkapi.Pool{Identifier: "metrics-pool", Members: []networkapi.PoolMember{
+		member(10, "192.168.0.1", 2),
+		member(11, "192.168.0.2", 1),
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, updates+1, testutil.ToFloat64(objectOperations.WithLabelValues("pool", "update")))
+	assert.Equal(t, drift+1, testutil.ToFloat64(driftCorrections.WithLabelValues("pool", "Members")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(poolMembers.WithLabelValues("metrics-pool")))
+
+	err = r.deletePools(ctx, []int{1})
+	require.NoError(t, err)
+
+	metric, err := poolMembers.GetMetricWithLabelValues("metrics-pool")
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), testutil.ToFloat64(metric), "gauge of removed pool is reset")
+}
+
+func TestErrorReason(t *testing.T) {
+	_, notFoundErr := (&networkapi.FakeNetworkAPI{}).GetPool(context.TODO(), "missing")
+
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{err: errors.Wrap(k8sErrors.NewConflict(schema.GroupResource{Resource: "ingresses"}, "ingress-1", errors.New("conflict")), "could not update"), expected: "kubernetes"},
+		{err: notFoundErr, expected: "networkapi_not_found"},
+		{err: errors.Wrap(&networkapi.Error{Kind: networkapi.ErrorKindServer, StatusCode: 502}, "could not get VIP"), expected: "networkapi_server"},
+		{err: &networkapi.Error{Kind: networkapi.ErrorKindNetwork, Err: &url.Error{Op: "Get", URL: "http://networkapi", Err: errors.New("connection refused")}}, expected: "networkapi_network"},
+		{err: errors.New("invalid LB method"), expected: "other"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, errorReason(tt.err), tt.err.Error())
+	}
+}
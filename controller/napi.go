@@ -3,6 +3,10 @@ package controller
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/kr/pretty"
 	"github.com/pkg/errors"
@@ -18,15 +22,14 @@ func (r *reconcileIngress) vipName(ing types.NamespacedName) string {
 	return fmt.Sprintf("%s_%s_%s_%s", config.IngressControllerName, r.cfg.ClusterName, ing.Namespace, ing.Name)
 }
 
-func (r *reconcileIngress) httpPoolName(ing types.NamespacedName) string {
-	return fmt.Sprintf("%s_http", r.vipName(ing))
-}
-
-func (r *reconcileIngress) httpsPoolName(ing types.NamespacedName) string {
-	return fmt.Sprintf("%s_https", r.vipName(ing))
+func routePoolName(vipName, poolKey, suffix string) string {
+	if poolKey != "" {
+		return fmt.Sprintf("%s_%s_%s", vipName, poolKey, suffix)
+	}
+	return fmt.Sprintf("%s_%s", vipName, suffix)
 }
 
-func (r *reconcileIngress) targetName(tg target) string {
+func (r *baseReconciler) targetName(tg target) string {
 	return fmt.Sprintf("%s_%s_%s", config.IngressControllerName, r.cfg.ClusterName, tg.IP.String())
 }
 
@@ -44,28 +47,58 @@ func newEquipment(name string, cfg config.InstanceConfig) *networkapi.Equipment
 	}
 }
 
+var lbMethods = []string{"round-robin", "least-conn", "weighted", "uri-hash"}
+
+// validatePoolConfig validates the pool and VIP settings from the instance
+// config.
+func validatePoolConfig(cfg config.InstanceConfig) error {
+	if _, err := parseIPFamilies(cfg.IPFamilies); err != nil {
+		return err
+	}
+	if cfg.LBMethod != "" {
+		valid := false
+		for _, method := range lbMethods {
+			valid = valid || cfg.LBMethod == method
+		}
+		if !valid {
+			return errors.Errorf("invalid LB method %q, must be one of %s", cfg.LBMethod, strings.Join(lbMethods, ", "))
+		}
+	}
+	return validateHealthCheck(cfg)
+}
+
 func newPool(name string, port int, cfg config.InstanceConfig) *networkapi.Pool {
+	lbMethod := cfg.LBMethod
+	if lbMethod == "" {
+		lbMethod = "round-robin"
+	}
+
 	return &networkapi.Pool{
 		Identifier:        name,
 		DefaultPort:       port,
 		Environment:       networkapi.IntOrID{ID: cfg.PoolEnvironmentID},
 		ServiceDownAction: networkapi.ServiceDownAction{Name: "none"},
-		LBMethod:          "round-robin",
-		HealthCheck: networkapi.HealthCheck{
-			Type:        "TCP",
-			Destination: "*:*",
-		},
-		DefaultLimit: 0,
+		LBMethod:          lbMethod,
+		HealthCheck:       healthCheckFromConfig(cfg),
+		DefaultLimit:      0,
 	}
 }
 
-func newVIP(name string, cfg config.InstanceConfig, vipIP *networkapi.IP, http, https *networkapi.Pool) *networkapi.VIP {
+// vipPoolEntry is a pool bound to a VIP port through an L7 rule.
+type vipPoolEntry struct {
+	Port     int
+	Pool     *networkapi.Pool
+	L7RuleID int
+	L7Value  string
+	Order    int
+}
+
+func newVIP(name string, cfg config.InstanceConfig, ips vipIPs, entries []vipPoolEntry) *networkapi.VIP {
 	vip := &networkapi.VIP{
 		Name:           name,
 		Service:        name,
 		Business:       "tsuru gke",
 		EnvironmentVIP: networkapi.IntOrID{ID: cfg.VIPEnvironmentID},
-		IPv4:           &networkapi.IntOrID{ID: vipIP.ID},
 		Ports:          []networkapi.VIPPort{},
 		Options: networkapi.VIPOptions{
 			CacheGroup:    networkapi.IntOrID{ID: cfg.CacheGroupID},
@@ -74,69 +107,115 @@ func newVIP(name string, cfg config.InstanceConfig, vipIP *networkapi.IP, http,
 			Timeout:       networkapi.IntOrID{ID: cfg.TimeoutID},
 		},
 	}
-
-	if http != nil {
-		vip.Ports = append(vip.Ports, networkapi.VIPPort{
-			Port: 80,
-			Pools: []networkapi.VIPPool{
-				{
-					ServerPool: networkapi.IntOrID{ID: http.ID},
-					L7Rule:     networkapi.IntOrID{ID: cfg.VIPL7RuleID},
-				},
-			},
-			Options: networkapi.VIPPortOptions{
-				L4Protocol: networkapi.IntOrID{ID: cfg.VIPL4ProtocolID},
-				L7Protocol: networkapi.IntOrID{ID: cfg.VIPL7ProtocolID},
-			},
-		})
+	if ips.ipv4 != nil {
+		vip.IPv4 = &networkapi.IntOrID{ID: ips.ipv4.ID}
+	}
+	if ips.ipv6 != nil {
+		vip.IPv6 = &networkapi.IntOrID{ID: ips.ipv6.ID}
 	}
 
-	if https != nil {
-		vip.Ports = append(vip.Ports, networkapi.VIPPort{
-			Port: 443,
-			Pools: []networkapi.VIPPool{
-				{
-					ServerPool: networkapi.IntOrID{ID: https.ID},
-					L7Rule:     networkapi.IntOrID{ID: cfg.VIPL7RuleID},
+	portIndex := map[int]int{}
+	for _, entry := range entries {
+		i, ok := portIndex[entry.Port]
+		if !ok {
+			i = len(vip.Ports)
+			portIndex[entry.Port] = i
+			vip.Ports = append(vip.Ports, networkapi.VIPPort{
+				Port: entry.Port,
+				Options: networkapi.VIPPortOptions{
+					L4Protocol: networkapi.IntOrID{ID: cfg.VIPL4ProtocolID},
+					L7Protocol: networkapi.IntOrID{ID: cfg.VIPL7ProtocolID},
 				},
-			},
-			Options: networkapi.VIPPortOptions{
-				L4Protocol: networkapi.IntOrID{ID: cfg.VIPL4ProtocolID},
-				L7Protocol: networkapi.IntOrID{ID: cfg.VIPL7ProtocolID},
-			},
+			})
+		}
+		vip.Ports[i].Pools = append(vip.Ports[i].Pools, networkapi.VIPPool{
+			ServerPool: networkapi.IntOrID{ID: entry.Pool.ID},
+			L7Rule:     networkapi.IntOrID{ID: entry.L7RuleID},
+			L7Value:    entry.L7Value,
+			Order:      entry.Order,
 		})
 	}
 
+	sort.SliceStable(vip.Ports, func(i, j int) bool {
+		return vip.Ports[i].Port < vip.Ports[j].Port
+	})
+
 	return vip
 }
 
-func newPoolMember(tg target, netIP *networkapi.IP) networkapi.PoolMember {
-	return networkapi.PoolMember{
-		IP: &networkapi.PoolMemberIP{
-			ID:         netIP.ID,
-			IPFormated: tg.IP.String(),
-		},
+// newPoolMember returns an enabled member, draining members have the bit
+// allowing new connections cleared. Targets without weight or priority use 1.
+// IPv6 targets are set as the member IPv6 address.
+func newPoolMember(tg target, ipID int) networkapi.PoolMember {
+	memberStatus := 0b011
+	if tg.Draining {
+		memberStatus = 0b010
+	}
+	weight, priority := tg.Weight, tg.Priority
+	if weight == 0 {
+		weight = 1
+	}
+	if priority == 0 {
+		priority = 1
+	}
+	member := networkapi.PoolMember{
 		PortReal:     tg.Port,
-		Priority:     1,
-		Weight:       1,
-		MemberStatus: 0b011,
+		Priority:     priority,
+		Weight:       weight,
+		MemberStatus: memberStatus,
+	}
+	memberIP := &networkapi.PoolMemberIP{
+		ID:         ipID,
+		IPFormated: tg.IP.String(),
+	}
+	if isIPv6(tg.IP) {
+		member.IPv6 = memberIP
+	} else {
+		member.IP = memberIP
+	}
+	return member
+}
+
+func poolMemberKey(m networkapi.PoolMember) string {
+	var ip string
+	if m.IP != nil {
+		ip = m.IP.IPFormated
+	} else if m.IPv6 != nil {
+		ip = "[" + m.IPv6.IPFormated + "]"
 	}
+	return fmt.Sprintf("%s:%d", ip, m.PortReal)
 }
 
+func sortPoolMembers(members []networkapi.PoolMember) {
+	sort.SliceStable(members, func(i, j int) bool {
+		return poolMemberKey(members[i]) < poolMemberKey(members[j])
+	})
+}
+
+// fillPoolUpdate copies the fields managed by NetworkAPI from the existing
+// pool into the wanted pool and sorts the members of both, so comparing them
+// only shows the changes to be pushed, such as the LB method, health check or
+// the members weight, priority and status.
 func fillPoolUpdate(existingPool, wantedPool *networkapi.Pool) {
 	wantedPool.ID = existingPool.ID
 	wantedPool.PoolCreated = existingPool.PoolCreated
-	existingMemberIPMap := map[int]networkapi.PoolMember{}
+	wantedPool.HealthCheck.Identifier = existingPool.HealthCheck.Identifier
+
+	existingMembers := map[string]networkapi.PoolMember{}
 	for _, existingMember := range existingPool.Members {
-		existingMemberIPMap[existingMember.IP.ID] = existingMember
+		existingMembers[poolMemberKey(existingMember)] = existingMember
 	}
 
 	for i, wantedMember := range wantedPool.Members {
-		if existingMember, ok := existingMemberIPMap[wantedMember.IP.ID]; ok {
+		if existingMember, ok := existingMembers[poolMemberKey(wantedMember)]; ok {
 			wantedMember.ID = existingMember.ID
+			wantedMember.Limit = existingMember.Limit
 			wantedPool.Members[i] = wantedMember
 		}
 	}
+
+	sortPoolMembers(existingPool.Members)
+	sortPoolMembers(wantedPool.Members)
 }
 
 func fillVIPUpdate(existingVIP, wantedVIP *networkapi.VIP) {
@@ -173,218 +252,791 @@ func fillVIPUpdate(existingVIP, wantedVIP *networkapi.VIP) {
 	}
 }
 
-func (r *reconcileIngress) getNetworkAPI() networkapi.NetworkAPI {
-	if r.networkAPIClient != nil {
-		return r.networkAPIClient
+// SharedNetworkAPI is the NetworkAPI client shared by every reconciler and
+// the sweeper. It owns the lock of the target IPs: they are ensured and added
+// to pools holding the lock for reading, and released holding it for writing,
+// so an IP found unused by every pool is not reused by a concurrent reconcile
+// before being removed.
+type SharedNetworkAPI struct {
+	networkapi.NetworkAPI
+	targetLock sync.RWMutex
+}
+
+func NewSharedNetworkAPI(cli networkapi.NetworkAPI) *SharedNetworkAPI {
+	return &SharedNetworkAPI{NetworkAPI: cli}
+}
+
+// NewNetworkAPI returns the NetworkAPI client configured by cfg, to be shared
+// by every reconciler with SetNetworkAPI.
+func NewNetworkAPI(cfg config.Config) (*SharedNetworkAPI, error) {
+	cli, err := networkapi.Client(networkapi.ClientOptions{
+		BaseURL: cfg.NetworkAPIURL,
+		Auth: networkapi.AuthOptions{
+			Type:         cfg.NetworkAPIAuth.Type,
+			Username:     cfg.NetworkAPIUsername,
+			Password:     cfg.NetworkAPIPassword,
+			Token:        cfg.NetworkAPIAuth.Token,
+			TokenURL:     cfg.NetworkAPIAuth.TokenURL,
+			ClientID:     cfg.NetworkAPIAuth.ClientID,
+			ClientSecret: cfg.NetworkAPIAuth.ClientSecret,
+			Scopes:       cfg.NetworkAPIAuth.Scopes,
+			SecretDir:    cfg.NetworkAPIAuth.SecretDir,
+		},
+		Transport: networkapi.TransportOptions{
+			Timeout:            cfg.NetworkAPITimeout,
+			CAFile:             cfg.NetworkAPICAFile,
+			CertFile:           cfg.NetworkAPICertFile,
+			KeyFile:            cfg.NetworkAPIKeyFile,
+			InsecureSkipVerify: cfg.NetworkAPIInsecure,
+			ProxyURL:           cfg.NetworkAPIProxyURL,
+			RecordFile:         cfg.NetworkAPIRecordFile,
+		},
+		RateLimit:   cfg.NetworkAPIRateLimit,
+		RateBurst:   cfg.NetworkAPIRateBurst,
+		MaxInFlight: cfg.NetworkAPIMaxInFlight,
+	})
+	if err != nil {
+		return nil, err
 	}
+	if cfg.NetworkAPICacheTTL > 0 {
+		cli = networkapi.NewCache(cli, cfg.NetworkAPICacheTTL)
+	}
+	return NewSharedNetworkAPI(cli), nil
+}
+
+// SetNetworkAPI sets the NetworkAPI client used by the reconciler, it must be
+// called before the reconciler is started.
+func (r *baseReconciler) SetNetworkAPI(cli *SharedNetworkAPI) {
+	r.networkAPIClient = cli.NetworkAPI
+	r.targetLock = &cli.targetLock
+}
 
-	return networkapi.Client(r.cfg.NetworkAPIURL, r.cfg.NetworkAPIUsername, r.cfg.NetworkAPIPassword)
+func (r *baseReconciler) getNetworkAPI() networkapi.NetworkAPI {
+	return r.networkAPIClient
 }
 
-func (r *reconcileIngress) cleanupNetworkAPI(ctx context.Context, ingName types.NamespacedName) error {
+// cleanupNetworkAPI removes the Ingress VIP and pools. The pools of Ingresses
+// taking over a VIP are unbound from it first, the VIP itself is kept.
+func (r *reconcileIngress) cleanupNetworkAPI(ctx context.Context, ingName types.NamespacedName, takeOverVIPName string) error {
 	lg := log.FromContext(ctx)
 	if r.cfg.DebugDisableCleanup {
 		lg.Info("Would cleanup ingress from network api")
 		return nil
 	}
 
+	if takeOverVIPName != "" {
+		err := r.unbindTakeOverPools(ctx, takeOverVIPName, r.vipName(ingName))
+		if err != nil {
+			return err
+		}
+	}
+
+	return r.cleanupVIP(ctx, r.vipName(ingName))
+}
+
+// unbindTakeOverPools removes the pools named after the Ingress VIP from the
+// taken over VIP and redeploys it, so the pools can be removed.
+func (r *reconcileIngress) unbindTakeOverPools(ctx context.Context, takeOverVIPName, vipName string) error {
 	netapiCli := r.getNetworkAPI()
 
-	vipName := r.vipName(ingName)
+	vip, err := netapiCli.GetVIP(ctx, takeOverVIPName)
+	if networkapi.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "could not get VIP")
+	}
 
-	vip, err := netapiCli.GetVIP(ctx, vipName)
-	if err != nil && !networkapi.IsNotFound(err) {
+	pools, err := netapiCli.ListPools(ctx, vipName+"_")
+	if err != nil {
 		return err
 	}
-	if !networkapi.IsNotFound(err) {
-		if err = netapiCli.DeleteVIP(ctx, vip); err != nil {
-			return err
+	ingressPools := map[int]bool{}
+	for _, pool := range pools {
+		if isVIPPoolName(vipName, pool.Identifier) {
+			ingressPools[pool.ID] = true
 		}
 	}
 
-	vipIP, err := netapiCli.GetIPByName(ctx, vipName)
-	if err != nil && !networkapi.IsNotFound(err) {
+	wantedVIP := *vip
+	wantedVIP.Ports = []networkapi.VIPPort{}
+	for _, port := range vip.Ports {
+		var portPools []networkapi.VIPPool
+		for _, pool := range port.Pools {
+			if !ingressPools[pool.ServerPool.ID] {
+				portPools = append(portPools, pool)
+			}
+		}
+		if len(portPools) == 0 {
+			continue
+		}
+		port.Pools = portPools
+		wantedVIP.Ports = append(wantedVIP.Ports, port)
+	}
+
+	if len(unusedPoolIDs(vip, &wantedVIP)) == 0 {
+		return nil
+	}
+
+	vip, err = r.updateVIP(ctx, vip, &wantedVIP)
+	if err != nil {
 		return err
 	}
-	if !networkapi.IsNotFound(err) {
-		if err = netapiCli.DeleteIP(ctx, vipIP.ID); err != nil {
-			return err
+	return r.deployVIP(ctx, vip)
+}
+
+// ensureTargetIP returns the ID of the target IP in NetworkAPI, creating the
+// target equipment and IP when needed.
+func (r *baseReconciler) ensureTargetIP(ctx context.Context, tg target, cfg config.InstanceConfig, cache map[string]int) (int, error) {
+	if ipID, ok := cache[tg.IP.String()]; ok {
+		return ipID, nil
+	}
+
+	netapiCli := r.getNetworkAPI()
+
+	targetName := r.targetName(tg)
+
+	equip, err := netapiCli.GetEquipment(ctx, targetName)
+	if networkapi.IsNotFound(err) {
+		newEquip := newEquipment(targetName, cfg)
+		if r.dryRun(ctx, plannedAction{Operation: "create", Kind: "equipment", Name: targetName}) {
+			equip, err = newEquip, nil
+		} else {
+			equip, err = netapiCli.CreateEquipment(ctx, newEquip)
 		}
 	}
+	if err != nil {
+		return 0, err
+	}
 
-	httpPool, err := netapiCli.GetPool(ctx, r.httpPoolName(ingName))
-	if err != nil && !networkapi.IsNotFound(err) {
-		return err
+	var ipID int
+	if isIPv6(tg.IP) {
+		ipID, err = r.ensureTargetIPv6(ctx, tg, targetName, equip)
+	} else {
+		ipID, err = r.ensureTargetIPv4(ctx, tg, targetName, equip)
+	}
+	if err != nil {
+		return 0, err
 	}
 
-	if !networkapi.IsNotFound(err) {
-		if err = netapiCli.DeletePool(ctx, httpPool.ID); err != nil {
-			return err
+	cache[tg.IP.String()] = ipID
+	return ipID, nil
+}
+
+func (r *baseReconciler) ensureTargetIPv4(ctx context.Context, tg target, targetName string, equip *networkapi.Equipment) (int, error) {
+	netapiCli := r.getNetworkAPI()
+
+	netIP, err := netapiCli.GetIPByNetIP(ctx, tg.IP)
+	if networkapi.IsNotFound(err) {
+		ip := networkapi.IPFromNetIP(tg.IP)
+		ip.NetworkIPv4ID = tg.NetworkID
+		ip.Description = targetName
+		ip.Equipments = []networkapi.IDOnly{{ID: equip.ID}}
+		if r.dryRun(ctx, plannedAction{Operation: "create", Kind: "ip", Name: targetName}) {
+			return 0, nil
 		}
+		netIP, err = netapiCli.CreateIP(ctx, &ip)
+	}
+	if err != nil {
+		return 0, err
 	}
+	return netIP.ID, nil
+}
 
-	return nil
+func (r *baseReconciler) ensureTargetIPv6(ctx context.Context, tg target, targetName string, equip *networkapi.Equipment) (int, error) {
+	netapiCli := r.getNetworkAPI()
+
+	netIP, err := netapiCli.GetIPv6ByNetIP(ctx, tg.IP)
+	if networkapi.IsNotFound(err) {
+		ip := networkapi.IPv6FromNetIP(tg.IP)
+		ip.NetworkIPv6ID = tg.NetworkID
+		ip.Description = targetName
+		ip.Equipments = []networkapi.IDOnly{{ID: equip.ID}}
+		if r.dryRun(ctx, plannedAction{Operation: "create", Kind: "ipv6", Name: targetName}) {
+			return 0, nil
+		}
+		netIP, err = netapiCli.CreateIPv6(ctx, &ip)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return netIP.ID, nil
 }
 
-func (r *reconcileIngress) reconcileNetworkAPI(ctx context.Context, ing *networkingv1.Ingress, targets []target) error {
+// ensurePool creates or updates the pool, returning it along with the members
+// removed from the existing pool, whose target IPs are released by
+// allocateTargets.
+func (r *baseReconciler) ensurePool(ctx context.Context, wantedPool *networkapi.Pool) (*networkapi.Pool, []networkapi.PoolMember, error) {
 	lg := log.FromContext(ctx)
 
 	netapiCli := r.getNetworkAPI()
 
+	pool, err := netapiCli.GetPool(ctx, wantedPool.Identifier)
+	if err != nil && !networkapi.IsNotFound(err) {
+		return nil, nil, err
+	}
+
+	if networkapi.IsNotFound(err) {
+		if r.dryRun(ctx, plannedAction{Operation: "create", Kind: "pool", Name: wantedPool.Identifier}) {
+			return wantedPool, nil, nil
+		}
+		pool, err = netapiCli.CreatePool(ctx, wantedPool)
+		if err != nil {
+			return nil, nil, err
+		}
+		objectOperations.WithLabelValues("pool", "create").Inc()
+		recordPoolMembers(pool)
+		return pool, nil, nil
+	}
+
+	fillPoolUpdate(pool, wantedPool)
+	if pool.DeepEqual(*wantedPool) {
+		recordPoolMembers(pool)
+		return pool, nil, nil
+	}
+
+	diff := pretty.Diff(*pool, *wantedPool)
+	lg.Info("Updating pool with differences", "diff", diff)
+	updatedPool := wantedPool
+	removedMembers := removedPoolMembers(pool, wantedPool)
+	if r.dryRun(ctx, plannedAction{Operation: "update", Kind: "pool", Name: wantedPool.Identifier, Fields: diffFields(diff)}) {
+		planReleasedMembers(ctx, pool.ID, removedMembers)
+	} else {
+		updatedPool, err = netapiCli.UpdatePool(ctx, wantedPool)
+		if err != nil {
+			return nil, nil, err
+		}
+		objectOperations.WithLabelValues("pool", "update").Inc()
+		recordDrift("pool", diff)
+		recordPoolMembers(updatedPool)
+	}
+
+	return updatedPool, removedMembers, nil
+}
+
+// removedPoolMembers returns the members of the existing pool missing from
+// the wanted pool.
+func removedPoolMembers(existingPool, wantedPool *networkapi.Pool) []networkapi.PoolMember {
+	wantedMembers := map[string]bool{}
+	for _, m := range wantedPool.Members {
+		wantedMembers[poolMemberKey(m)] = true
+	}
+
+	var removed []networkapi.PoolMember
+	for _, m := range existingPool.Members {
+		if !wantedMembers[poolMemberKey(m)] {
+			removed = append(removed, m)
+		}
+	}
+	return removed
+}
+
+// ensureRoutePool creates or updates the pool with the route targets on the
+// VIP port, routes without targets have no pool. It returns the members
+// removed from the pool.
+func (r *baseReconciler) ensureRoutePool(ctx context.Context, vipName string, rt routeTargets, cfg config.InstanceConfig, memberIPs map[string]int) (*networkapi.Pool, []networkapi.PoolMember, error) {
+	if len(rt.targets) == 0 {
+		return nil, nil, nil
+	}
+
+	wantedPool := newPool(routePoolName(vipName, rt.route.PoolKey, vipPortSuffix(rt.vipPort)), rt.vipPort, cfg)
+	if rt.healthCheck != nil {
+		wantedPool.HealthCheck = *rt.healthCheck
+	}
+	if rt.weighted && cfg.LBMethod == "" {
+		wantedPool.LBMethod = "weighted"
+	}
+
+	for _, tg := range rt.targets {
+		ipID, err := r.ensureTargetIP(ctx, tg, cfg, memberIPs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		wantedPool.Members = append(wantedPool.Members, newPoolMember(tg, ipID))
+	}
+
+	return r.ensurePool(ctx, wantedPool)
+}
+
+// routePoolEntries ensures the pools of the routes, sharing pools between
+// routes with the same pool key on a VIP port, and returns the VIP entries.
+// The default route uses the VIP L7 rule while the others use the path rule,
+// ordered by their position in routes.
+func (r *baseReconciler) routePoolEntries(ctx context.Context, vipName string, instCfg config.InstanceConfig, routes []routeTargets) ([]vipPoolEntry, error) {
+	err := validatePoolConfig(instCfg)
+	if err != nil {
+		return nil, err
+	}
+
+	memberIPs := map[string]int{}
+	routePools := map[string]*networkapi.Pool{}
+	routeOrders := map[string]int{}
+	boundValues := map[string]bool{}
+	var entries []vipPoolEntry
+	order := 0
+
+	err = r.allocateTargets(ctx, func() ([]networkapi.PoolMember, error) {
+		var removed []networkapi.PoolMember
+		for _, rt := range routes {
+			l7RuleID := instCfg.VIPL7RuleID
+			if !rt.route.Default {
+				if instCfg.VIPL7PathRuleID == 0 {
+					return removed, errors.New("VIPL7PathRuleID must be set to route by host or path")
+				}
+				l7RuleID = instCfg.VIPL7PathRuleID
+			}
+
+			poolKey := fmt.Sprintf("%s:%d", rt.route.PoolKey, rt.vipPort)
+			pool, ok := routePools[poolKey]
+			if !ok {
+				var poolRemoved []networkapi.PoolMember
+				pool, poolRemoved, err = r.ensureRoutePool(ctx, vipName, rt, instCfg, memberIPs)
+				if err != nil {
+					return removed, err
+				}
+				removed = append(removed, poolRemoved...)
+				routePools[poolKey] = pool
+			}
+
+			if pool == nil {
+				continue
+			}
+
+			// A glob already bound on the port by a more specific route,
+			// e.g. /foo of both an exact and a prefix path, is skipped.
+			for _, l7Value := range rt.route.l7Values() {
+				boundKey := fmt.Sprintf("%d:%s", rt.vipPort, l7Value)
+				if boundValues[boundKey] {
+					continue
+				}
+				boundValues[boundKey] = true
+
+				routeOrder, ok := 0, false
+				if !rt.route.Default {
+					if routeOrder, ok = routeOrders[l7Value]; !ok {
+						order++
+						routeOrder = order
+						routeOrders[l7Value] = routeOrder
+					}
+				}
+				entries = append(entries, vipPoolEntry{
+					Port:     rt.vipPort,
+					Pool:     pool,
+					L7RuleID: l7RuleID,
+					L7Value:  l7Value,
+					Order:    routeOrder,
+				})
+			}
+		}
+		return removed, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func (r *reconcileIngress) reconcileNetworkAPI(ctx context.Context, ing *networkingv1.Ingress, routes []routeTargets) error {
 	instCfg := config.FromInstance(ing, r.cfg)
 
-	wantedHTTPPool := newPool(r.httpPoolName(namespacedName(ing)), 80, instCfg)
-	wantedHTTPSPool := newPool(r.httpsPoolName(namespacedName(ing)), 443, instCfg)
+	entries, err := r.routePoolEntries(ctx, r.vipName(namespacedName(ing)), instCfg, routes)
+	if err != nil {
+		return err
+	}
 
-	for _, tg := range targets {
-		targetName := r.targetName(tg)
+	if len(entries) == 0 {
+		return errors.New("no pool with targets found to create")
+	}
 
-		equip, err := netapiCli.GetEquipment(ctx, targetName)
+	if takeOverVIPName := ing.Annotations[config.TakeOverAnnotation]; takeOverVIPName != "" {
+		return r.reconcileNetworkAPITakeOver(ctx, takeOverVIPName, ing, entries)
+	}
+
+	vip, ips, err := r.ensureVIP(ctx, r.vipName(namespacedName(ing)), instCfg, entries)
+	if err != nil {
+		return err
+	}
+
+	return r.deployAndUpdateStatus(ctx, ing, vip, ips, entries)
+}
+
+// ensureVIPIPs returns the VIP addresses of the configured IP families,
+// allocating them in the VIP environment when needed.
+func (r *baseReconciler) ensureVIPIPs(ctx context.Context, vipName string, instCfg config.InstanceConfig) (vipIPs, error) {
+	var ips vipIPs
+
+	families, err := parseIPFamilies(instCfg.IPFamilies)
+	if err != nil {
+		return ips, err
+	}
+
+	netapiCli := r.getNetworkAPI()
+
+	if families.ipv4 {
+		ips.ipv4, err = netapiCli.GetIPByName(ctx, vipName)
 		if networkapi.IsNotFound(err) {
-			newEquip := newEquipment(targetName, instCfg)
-			equip, err = netapiCli.CreateEquipment(ctx, newEquip)
+			if r.dryRun(ctx, plannedAction{Operation: "create", Kind: "ip", Name: vipName}) {
+				ips.ipv4, err = &networkapi.IP{Description: vipName}, nil
+			} else {
+				ips.ipv4, err = netapiCli.CreateVIPIPv4(ctx, vipName, instCfg.VIPEnvironmentID)
+			}
 		}
 		if err != nil {
-			return err
+			return ips, err
 		}
+	}
 
-		netIP, err := netapiCli.GetIPByNetIP(ctx, tg.IP)
+	if families.ipv6 {
+		ips.ipv6, err = netapiCli.GetIPv6ByName(ctx, vipName)
 		if networkapi.IsNotFound(err) {
-			ip := networkapi.IPFromNetIP(tg.IP)
-			ip.NetworkIPv4ID = tg.NetworkID
-			ip.Description = targetName
-			ip.Equipments = []networkapi.IDOnly{{ID: equip.ID}}
-			netIP, err = netapiCli.CreateIP(ctx, &ip)
+			if r.dryRun(ctx, plannedAction{Operation: "create", Kind: "ipv6", Name: vipName}) {
+				ips.ipv6, err = &networkapi.IPv6{Description: vipName}, nil
+			} else {
+				ips.ipv6, err = netapiCli.CreateVIPIPv6(ctx, vipName, instCfg.VIPEnvironmentID)
+			}
 		}
 		if err != nil {
-			return err
+			return ips, err
 		}
+	}
 
-		member := newPoolMember(tg, netIP)
+	return ips, nil
+}
 
-		if tg.TLS {
-			wantedHTTPSPool.Members = append(wantedHTTPSPool.Members, member)
-		} else {
-			wantedHTTPPool.Members = append(wantedHTTPPool.Members, member)
+// ensureVIP creates or updates the VIP, and its IPs, binding the pool entries
+// to the VIP ports.
+func (r *baseReconciler) ensureVIP(ctx context.Context, vipName string, instCfg config.InstanceConfig, entries []vipPoolEntry) (*networkapi.VIP, vipIPs, error) {
+	lg := log.FromContext(ctx)
+
+	netapiCli := r.getNetworkAPI()
+
+	ips, err := r.ensureVIPIPs(ctx, vipName, instCfg)
+	if err != nil {
+		return nil, ips, err
+	}
+
+	wantedVIP := newVIP(vipName, instCfg, ips, entries)
+
+	vip, err := netapiCli.GetVIP(ctx, wantedVIP.Name)
+	if err != nil && !networkapi.IsNotFound(err) {
+		return nil, ips, err
+	}
+
+	var stalePoolIDs []int
+	if networkapi.IsNotFound(err) {
+		if r.dryRun(ctx, plannedAction{Operation: "create", Kind: "vip", Name: wantedVIP.Name}) {
+			return wantedVIP, ips, nil
+		}
+		vip, err = netapiCli.CreateVIP(ctx, wantedVIP)
+		if err != nil {
+			return nil, ips, err
+		}
+		objectOperations.WithLabelValues("vip", "create").Inc()
+	} else {
+		stalePoolIDs = unusedPoolIDs(vip, wantedVIP)
+		droppedIPv4 := vip.IPv4 != nil && ips.ipv4 == nil
+		droppedIPv6 := vip.IPv6 != nil && ips.ipv6 == nil
+		vip, err = r.updateVIP(ctx, vip, wantedVIP)
+		if err != nil {
+			return nil, ips, err
+		}
+		err = r.releaseDroppedVIPIPs(ctx, vipName, droppedIPv4, droppedIPv6)
+		if err != nil {
+			return nil, ips, err
 		}
 	}
 
-	var httpPool, httpsPool *networkapi.Pool
+	if len(stalePoolIDs) > 0 {
+		lg.Info("Removing pools no longer used by vip", "pools", stalePoolIDs)
+	}
+	err = r.deletePools(ctx, stalePoolIDs)
+	if err != nil {
+		return nil, ips, err
+	}
+
+	return vip, ips, nil
+}
+
+// releaseDroppedVIPIPs removes the VIP IPs of the IP families dropped from
+// the VIP.
+func (r *baseReconciler) releaseDroppedVIPIPs(ctx context.Context, vipName string, ipv4, ipv6 bool) error {
+	netapiCli := r.getNetworkAPI()
 
-	if len(wantedHTTPPool.Members) > 0 {
-		var err error
-		httpPool, err = netapiCli.GetPool(ctx, wantedHTTPPool.Identifier)
+	if ipv4 {
+		ip, err := netapiCli.GetIPByName(ctx, vipName)
 		if err != nil && !networkapi.IsNotFound(err) {
 			return err
 		}
-
-		if networkapi.IsNotFound(err) {
-			httpPool, err = netapiCli.CreatePool(ctx, wantedHTTPPool)
-		} else {
-			fillPoolUpdate(httpPool, wantedHTTPPool)
-
-			if !httpPool.DeepEqual(*wantedHTTPPool) {
-				lg.Info("Updating pool with differences", "diff", pretty.Diff(*httpPool, *wantedHTTPPool))
-				httpPool, err = netapiCli.UpdatePool(ctx, wantedHTTPPool)
+		if err == nil && !r.dryRun(ctx, plannedAction{Operation: "delete", Kind: "ip", Name: vipName}) {
+			err = netapiCli.DeleteIP(ctx, ip.ID)
+			if err != nil && !networkapi.IsNotFound(err) {
+				return err
 			}
 		}
-		if err != nil {
-			return err
-		}
 	}
 
-	if len(wantedHTTPSPool.Members) > 0 {
-		var err error
-		httpsPool, err = netapiCli.GetPool(ctx, wantedHTTPSPool.Identifier)
+	if ipv6 {
+		ip, err := netapiCli.GetIPv6ByName(ctx, vipName)
 		if err != nil && !networkapi.IsNotFound(err) {
 			return err
 		}
+		if err == nil && !r.dryRun(ctx, plannedAction{Operation: "delete", Kind: "ipv6", Name: vipName}) {
+			err = netapiCli.DeleteIPv6(ctx, ip.ID)
+			if err != nil && !networkapi.IsNotFound(err) {
+				return err
+			}
+		}
+	}
 
-		if networkapi.IsNotFound(err) {
-			httpsPool, err = netapiCli.CreatePool(ctx, wantedHTTPSPool)
-		} else {
-			fillPoolUpdate(httpsPool, wantedHTTPSPool)
+	return nil
+}
 
-			if !httpsPool.DeepEqual(*wantedHTTPSPool) {
-				lg.Info("Updating pool with differences", "diff", pretty.Diff(*httpsPool, *wantedHTTPSPool))
-				httpsPool, err = netapiCli.UpdatePool(ctx, wantedHTTPSPool)
-			}
+// updateVIP updates the existing VIP when it differs from the wanted VIP.
+func (r *baseReconciler) updateVIP(ctx context.Context, vip, wantedVIP *networkapi.VIP) (*networkapi.VIP, error) {
+	fillVIPUpdate(vip, wantedVIP)
+	if vip.DeepEqual(*wantedVIP) {
+		return vip, nil
+	}
+
+	diff := pretty.Diff(*vip, *wantedVIP)
+	log.FromContext(ctx).Info("Updating vip with differences", "diff", diff)
+	if r.dryRun(ctx, plannedAction{Operation: "update", Kind: "vip", Name: wantedVIP.Name, Fields: diffFields(diff)}) {
+		return wantedVIP, nil
+	}
+	updatedVIP, err := r.getNetworkAPI().UpdateVIP(ctx, wantedVIP)
+	if err != nil {
+		return nil, err
+	}
+	objectOperations.WithLabelValues("vip", "update").Inc()
+	recordDrift("vip", diff)
+	return updatedVIP, nil
+}
+
+// unusedPoolIDs returns the pools bound to the existing VIP that are not used
+// by the wanted VIP.
+func unusedPoolIDs(existingVIP, wantedVIP *networkapi.VIP) []int {
+	wantedPoolIDs := map[int]bool{}
+	for _, port := range wantedVIP.Ports {
+		for _, pool := range port.Pools {
+			wantedPoolIDs[pool.ServerPool.ID] = true
 		}
-		if err != nil {
-			return err
+	}
+
+	var poolIDs []int
+	for _, port := range existingVIP.Ports {
+		for _, pool := range port.Pools {
+			if !wantedPoolIDs[pool.ServerPool.ID] {
+				wantedPoolIDs[pool.ServerPool.ID] = true
+				poolIDs = append(poolIDs, pool.ServerPool.ID)
+			}
 		}
 	}
+	return poolIDs
+}
+
+func (r *baseReconciler) deployVIP(ctx context.Context, vip *networkapi.VIP) error {
+	if vip.Created {
+		return nil
+	}
+	if r.dryRun(ctx, plannedAction{Operation: "deploy", Kind: "vip", Name: vip.Name}) {
+		return nil
+	}
+	err := r.getNetworkAPI().DeployVIP(ctx, vip.ID)
+	if err != nil {
+		return err
+	}
+	objectOperations.WithLabelValues("vip", "deploy").Inc()
+	return nil
+}
+
+// vipPoolNameRegexp matches the pool names after the VIP name, an optional
+// route or port key followed by the VIP port suffix.
+var vipPoolNameRegexp = regexp.MustCompile(`^_([0-9a-f]{8}_)?(http|https|[0-9]+)$`)
+
+// servicePoolNameRegexp matches the pool names after a Service VIP name, the
+// Service port.
+var servicePoolNameRegexp = regexp.MustCompile(`^_[0-9]+$`)
+
+// isVIPPoolName checks whether the pool is named after the VIP.
+func isVIPPoolName(vipName, poolName string) bool {
+	return strings.HasPrefix(poolName, vipName) && vipPoolNameRegexp.MatchString(strings.TrimPrefix(poolName, vipName))
+}
 
-	if httpPool == nil && httpsPool == nil {
-		return errors.New("no pool with http or https found to create")
+func (r *baseReconciler) clusterPrefix() string {
+	return fmt.Sprintf("%s_%s_", config.IngressControllerName, r.cfg.ClusterName)
+}
+
+// poolVIPNames returns the VIP names of the cluster the pool may be named
+// after. Ingress VIP names end with the namespace and name, while Service and
+// Gateway ones have an extra svc or gw infix, so pools of an Ingress in the
+// svc or gw namespace may have the same names as pools of a Service or
+// Gateway.
+func (r *baseReconciler) poolVIPNames(poolName string) []string {
+	prefix := r.clusterPrefix()
+	if !strings.HasPrefix(poolName, prefix) {
+		return nil
 	}
+	parts := strings.Split(strings.TrimPrefix(poolName, prefix), "_")
 
-	if takeOverVIPName := ing.Annotations[config.TakeOverAnnotation]; takeOverVIPName != "" {
-		return r.reconcileNetworkAPITakeOver(ctx, takeOverVIPName, ing, httpPool, httpsPool)
+	var names []string
+	if len(parts) > 2 {
+		if vipName := prefix + strings.Join(parts[:2], "_"); isVIPPoolName(vipName, poolName) {
+			names = append(names, vipName)
+		}
+	}
+	if len(parts) > 3 {
+		vipName := prefix + strings.Join(parts[:3], "_")
+		suffix := strings.TrimPrefix(poolName, vipName)
+		if (parts[0] == "svc" && servicePoolNameRegexp.MatchString(suffix)) || (parts[0] == "gw" && vipPoolNameRegexp.MatchString(suffix)) {
+			names = append(names, vipName)
+		}
+	}
+	return names
+}
+
+// otherVIPsPools returns the IDs of the pools bound to the cluster VIPs other
+// than the given one.
+func (r *baseReconciler) otherVIPsPools(ctx context.Context, vipName string) (map[int]bool, error) {
+	vips, err := r.getNetworkAPI().ListVIPs(ctx, r.clusterPrefix())
+	if err != nil {
+		return nil, err
+	}
+	poolIDs := map[int]bool{}
+	for _, vip := range vips {
+		if vip.Name == vipName {
+			continue
+		}
+		for _, port := range vip.Ports {
+			for _, pool := range port.Pools {
+				poolIDs[pool.ServerPool.ID] = true
+			}
+		}
 	}
+	return poolIDs, nil
+}
 
-	vipName := r.vipName(namespacedName(ing))
+// cleanupVIP removes the VIP, its IPs, every pool bound to it and the pools
+// named after it left unbound by failed reconciles, releasing the target IPs
+// of the pool members. Pools whose names may belong to another VIP, or bound
+// to another VIP, are kept.
+func (r *baseReconciler) cleanupVIP(ctx context.Context, vipName string) error {
+	netapiCli := r.getNetworkAPI()
 
-	vipIP, err := netapiCli.GetIPByName(ctx, vipName)
+	var poolIDs []int
+	vip, err := netapiCli.GetVIP(ctx, vipName)
 	if err != nil && !networkapi.IsNotFound(err) {
 		return err
 	}
-	if networkapi.IsNotFound(err) {
-		vipIP, err = netapiCli.CreateVIPIPv4(ctx, vipName, instCfg.VIPEnvironmentID)
+	if !networkapi.IsNotFound(err) {
+		for _, port := range vip.Ports {
+			for _, pool := range port.Pools {
+				poolIDs = append(poolIDs, pool.ServerPool.ID)
+			}
+		}
+		if !r.dryRun(ctx, plannedAction{Operation: "delete", Kind: "vip", Name: vipName}) {
+			if err = netapiCli.DeleteVIP(ctx, vip); err != nil {
+				return err
+			}
+			objectOperations.WithLabelValues("vip", "delete").Inc()
+		}
 	}
-	if err != nil {
+
+	vipIP, err := netapiCli.GetIPByName(ctx, vipName)
+	if err != nil && !networkapi.IsNotFound(err) {
 		return err
 	}
+	if !networkapi.IsNotFound(err) && !r.dryRun(ctx, plannedAction{Operation: "delete", Kind: "ip", Name: vipName}) {
+		if err = netapiCli.DeleteIP(ctx, vipIP.ID); err != nil {
+			return err
+		}
+	}
 
-	wantedVIP := newVIP(vipName, instCfg, vipIP, httpPool, httpsPool)
-
-	vip, err := netapiCli.GetVIP(ctx, wantedVIP.Name)
+	vipIPv6, err := netapiCli.GetIPv6ByName(ctx, vipName)
 	if err != nil && !networkapi.IsNotFound(err) {
 		return err
 	}
-
-	if networkapi.IsNotFound(err) {
-		vip, err = netapiCli.CreateVIP(ctx, wantedVIP)
-	} else {
-		fillVIPUpdate(vip, wantedVIP)
-		if !vip.DeepEqual(*wantedVIP) {
-			lg.Info("Updating vip with differences", "diff", pretty.Diff(*vip, *wantedVIP))
-			vip, err = netapiCli.UpdateVIP(ctx, wantedVIP)
+	if !networkapi.IsNotFound(err) && !r.dryRun(ctx, plannedAction{Operation: "delete", Kind: "ipv6", Name: vipName}) {
+		if err = netapiCli.DeleteIPv6(ctx, vipIPv6.ID); err != nil {
+			return err
 		}
 	}
+
+	pools, err := netapiCli.ListPools(ctx, vipName+"_")
 	if err != nil {
 		return err
 	}
+	var unboundPoolIDs []int
+	for _, pool := range pools {
+		if isVIPPoolName(vipName, pool.Identifier) && !containsInt(poolIDs, pool.ID) && len(r.poolVIPNames(pool.Identifier)) == 1 {
+			unboundPoolIDs = append(unboundPoolIDs, pool.ID)
+		}
+	}
+	if len(unboundPoolIDs) > 0 {
+		boundPoolIDs, err := r.otherVIPsPools(ctx, vipName)
+		if err != nil {
+			return err
+		}
+		for _, poolID := range unboundPoolIDs {
+			if !boundPoolIDs[poolID] {
+				poolIDs = append(poolIDs, poolID)
+			}
+		}
+	}
 
-	return r.deployAndUpdateStatus(ctx, ing, vip, vipIP)
+	return r.deletePools(ctx, poolIDs)
 }
 
-func (r *reconcileIngress) deployAndUpdateStatus(ctx context.Context, ing *networkingv1.Ingress, vip *networkapi.VIP, vipIP *networkapi.IP) error {
-	netapiCli := r.getNetworkAPI()
-
-	if !vip.Created {
-		err := netapiCli.DeployVIP(ctx, vip.ID)
-		if err != nil {
-			return err
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
 		}
 	}
+	return false
+}
 
-	vipIPStr := vipIP.ToNetIP().String()
+// loadBalancerIngress returns the load balancer status entries for the VIP
+// addresses, and whether they differ from the current ones.
+func loadBalancerIngress(current []corev1.LoadBalancerIngress, ips vipIPs) ([]corev1.LoadBalancerIngress, bool) {
+	var wanted []corev1.LoadBalancerIngress
+	for _, address := range ips.addresses() {
+		wanted = append(wanted, corev1.LoadBalancerIngress{IP: address})
+	}
 
-	if len(ing.Status.LoadBalancer.Ingress) != 1 || ing.Status.LoadBalancer.Ingress[0].IP != vipIPStr {
-		ing.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: vipIPStr}}
-		err := r.client.Status().Update(ctx, ing)
+	changed := len(current) != len(wanted)
+	for i := 0; !changed && i < len(wanted); i++ {
+		changed = current[i].IP != wanted[i].IP
+	}
+	return wanted, changed
+}
+
+func (r *reconcileIngress) deployAndUpdateStatus(ctx context.Context, ing *networkingv1.Ingress, vip *networkapi.VIP, ips vipIPs, entries []vipPoolEntry) error {
+	deployErr := r.deployVIP(ctx, vip)
+	if r.cfg.DryRun {
+		return deployErr
+	}
+	err := r.patchAnnotations(ctx, ing, vipStatusAnnotations(vip, entries, deployErr == nil))
+	if deployErr != nil {
+		return deployErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if lbIngress, changed := loadBalancerIngress(ing.Status.LoadBalancer.Ingress, ips); changed {
+		ing.Status.LoadBalancer.Ingress = lbIngress
+		err = r.client.Status().Update(ctx, ing)
 		if err != nil {
 			return err
 		}
 	}
 
-	return r.client.Status().Update(ctx, ing)
+	return nil
 }
 
-func (r *reconcileIngress) reconcileNetworkAPITakeOver(ctx context.Context, takeOverVIPName string, ing *networkingv1.Ingress, httpPool, httpsPool *networkapi.Pool) error {
-	lg := log.FromContext(ctx)
-
+func (r *reconcileIngress) reconcileNetworkAPITakeOver(ctx context.Context, takeOverVIPName string, ing *networkingv1.Ingress, entries []vipPoolEntry) error {
 	netapiCli := r.getNetworkAPI()
 
 	vip, err := netapiCli.GetVIP(ctx, takeOverVIPName)
@@ -392,27 +1044,31 @@ func (r *reconcileIngress) reconcileNetworkAPITakeOver(ctx context.Context, take
 		return errors.Wrap(err, "could not get VIP")
 	}
 
-	if vip.IPv4 == nil {
-		return errors.New("no ipv4 found")
+	if vip.IPv4 == nil && vip.IPv6 == nil {
+		return errors.New("no ipv4 or ipv6 found")
 	}
 
-	vipIP, err := netapiCli.GetIPByID(ctx, vip.IPv4.ID)
-	if err != nil {
-		return errors.Wrap(err, "could not get VIP IP")
+	var ips vipIPs
+	if vip.IPv4 != nil {
+		ips.ipv4, err = netapiCli.GetIPByID(ctx, vip.IPv4.ID)
+		if err != nil {
+			return errors.Wrap(err, "could not get VIP IP")
+		}
+	}
+	if vip.IPv6 != nil {
+		ips.ipv6, err = netapiCli.GetIPv6ByID(ctx, vip.IPv6.ID)
+		if err != nil {
+			return errors.Wrap(err, "could not get VIP IPv6")
+		}
 	}
 
 	instCfg := config.FromInstance(ing, r.cfg)
 
-	wantedVIP := newVIP(vip.Name, instCfg, vipIP, httpPool, httpsPool)
-
-	fillVIPUpdate(vip, wantedVIP)
+	wantedVIP := newVIP(vip.Name, instCfg, ips, entries)
 
-	if !vip.DeepEqual(*wantedVIP) {
-		lg.Info("Updating vip with differences", "diff", pretty.Diff(*vip, *wantedVIP))
-		vip, err = netapiCli.UpdateVIP(ctx, wantedVIP)
-		if err != nil {
-			return err
-		}
+	vip, err = r.updateVIP(ctx, vip, wantedVIP)
+	if err != nil {
+		return err
 	}
-	return r.deployAndUpdateStatus(ctx, ing, vip, vipIP)
+	return r.deployAndUpdateStatus(ctx, ing, vip, ips, entries)
 }
@@ -0,0 +1,88 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func TestValidatePoolConfig(t *testing.T) {
+	assert.NoError(t, validatePoolConfig(config.InstanceConfig{}))
+	assert.NoError(t, validatePoolConfig(config.InstanceConfig{LBMethod: "least-conn"}))
+	assert.EqualError(t, validatePoolConfig(config.InstanceConfig{LBMethod: "random"}),
+		`invalid LB method "random", must be one of round-robin, least-conn, weighted, uri-hash`)
+}
+
+func TestEnsurePoolUpdates(t *testing.T) {
+	member := func(ip string, ipID, weight int) networkapi.PoolMember {
+		return newPoolMember(target{IP: net.ParseIP(ip), Port: 8080, Weight: weight}, ipID)
+	}
+
+	existing := newPool("pool-1", 80, config.InstanceConfig{})
+	existing.ID = 10
+	existing.PoolCreated = true
+	existing.HealthCheck.Identifier = "hc-10"
+	existing.Members = []networkapi.PoolMember{member("10.0.0.2", 2, 1), member("10.0.0.1", 1, 1)}
+	existing.Members[0].ID = 21
+	existing.Members[1].ID = 20
+
+	tests := map[string]struct {
+		cfg     config.InstanceConfig
+		members []networkapi.PoolMember
+		updated bool
+	}{
+		"same members in other order": {
+			members: []networkapi.PoolMember{member("10.0.0.1", 1, 1), member("10.0.0.2", 2, 1)},
+		},
+		"member weight changed": {
+			members: []networkapi.PoolMember{member("10.0.0.1", 1, 3), member("10.0.0.2", 2, 1)},
+			updated: true,
+		},
+		"lb method changed": {
+			cfg:     config.InstanceConfig{LBMethod: "least-conn"},
+			members: []networkapi.PoolMember{member("10.0.0.1", 1, 1), member("10.0.0.2", 2, 1)},
+			updated: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			existingPool := *existing
+			existingPool.Members = append([]networkapi.PoolMember{}, existing.Members...)
+			fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+				Pools: map[string]networkapi.Pool{"pool-1": existingPool},
+				IPsByID: map[int]networkapi.IP{
+					1: {ID: 1, Oct1: 10, Oct4: 1},
+					2: {ID: 2, Oct1: 10, Oct4: 2},
+				},
+			}
+			r := &baseReconciler{networkAPIClient: fakeNetworkAPIClient, targetLock: &sync.RWMutex{}}
+
+			wanted := newPool("pool-1", 80, tt.cfg)
+			wanted.Members = tt.members
+
+			ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+			_, _, err := r.ensurePool(ctx, wanted)
+			require.NoError(t, err)
+
+			if !tt.updated {
+				assert.Empty(t, fakeNetworkAPIClient.PoolUpdates)
+				return
+			}
+			require.Len(t, fakeNetworkAPIClient.PoolUpdates, 1)
+			updated := fakeNetworkAPIClient.PoolUpdates[0]
+			assert.Equal(t, 10, updated.ID)
+			assert.Equal(t, "hc-10", updated.HealthCheck.Identifier)
+			assert.Equal(t, 20, updated.Members[0].ID)
+			assert.Equal(t, 21, updated.Members[1].ID)
+		})
+	}
+}
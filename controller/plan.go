@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// plannedAction is a NetworkAPI change skipped in dry-run mode.
+type plannedAction struct {
+	Operation string
+	Kind      string
+	Name      string
+	// Fields are the fields changed by updates.
+	Fields []string
+}
+
+func (a plannedAction) String() string {
+	s := fmt.Sprintf("%s %s %s", a.Operation, a.Kind, a.Name)
+	if len(a.Fields) > 0 {
+		s += " changing " + strings.Join(a.Fields, ", ")
+	}
+	return s
+}
+
+// plan holds the actions planned by a reconcile in dry-run mode.
+type plan struct {
+	actions []plannedAction
+	// releasedMembers are the target IPs of the pools planned to be deleted
+	// or to have members removed, which the pools no longer hold.
+	releasedMembers map[string]bool
+}
+
+type planKey struct{}
+
+// withPlan returns a context collecting the actions planned by the reconcile.
+func withPlan(ctx context.Context) context.Context {
+	return context.WithValue(ctx, planKey{}, &plan{releasedMembers: map[string]bool{}})
+}
+
+func planFromContext(ctx context.Context) *plan {
+	p, _ := ctx.Value(planKey{}).(*plan)
+	return p
+}
+
+// dryRun returns whether NetworkAPI changes are only planned, in which case
+// the action is logged and added to the plan of the reconcile instead of
+// being performed.
+func (r *baseReconciler) dryRun(ctx context.Context, action plannedAction) bool {
+	if !r.cfg.DryRun {
+		return false
+	}
+	log.FromContext(ctx).Info("Would change NetworkAPI object", "operation", action.Operation, "kind", action.Kind, "name", action.Name, "fields", action.Fields)
+	if p := planFromContext(ctx); p != nil {
+		p.actions = append(p.actions, action)
+	}
+	return true
+}
+
+// releasedMemberKey identifies a target IP held by a pool, ipKey being the
+// IP family followed by the IP ID.
+func releasedMemberKey(poolID int, ipKey string) string {
+	return fmt.Sprintf("%d/%s", poolID, ipKey)
+}
+
+func memberIPKey(m networkapi.PoolMember) string {
+	if m.IP != nil {
+		return fmt.Sprintf("ipv4/%d", m.IP.ID)
+	}
+	if m.IPv6 != nil {
+		return fmt.Sprintf("ipv6/%d", m.IPv6.ID)
+	}
+	return ""
+}
+
+// planReleasedMembers marks the pool as no longer holding the target IPs of
+// the members.
+func planReleasedMembers(ctx context.Context, poolID int, members []networkapi.PoolMember) {
+	p := planFromContext(ctx)
+	if p == nil {
+		return
+	}
+	for _, m := range members {
+		p.releasedMembers[releasedMemberKey(poolID, memberIPKey(m))] = true
+	}
+}
+
+// heldByPools returns whether any of the pools using a target IP still
+// holds it once the planned changes are applied.
+func heldByPools(ctx context.Context, pools []networkapi.Pool, ipKey string) bool {
+	p := planFromContext(ctx)
+	for _, pool := range pools {
+		if p == nil || !p.releasedMembers[releasedMemberKey(pool.ID, ipKey)] {
+			return true
+		}
+	}
+	return false
+}
+
+// reportPlan emits an event on the object for each planned action.
+func (r *baseReconciler) reportPlan(ctx context.Context, obj runtime.Object) {
+	p := planFromContext(ctx)
+	if p == nil || obj == nil {
+		return
+	}
+	for _, action := range p.actions {
+		r.events.Eventf(obj, corev1.EventTypeNormal, "NetworkAPIPlanned", "Would %s", action)
+	}
+}
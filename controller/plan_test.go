@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func plannedEvents(events chan string) []string {
+	var planned []string
+	for {
+		select {
+		case e := <-events:
+			if strings.HasPrefix(e, "Normal NetworkAPIPlanned ") {
+				planned = append(planned, strings.TrimPrefix(e, "Normal NetworkAPIPlanned "))
+			}
+		default:
+			return planned
+		}
+	}
+}
+
+func TestReconcileIngressDryRun(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	target1 := "kube-napi-ingress_my-cluster_192.168.0.1"
+	target2 := "kube-napi-ingress_my-cluster_192.168.0.2"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1",
+			Namespace: "default",
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: StringPtr("globo-networkapi"),
+			DefaultBackend: &networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: "app",
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				},
+			},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	slice := endpointSlice("app", "app-1", "http", 8080, "192.168.0.1", "192.168.0.2")
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress, svc, slice).Build()
+
+	events := make(chan string, 10000)
+	r := NewReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: events,
+		},
+		config.Config{
+			ClusterName:      "my-cluster",
+			IngressClassName: "globo-networkapi",
+			DryRun:           true,
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+	req := reconcile.Request{NamespacedName: namespacedName(ingress)}
+
+	_, err := r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, fakeNetworkAPIClient.Calls)
+	assert.Equal(t, []string{
+		"Would create equipment " + target1,
+		"Would create ip " + target1,
+		"Would create equipment " + target2,
+		"Would create ip " + target2,
+		"Would create pool " + vipName + "_http",
+		"Would create ip " + vipName,
+		"Would create vip " + vipName,
+		"Would deploy vip " + vipName,
+	}, plannedEvents(events))
+
+	var updatedIngress networkingv1.Ingress
+	err = client.Get(ctx, req.NamespacedName, &updatedIngress)
+	require.NoError(t, err)
+	assert.Empty(t, updatedIngress.Status.LoadBalancer.Ingress)
+	assert.NotContains(t, updatedIngress.Annotations, config.VIPIDAnnotation)
+	assert.NotContains(t, updatedIngress.Annotations, config.LastReconcileAnnotation)
+	assert.Empty(t, updatedIngress.Finalizers, "dry run does not write the finalizer")
+
+	r.cfg.DryRun = false
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	plannedEvents(events)
+
+	r.cfg.DryRun = true
+	slice.Endpoints = slice.Endpoints[:1]
+	err = client.Update(ctx, slice)
+	require.NoError(t, err)
+	fakeNetworkAPIClient.Calls = nil
+
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, fakeNetworkAPIClient.Calls)
+	assert.Equal(t, []string{
+		"Would update pool " + vipName + "_http changing Members",
+		"Would delete ip " + target2,
+		"Would delete equipment " + target2,
+	}, plannedEvents(events))
+
+	err = client.Delete(ctx, &updatedIngress)
+	require.NoError(t, err)
+
+	_, err = r.Reconcile(ctx, req)
+	require.NoError(t, err)
+	assert.Empty(t, fakeNetworkAPIClient.Calls)
+	assert.Len(t, fakeNetworkAPIClient.VIPs, 1)
+	assert.Len(t, fakeNetworkAPIClient.Pools, 1)
+	assert.Contains(t, plannedEvents(events), "Would delete vip "+vipName)
+
+	err = client.Get(ctx, req.NamespacedName, &updatedIngress)
+	require.NoError(t, err, "the finalizer is kept in dry run")
+	assert.Equal(t, []string{config.FinalizerName}, updatedIngress.Finalizers)
+}
+
+func TestCleanupDryRunMissingPool(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			vipName: {
+				ID:   1,
+				Name: vipName,
+				Ports: []networkapi.VIPPort{
+					{Port: 80, Pools: []networkapi.VIPPool{{ServerPool: networkapi.IntOrID{ID: 10}}, {ServerPool: networkapi.IntOrID{ID: 11}}}},
+				},
+			},
+		},
+		Pools: map[string]networkapi.Pool{
+			vipName + "_http": {ID: 10, Identifier: vipName + "_http"},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	events := make(chan string, 10000)
+	r := NewReconciler(client, &record.FakeRecorder{Events: events}, config.Config{
+		ClusterName:      "my-cluster",
+		IngressClassName: "globo-networkapi",
+		DryRun:           true,
+	})
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := withPlan(log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true))))
+
+	err := r.cleanupVIP(ctx, vipName)
+	require.NoError(t, err)
+	for _, call := range fakeNetworkAPIClient.Calls {
+		assert.False(t, strings.HasPrefix(call, "Delete"), "unexpected call %s", call)
+	}
+	assert.Equal(t, []plannedAction{
+		{Operation: "delete", Kind: "vip", Name: vipName},
+		{Operation: "delete", Kind: "pool", Name: vipName + "_http"},
+	}, planFromContext(ctx).actions)
+}
+
+func TestDryRunKeepsTargetsOfUpdatedPools(t *testing.T) {
+	member := func(ipID int, ip string) networkapi.PoolMember {
+		return networkapi.PoolMember{IP: &networkapi.PoolMemberIP{ID: ipID, IPFormated: ip}, PortReal: 8080, Priority: 1, Weight: 1, MemberStatus: 0b011}
+	}
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		Pools: map[string]networkapi.Pool{
+			"pool-1": {ID: 1, Identifier: "pool-1", Members: []networkapi.PoolMember{member(10, "192.168.0.1"), member(11, "192.168.0.2")}},
+			"pool-2": {ID: 2, Identifier: "pool-2", Members: []networkapi.PoolMember{member(10, "192.168.0.1"), member(11, "192.168.0.2")}},
+		},
+		IPsByID: map[int]networkapi.IP{
+			10: {ID: 10, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 1, Description: "kube-napi-ingress_my-cluster_192.168.0.1"},
+			11: {ID: 11, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 2, Description: "kube-napi-ingress_my-cluster_192.168.0.2"},
+		},
+		Equipments: map[string]networkapi.Equipment{
+			"kube-napi-ingress_my-cluster_192.168.0.1": {ID: 20, Name: "kube-napi-ingress_my-cluster_192.168.0.1"},
+			"kube-napi-ingress_my-cluster_192.168.0.2": {ID: 21, Name: "kube-napi-ingress_my-cluster_192.168.0.2"},
+		},
+	}
+
+	client := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	r := NewReconciler(client, &record.FakeRecorder{}, config.Config{ClusterName: "my-cluster", DryRun: true})
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := withPlan(log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true))))
+
+	err := r.allocateTargets(ctx, func() ([]networkapi.PoolMember, error) {
+		_, removed, err := r.ensurePool(ctx, &networkapi.Pool{Identifier: "pool-1", Members: []networkapi.PoolMember{member(10, "192.168.0.1")}})
+		return removed, err
+	})
+	require.NoError(t, err)
+	err = r.deletePools(ctx, []int{2})
+	require.NoError(t, err)
+
+	assert.Equal(t, []plannedAction{
+		{Operation: "update", Kind: "pool", Name: "pool-1", Fields: []string{"Members"}},
+		{Operation: "delete", Kind: "pool", Name: "pool-2"},
+		{Operation: "delete", Kind: "ip", Name: "kube-napi-ingress_my-cluster_192.168.0.2"},
+		{Operation: "delete", Kind: "equipment", Name: "kube-napi-ingress_my-cluster_192.168.0.2"},
+	}, planFromContext(ctx).actions)
+}
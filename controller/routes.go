@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// ingressRoute is a host/path rule from an Ingress. The default route catches
+// every request not matched by other routes and uses the default L7 rule.
+// Routes with the same PoolKey share the same pools.
+type ingressRoute struct {
+	Default  bool
+	PoolKey  string
+	Host     string
+	Path     string
+	PathType networkingv1.PathType
+	Backend  *networkingv1.IngressServiceBackend
+}
+
+func isCatchAllPath(path string) bool {
+	return path == "" || path == "/" || path == "/*"
+}
+
+func sameBackend(b1, b2 *networkingv1.IngressServiceBackend) bool {
+	if b1 == nil || b2 == nil {
+		return b1 == b2
+	}
+	return b1.Name == b2.Name && b1.Port == b2.Port
+}
+
+// l7Values returns the globs matched by the load balancer for this route, the
+// host (if any) followed by the path. Prefix paths match whole path elements,
+// so /foo is matched both exactly and as /foo/*, but /foobar is not. Paths of
+// other types, but exact ones, match any path starting with them.
+func (rt ingressRoute) l7Values() []string {
+	if rt.Default {
+		return []string{""}
+	}
+	path := rt.Path
+	if path == "" {
+		path = "/"
+	}
+	switch {
+	case rt.PathType == networkingv1.PathTypeExact || strings.HasSuffix(path, "*"):
+		return []string{rt.Host + path}
+	case rt.PathType == networkingv1.PathTypePrefix:
+		prefix := strings.TrimSuffix(path, "/")
+		if prefix == "" {
+			return []string{rt.Host + "/*"}
+		}
+		return []string{rt.Host + prefix, rt.Host + prefix + "/*"}
+	}
+	return []string{rt.Host + path + "*"}
+}
+
+// l7Value identifies the route by the globs matched for it.
+func (rt ingressRoute) l7Value() string {
+	return strings.Join(rt.l7Values(), " ")
+}
+
+// backendPoolKey returns a short stable identifier for the backend to be used
+// in pool names.
+func backendPoolKey(backend *networkingv1.IngressServiceBackend) string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%s:%s:%d", backend.Name, backend.Port.Name, backend.Port.Number)
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+func routeLess(rt1, rt2 ingressRoute) bool {
+	if (rt1.Host != "") != (rt2.Host != "") {
+		return rt1.Host != ""
+	}
+	if (rt1.PathType == networkingv1.PathTypeExact) != (rt2.PathType == networkingv1.PathTypeExact) {
+		return rt1.PathType == networkingv1.PathTypeExact
+	}
+	if len(rt1.Path) != len(rt2.Path) {
+		return len(rt1.Path) > len(rt2.Path)
+	}
+	return rt1.l7Value() < rt2.l7Value()
+}
+
+// routesFromIngress returns the default route first, if any, followed by the
+// host/path routes ordered from the most to the least specific. Catch-all
+// paths pointing to the default backend are folded into the default route,
+// so Ingresses with a single backend keep using a single pool. When there is
+// no default backend the first catch-all path is used as default. Routes to
+// the default backend keep the empty pool key used by the default route, to
+// preserve the pool names used before multiple backends were supported.
+func routesFromIngress(ing *networkingv1.Ingress) []ingressRoute {
+	var defaultBackend *networkingv1.IngressServiceBackend
+	if ing.Spec.DefaultBackend != nil && ing.Spec.DefaultBackend.Service != nil {
+		defaultBackend = ing.Spec.DefaultBackend.Service
+	}
+
+	var candidates []ingressRoute
+	for _, rule := range ing.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, p := range rule.HTTP.Paths {
+			if p.Backend.Service == nil {
+				continue
+			}
+			rt := ingressRoute{
+				Host:    rule.Host,
+				Path:    p.Path,
+				Backend: p.Backend.Service,
+			}
+			if p.PathType != nil {
+				rt.PathType = *p.PathType
+			}
+			if defaultBackend == nil && isCatchAllPath(p.Path) {
+				defaultBackend = p.Backend.Service
+			}
+			candidates = append(candidates, rt)
+		}
+	}
+
+	var routes []ingressRoute
+	if defaultBackend != nil {
+		routes = append(routes, ingressRoute{Default: true, Backend: defaultBackend})
+	}
+
+	// A hostless catch-all path pointing elsewhere overrides the default
+	// backend, host rules must then be kept to take precedence over it.
+	overridden := false
+	for _, rt := range candidates {
+		if rt.Host == "" && isCatchAllPath(rt.Path) && !sameBackend(rt.Backend, defaultBackend) {
+			overridden = true
+		}
+	}
+
+	var l7Routes []ingressRoute
+	seen := map[string]bool{}
+	for _, rt := range candidates {
+		if isCatchAllPath(rt.Path) && sameBackend(rt.Backend, defaultBackend) && (rt.Host == "" || !overridden) {
+			continue
+		}
+		if seen[rt.l7Value()] {
+			continue
+		}
+		seen[rt.l7Value()] = true
+		if !sameBackend(rt.Backend, defaultBackend) {
+			rt.PoolKey = backendPoolKey(rt.Backend)
+		}
+		l7Routes = append(l7Routes, rt)
+	}
+	sort.SliceStable(l7Routes, func(i, j int) bool {
+		return routeLess(l7Routes[i], l7Routes[j])
+	})
+
+	return append(routes, l7Routes...)
+}
+
+// vipListener binds a VIP port to a Service port. A nil ServicePort means the
+// port of the route backend.
+type vipListener struct {
+	VIPPort     int
+	ServicePort *networkingv1.ServiceBackendPort
+}
+
+// parseVIPPorts parses a comma separated list of vipPort[:servicePort]
+// entries, where servicePort is either a port number or a port name.
+func parseVIPPorts(value string) ([]vipListener, error) {
+	var listeners []vipListener
+	seen := map[int]bool{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 2)
+		vipPort, err := strconv.Atoi(parts[0])
+		if err != nil || vipPort <= 0 || vipPort > 65535 {
+			return nil, errors.Errorf("invalid VIP port %q", parts[0])
+		}
+		if seen[vipPort] {
+			return nil, errors.Errorf("duplicated VIP port %d", vipPort)
+		}
+		seen[vipPort] = true
+
+		listener := vipListener{VIPPort: vipPort}
+		if len(parts) == 2 {
+			svcPort := networkingv1.ServiceBackendPort{}
+			if number, err := strconv.Atoi(parts[1]); err == nil {
+				svcPort.Number = int32(number)
+			} else {
+				svcPort.Name = parts[1]
+			}
+			listener.ServicePort = &svcPort
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+func vipPortSuffix(port int) string {
+	switch port {
+	case 80:
+		return "http"
+	case 443:
+		return "https"
+	}
+	return strconv.Itoa(port)
+}
+
+func servicePortMatches(p corev1.ServicePort, port networkingv1.ServiceBackendPort) bool {
+	return (port.Name != "" && port.Name == p.Name) || port.Number == p.Port
+}
+
+func matchServicePort(svc *corev1.Service, port networkingv1.ServiceBackendPort) (corev1.ServicePort, bool) {
+	for _, p := range svc.Spec.Ports {
+		if servicePortMatches(p, port) {
+			return p, true
+		}
+	}
+	return corev1.ServicePort{}, false
+}
+
+func formatBackendPort(port networkingv1.ServiceBackendPort) string {
+	if port.Name != "" {
+		return port.Name
+	}
+	return strconv.Itoa(int(port.Number))
+}
@@ -0,0 +1,522 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func pathRule(host string, paths ...networkingv1.HTTPIngressPath) networkingv1.IngressRule {
+	return networkingv1.IngressRule{
+		Host: host,
+		IngressRuleValue: networkingv1.IngressRuleValue{
+			HTTP: &networkingv1.HTTPIngressRuleValue{Paths: paths},
+		},
+	}
+}
+
+func servicePath(path, svcName string, port int32) networkingv1.HTTPIngressPath {
+	return networkingv1.HTTPIngressPath{
+		Path: path,
+		Backend: networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{
+				Name: svcName,
+				Port: networkingv1.ServiceBackendPort{Number: port},
+			},
+		},
+	}
+}
+
+func TestRoutesFromIngress(t *testing.T) {
+	exact := networkingv1.PathTypeExact
+
+	tests := map[string]struct {
+		ingress        *networkingv1.Ingress
+		expectedValues []string
+	}{
+		"single catch-all rule is the default route": {
+			ingress: &networkingv1.Ingress{
+				Spec: networkingv1.IngressSpec{
+					Rules: []networkingv1.IngressRule{
+						pathRule("www.example.com", servicePath("/", "svc", 80)),
+					},
+				},
+			},
+			expectedValues: []string{""},
+		},
+
+		"catch-all rules to the default backend are folded": {
+			ingress: &networkingv1.Ingress{
+				Spec: networkingv1.IngressSpec{
+					DefaultBackend: &networkingv1.IngressBackend{
+						Service: &networkingv1.IngressServiceBackend{
+							Name: "svc",
+							Port: networkingv1.ServiceBackendPort{Number: 80},
+						},
+					},
+					Rules: []networkingv1.IngressRule{
+						pathRule("www.example.com", servicePath("/*", "svc", 80)),
+						pathRule("blog.example.com", servicePath("", "svc", 80)),
+					},
+				},
+			},
+			expectedValues: []string{""},
+		},
+
+		"host and path rules ordered by specificity": {
+			ingress: &networkingv1.Ingress{
+				Spec: networkingv1.IngressSpec{
+					Rules: []networkingv1.IngressRule{
+						pathRule("",
+							servicePath("/", "svc", 80),
+							servicePath("/api", "svc", 8080),
+							servicePath("/api/v2/", "svc", 8080),
+						),
+						pathRule("admin.example.com", servicePath("/", "svc", 9090)),
+						pathRule("", networkingv1.HTTPIngressPath{
+							Path:     "/healthcheck",
+							PathType: &exact,
+							Backend:  servicePath("", "svc", 8080).Backend,
+						}),
+					},
+				},
+			},
+			expectedValues: []string{"", "admin.example.com/*", "/healthcheck", "/api/v2/*", "/api*"},
+		},
+
+		"without catch-all there is no default route": {
+			ingress: &networkingv1.Ingress{
+				Spec: networkingv1.IngressSpec{
+					Rules: []networkingv1.IngressRule{
+						pathRule("www.example.com", servicePath("/app", "svc", 80)),
+						pathRule("www.example.com", servicePath("/app", "svc", 80)),
+					},
+				},
+			},
+			expectedValues: []string{"www.example.com/app*"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			routes := routesFromIngress(tt.ingress)
+			var values []string
+			for _, rt := range routes {
+				values = append(values, rt.l7Value())
+			}
+			assert.Equal(t, tt.expectedValues, values)
+		})
+	}
+}
+
+func TestL7ValuesPrefixMatchesPathElements(t *testing.T) {
+	// matches reports whether the load balancer glob matches the path.
+	matches := func(glob, path string) bool {
+		if strings.HasSuffix(glob, "*") {
+			return strings.HasPrefix(path, strings.TrimSuffix(glob, "*"))
+		}
+		return glob == path
+	}
+	matchesAny := func(globs []string, path string) bool {
+		for _, glob := range globs {
+			if matches(glob, path) {
+				return true
+			}
+		}
+		return false
+	}
+
+	prefix := networkingv1.PathTypePrefix
+	for _, path := range []string{"/foo", "/foo/"} {
+		globs := ingressRoute{Path: path, PathType: prefix}.l7Values()
+		assert.Equal(t, []string{"/foo", "/foo/*"}, globs)
+		assert.True(t, matchesAny(globs, "/foo"), path)
+		assert.True(t, matchesAny(globs, "/foo/"), path)
+		assert.True(t, matchesAny(globs, "/foo/bar"), path)
+		assert.False(t, matchesAny(globs, "/foobar"), path)
+	}
+
+	assert.Equal(t, []string{"www.example.com/*"}, ingressRoute{Host: "www.example.com", Path: "/", PathType: prefix}.l7Values())
+	assert.Equal(t, []string{"/foo"}, ingressRoute{Path: "/foo", PathType: networkingv1.PathTypeExact}.l7Values())
+	assert.Equal(t, []string{"/foo*"}, ingressRoute{Path: "/foo", PathType: networkingv1.PathTypeImplementationSpecific}.l7Values())
+}
+
+func TestReconcileTakeOverWithPaths(t *testing.T) {
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			"vip-blah": {
+				Name: "vip-blah",
+				IPv4: &networkapi.IntOrID{ID: 8000},
+			},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10},
+		},
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1",
+			Namespace: "default",
+			Annotations: map[string]string{
+				config.TakeOverAnnotation: "vip-blah",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: StringPtr("globo-networkapi"),
+			Rules: []networkingv1.IngressRule{
+				pathRule("www.example.com",
+					servicePath("/", "example-service", 80),
+					servicePath("/api", "example-service", 8080),
+				),
+			},
+		},
+	}
+
+	service1 := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-service",
+			Namespace: "default",
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80},
+				{Name: "api", Port: 8080},
+			},
+		},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "10.1.1.1"}},
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress, service1).Build()
+
+	r := NewReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			IngressClassName:       "globo-networkapi",
+			DefaultVIPL7RuleID:     1,
+			DefaultVIPL7PathRuleID: 2,
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      ingress.Name,
+			Namespace: ingress.Namespace,
+		},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, fakeNetworkAPIClient.Pools, 2)
+	defaultPool := fakeNetworkAPIClient.Pools["kube-napi-ingress__default_ingress-1_http"]
+	require.Len(t, defaultPool.Members, 1)
+	assert.Equal(t, 80, defaultPool.Members[0].PortReal)
+
+	require.Len(t, fakeNetworkAPIClient.VIPUpdates, 1)
+	vip := fakeNetworkAPIClient.VIPUpdates[0]
+	require.Len(t, vip.Ports, 1)
+	assert.Equal(t, 80, vip.Ports[0].Port)
+	require.Len(t, vip.Ports[0].Pools, 2)
+	var apiPool networkapi.Pool
+	for name, pool := range fakeNetworkAPIClient.Pools {
+		if name != "kube-napi-ingress__default_ingress-1_http" {
+			apiPool = pool
+		}
+	}
+	assert.Equal(t, networkapi.VIPPool{ServerPool: networkapi.IntOrID{ID: defaultPool.ID}, L7Rule: networkapi.IntOrID{ID: 1}}, vip.Ports[0].Pools[0])
+	assert.Equal(t, networkapi.VIPPool{
+		ServerPool: networkapi.IntOrID{ID: apiPool.ID},
+		L7Rule:     networkapi.IntOrID{ID: 2},
+		L7Value:    "www.example.com/api*",
+		Order:      1,
+	}, vip.Ports[0].Pools[1])
+}
+
+func TestReconcileWithPathsRequiresL7PathRule(t *testing.T) {
+	r := &reconcileIngress{
+		baseReconciler: baseReconciler{
+			networkAPIClient: &networkapi.FakeNetworkAPI{},
+			targetLock:       &sync.RWMutex{},
+		},
+	}
+	ing := &networkingv1.Ingress{
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{
+				pathRule("www.example.com", servicePath("/api", "example-service", 8080)),
+			},
+		},
+	}
+	err := r.reconcileNetworkAPI(context.TODO(), ing, []routeTargets{
+		{route: routesFromIngress(ing)[0]},
+	})
+	assert.EqualError(t, err, "VIPL7PathRuleID must be set to route by host or path")
+}
+
+func TestReconcileTakeOverWithMultipleServices(t *testing.T) {
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			"vip-blah": {
+				Name: "vip-blah",
+				IPv4: &networkapi.IntOrID{ID: 8000},
+			},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10},
+		},
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1",
+			Namespace: "default",
+			Annotations: map[string]string{
+				config.TakeOverAnnotation: "vip-blah",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: StringPtr("globo-networkapi"),
+			Rules: []networkingv1.IngressRule{
+				pathRule("www.example.com",
+					servicePath("/", "app-service", 80),
+					servicePath("/blog", "blog-service", 80),
+				),
+				pathRule("api.example.com", servicePath("/", "app-service", 80)),
+			},
+		},
+	}
+
+	newService := func(name, ip string) *corev1.Service {
+		return &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "default",
+			},
+			Spec: corev1.ServiceSpec{
+				Type:  corev1.ServiceTypeLoadBalancer,
+				Ports: []corev1.ServicePort{{Name: "http", Port: 80}},
+			},
+			Status: corev1.ServiceStatus{
+				LoadBalancer: corev1.LoadBalancerStatus{
+					Ingress: []corev1.LoadBalancerIngress{{IP: ip}},
+				},
+			},
+		}
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress, newService("app-service", "10.1.1.1"), newService("blog-service", "10.2.2.2")).Build()
+
+	r := NewReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			IngressClassName:       "globo-networkapi",
+			DefaultVIPL7RuleID:     1,
+			DefaultVIPL7PathRuleID: 2,
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{
+		NamespacedName: types.NamespacedName{
+			Name:      ingress.Name,
+			Namespace: ingress.Namespace,
+		},
+	})
+	require.NoError(t, err)
+
+	require.Len(t, fakeNetworkAPIClient.Pools, 2)
+	appPool := fakeNetworkAPIClient.Pools["kube-napi-ingress__default_ingress-1_http"]
+	require.Len(t, appPool.Members, 1)
+	assert.Equal(t, "10.1.1.1", appPool.Members[0].IP.IPFormated)
+
+	blogPoolName := "kube-napi-ingress__default_ingress-1_" + backendPoolKey(&networkingv1.IngressServiceBackend{
+		Name: "blog-service",
+		Port: networkingv1.ServiceBackendPort{Number: 80},
+	}) + "_http"
+	blogPool := fakeNetworkAPIClient.Pools[blogPoolName]
+	require.Len(t, blogPool.Members, 1)
+	assert.Equal(t, "10.2.2.2", blogPool.Members[0].IP.IPFormated)
+
+	require.Len(t, fakeNetworkAPIClient.VIPUpdates, 1)
+	vip := fakeNetworkAPIClient.VIPUpdates[0]
+	require.Len(t, vip.Ports, 1)
+	require.Len(t, vip.Ports[0].Pools, 2)
+	assert.Equal(t, "www.example.com/blog*", vip.Ports[0].Pools[1].L7Value)
+
+	for _, svcName := range []string{"app-service", "blog-service"} {
+		reqs := r.serviceWatcher.endpointSliceMapFunc(endpointSlice(svcName, svcName+"-abcde", "http", 80))
+		assert.Equal(t, []reconcile.Request{{NamespacedName: namespacedName(ingress)}}, reqs)
+	}
+}
+
+func TestParseVIPPorts(t *testing.T) {
+	tests := map[string]struct {
+		value         string
+		expected      []vipListener
+		expectedError string
+	}{
+		"empty": {},
+		"ports with and without service ports": {
+			value: "80, 8443:https,9000:9090",
+			expected: []vipListener{
+				{VIPPort: 80},
+				{VIPPort: 8443, ServicePort: &networkingv1.ServiceBackendPort{Name: "https"}},
+				{VIPPort: 9000, ServicePort: &networkingv1.ServiceBackendPort{Number: 9090}},
+			},
+		},
+		"invalid port": {
+			value:         "http:80",
+			expectedError: `invalid VIP port "http"`,
+		},
+		"duplicated port": {
+			value:         "80:80,80:8080",
+			expectedError: "duplicated VIP port 80",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			listeners, err := parseVIPPorts(tt.value)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, listeners)
+		})
+	}
+}
+
+func TestReconcileIngressWithVIPPorts(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			vipName: {
+				ID:      99,
+				Name:    vipName,
+				IPv4:    &networkapi.IntOrID{ID: 8000},
+				Created: true,
+				Ports: []networkapi.VIPPort{
+					{
+						ID:    1,
+						Port:  80,
+						Pools: []networkapi.VIPPool{{ID: 2, ServerPool: networkapi.IntOrID{ID: 555}}},
+					},
+				},
+			},
+		},
+		Pools: map[string]networkapi.Pool{
+			vipName + "_http": {ID: 555, Identifier: vipName + "_http"},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10, Description: vipName},
+		},
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"kube-napi-ingress.tsuru.io/VIPPorts": "8080:http, 8443:https",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: StringPtr("globo-networkapi"),
+			DefaultBackend: &networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: "example-service",
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				},
+			},
+		},
+	}
+
+	service1 := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "example-service",
+			Namespace: "default",
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{
+				{Name: "http", Port: 80},
+				{Name: "https", Port: 443},
+			},
+		},
+		Status: corev1.ServiceStatus{
+			LoadBalancer: corev1.LoadBalancerStatus{
+				Ingress: []corev1.LoadBalancerIngress{{IP: "10.1.1.1"}},
+			},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress, service1).Build()
+
+	r := NewReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:      "my-cluster",
+			IngressClassName: "globo-networkapi",
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(ingress)})
+	require.NoError(t, err)
+
+	require.Len(t, fakeNetworkAPIClient.Pools, 2)
+	assert.Equal(t, 8080, fakeNetworkAPIClient.Pools[vipName+"_8080"].DefaultPort)
+	assert.Equal(t, 80, fakeNetworkAPIClient.Pools[vipName+"_8080"].Members[0].PortReal)
+	assert.Equal(t, 8443, fakeNetworkAPIClient.Pools[vipName+"_8443"].DefaultPort)
+	assert.Equal(t, 443, fakeNetworkAPIClient.Pools[vipName+"_8443"].Members[0].PortReal)
+
+	require.Len(t, fakeNetworkAPIClient.VIPUpdates, 1)
+	vip := fakeNetworkAPIClient.VIPUpdates[0]
+	require.Len(t, vip.Ports, 2)
+	assert.Equal(t, 8080, vip.Ports[0].Port)
+	assert.Equal(t, 8443, vip.Ports[1].Port)
+
+	assert.Equal(t, []int{555}, fakeNetworkAPIClient.PoolDeletes)
+}
@@ -0,0 +1,317 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var _ reconcile.Reconciler = &reconcileService{}
+
+// reconcileService provisions a VIP for Services of type LoadBalancer using
+// the configured load balancer class, with one VIP port for each Service port.
+type reconcileService struct {
+	baseReconciler
+}
+
+func NewServiceReconciler(client client.Client, evtRecorder record.EventRecorder, cfg config.Config) *reconcileService {
+	return &reconcileService{
+		baseReconciler: baseReconciler{
+			client:     client,
+			cfg:        cfg,
+			events:     evtRecorder,
+			drain:      newDrainTracker(cfg.DrainPeriod),
+			targetLock: &sync.RWMutex{},
+		},
+	}
+}
+
+func (r *reconcileService) vipName(svc types.NamespacedName) string {
+	return fmt.Sprintf("%s_%s_svc_%s_%s", config.IngressControllerName, r.cfg.ClusterName, svc.Namespace, svc.Name)
+}
+
+func (r *reconcileService) poolName(svc types.NamespacedName, port corev1.ServicePort) string {
+	return fmt.Sprintf("%s_%d", r.vipName(svc), port.Port)
+}
+
+func isManagedService(svc *corev1.Service, loadBalancerClass string) bool {
+	return svc.Spec.Type == corev1.ServiceTypeLoadBalancer &&
+		svc.Spec.LoadBalancerClass != nil &&
+		*svc.Spec.LoadBalancerClass == loadBalancerClass
+}
+
+func hasServiceFinalizer(svc *corev1.Service) bool {
+	for _, finalizer := range svc.ObjectMeta.Finalizers {
+		if finalizer == config.FinalizerName {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *reconcileService) validateService(svc *corev1.Service) error {
+	if len(svc.Spec.Ports) == 0 {
+		return errors.New("Service must have at least one port")
+	}
+
+	for _, p := range svc.Spec.Ports {
+		if p.Protocol != "" && p.Protocol != corev1.ProtocolTCP {
+			return errors.Errorf("Service port %d must use TCP protocol", p.Port)
+		}
+	}
+
+	return nil
+}
+
+func (r *reconcileService) reconcileService(ctx context.Context, svc *corev1.Service) (reconcile.Result, error) {
+	lg := log.FromContext(ctx)
+	lg.Info("Reconciling Service")
+	result := reconcile.Result{}
+
+	err := r.validateService(svc)
+	if err != nil {
+		return result, err
+	}
+
+	instCfg := config.FromInstance(svc, r.cfg)
+	err = validatePoolConfig(instCfg)
+	if err != nil {
+		return result, err
+	}
+	svcName := namespacedName(svc)
+
+	var wantedPools []*networkapi.Pool
+	var targets [][]target
+	var allTargets []target
+	for _, p := range svc.Spec.Ports {
+		portTargets, err := r.endpointTargets(ctx, svc, []corev1.ServicePort{p})
+		if err != nil {
+			return result, err
+		}
+
+		wantedPool := newPool(r.poolName(svcName, p), int(p.Port), instCfg)
+		healthCheck, err := r.backendHealthCheck(ctx, instCfg, svc, p)
+		if err != nil {
+			return result, err
+		}
+		if healthCheck != nil {
+			wantedPool.HealthCheck = *healthCheck
+		}
+		wantedPools = append(wantedPools, wantedPool)
+		targets = append(targets, portTargets)
+		allTargets = append(allTargets, portTargets...)
+	}
+	result.RequeueAfter = r.requeueAfter(allTargets)
+
+	memberIPs := map[string]int{}
+	var entries []vipPoolEntry
+
+	err = r.allocateTargets(ctx, func() ([]networkapi.PoolMember, error) {
+		var removed []networkapi.PoolMember
+		for i, wantedPool := range wantedPools {
+			for _, tg := range targets[i] {
+				ipID, err := r.ensureTargetIP(ctx, tg, instCfg, memberIPs)
+				if err != nil {
+					return removed, err
+				}
+				wantedPool.Members = append(wantedPool.Members, newPoolMember(tg, ipID))
+			}
+
+			if len(wantedPool.Members) == 0 {
+				continue
+			}
+
+			pool, poolRemoved, err := r.ensurePool(ctx, wantedPool)
+			if err != nil {
+				return removed, err
+			}
+			removed = append(removed, poolRemoved...)
+
+			entries = append(entries, vipPoolEntry{
+				Port:     wantedPool.DefaultPort,
+				Pool:     pool,
+				L7RuleID: instCfg.VIPL7RuleID,
+			})
+		}
+		return removed, nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if len(entries) == 0 {
+		return result, errors.New("no pool with endpoints found to create")
+	}
+
+	vip, ips, err := r.ensureVIP(ctx, r.vipName(svcName), instCfg, entries)
+	if err != nil {
+		return result, err
+	}
+
+	err = r.deployVIP(ctx, vip)
+	if err != nil || r.cfg.DryRun {
+		return result, err
+	}
+
+	if lbIngress, changed := loadBalancerIngress(svc.Status.LoadBalancer.Ingress, ips); changed {
+		svc.Status.LoadBalancer.Ingress = lbIngress
+		return result, r.client.Status().Update(ctx, svc)
+	}
+
+	return result, nil
+}
+
+func (r *reconcileService) cleanUp(ctx context.Context, svcName types.NamespacedName, svc *corev1.Service) (reconcile.Result, error) {
+	var result reconcile.Result
+
+	if r.cfg.DebugDisableCleanup {
+		log.FromContext(ctx).Info("Would cleanup service from network api")
+	} else {
+		err := r.cleanupVIP(ctx, r.vipName(svcName))
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if svc == nil || !hasServiceFinalizer(svc) {
+		return result, nil
+	}
+	if r.cfg.DryRun {
+		r.reportPlan(ctx, svc)
+		return result, nil
+	}
+
+	var newFinalizers []string
+	for _, finalizer := range svc.ObjectMeta.Finalizers {
+		if finalizer != config.FinalizerName {
+			newFinalizers = append(newFinalizers, finalizer)
+		}
+	}
+	svc.ObjectMeta.Finalizers = newFinalizers
+	err := r.client.Update(ctx, svc)
+	return result, err
+}
+
+func (r *reconcileService) Reconcile(ctx context.Context, request reconcile.Request) (result reconcile.Result, err error) {
+	lg := log.FromContext(ctx).WithName("reconcile").WithValues("service", request.NamespacedName.String())
+	ctx = log.IntoContext(ctx, lg)
+	defer func() {
+		recordReconcileError("service", err)
+	}()
+	if r.cfg.DryRun {
+		ctx = withPlan(ctx)
+	}
+
+	svc := &corev1.Service{}
+	err = r.client.Get(ctx, request.NamespacedName, svc)
+	if k8sErrors.IsNotFound(err) {
+		lg.Error(nil, "Could not find Service")
+		return r.cleanUp(ctx, request.NamespacedName, nil)
+	}
+	if err != nil {
+		return result, errors.Wrap(err, "could not fetch Service")
+	}
+	if svc.DeletionTimestamp != nil {
+		return r.cleanUp(ctx, request.NamespacedName, svc)
+	}
+	if !isManagedService(svc, r.cfg.LoadBalancerClass) {
+		if hasServiceFinalizer(svc) {
+			return r.cleanUp(ctx, request.NamespacedName, svc)
+		}
+		return result, nil
+	}
+
+	if !hasServiceFinalizer(svc) && !r.cfg.DryRun {
+		svc.ObjectMeta.Finalizers = append(svc.ObjectMeta.Finalizers, config.FinalizerName)
+		err = r.client.Update(ctx, svc)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	r.events.Event(svc, corev1.EventTypeNormal, "NetworkAPIServiceReconciling", "Service reconciling")
+	result, err = r.reconcileService(ctx, svc)
+	r.reportPlan(ctx, svc)
+	if err != nil {
+		r.events.Eventf(svc, corev1.EventTypeWarning, "NetworkAPIServiceReconcileFailed", "Failed to reconcile Service: %v", err)
+		return result, err
+	}
+	r.events.Event(svc, corev1.EventTypeNormal, "NetworkAPIServiceReconciled", "Service reconciled")
+
+	return result, nil
+}
+
+func (r *reconcileService) endpointSliceMapFunc(obj client.Object) []reconcile.Request {
+	svcName := types.NamespacedName{
+		Namespace: obj.GetNamespace(),
+		Name:      obj.GetLabels()[discoveryv1.LabelServiceName],
+	}
+	if svcName.Name == "" {
+		return nil
+	}
+	svc := &corev1.Service{}
+	err := r.client.Get(context.Background(), svcName, svc)
+	if err != nil || !isManagedService(svc, r.cfg.LoadBalancerClass) {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: svcName}}
+}
+
+// podMapFunc maps a Pod to the managed Services it is an endpoint of.
+func (r *reconcileService) podMapFunc(obj client.Object) []reconcile.Request {
+	var reqs []reconcile.Request
+	for _, svcName := range podServices(r.client, obj) {
+		svc := &corev1.Service{}
+		err := r.client.Get(context.Background(), svcName, svc)
+		if err != nil {
+			if !k8sErrors.IsNotFound(err) {
+				log.Log.WithName("pod-watcher").Error(err, "Unable to get Service", "service", svcName.String())
+			}
+			continue
+		}
+		if isManagedService(svc, r.cfg.LoadBalancerClass) {
+			reqs = append(reqs, reconcile.Request{NamespacedName: svcName})
+		}
+	}
+	return reqs
+}
+
+func (r *reconcileService) Watch(c controller.Controller) error {
+	err := c.Watch(
+		&source.Kind{Type: &corev1.Service{}},
+		&handler.EnqueueRequestForObject{}, predicate.NewPredicateFuncs(func(obj client.Object) bool {
+			svc, ok := obj.(*corev1.Service)
+			return ok && (isManagedService(svc, r.cfg.LoadBalancerClass) || hasServiceFinalizer(svc))
+		}),
+	)
+	if err != nil {
+		return errors.Wrap(err, "unable to watch Service")
+	}
+
+	err = c.Watch(&source.Kind{Type: &discoveryv1.EndpointSlice{}}, handler.EnqueueRequestsFromMapFunc(r.endpointSliceMapFunc))
+	if err != nil {
+		return errors.Wrap(err, "unable to watch EndpointSlice")
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(r.podMapFunc), predicate.Funcs{UpdateFunc: metadataChanged})
+	if err != nil {
+		return errors.Wrap(err, "unable to watch Pod")
+	}
+	return nil
+}
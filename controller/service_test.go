@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileService(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_svc_default_postgres"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			vipName: {
+				ID:   99,
+				Name: vipName,
+				IPv4: &networkapi.IntOrID{ID: 8000},
+			},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10, Description: vipName},
+		},
+	}
+
+	lbClass := "kube-napi-ingress.tsuru.io/networkapi"
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "postgres",
+			Namespace: "default",
+		},
+		Spec: corev1.ServiceSpec{
+			Type:              corev1.ServiceTypeLoadBalancer,
+			LoadBalancerClass: &lbClass,
+			Ports: []corev1.ServicePort{
+				{Name: "postgres", Port: 5432, Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+
+	endpoints := endpointSlice("postgres", "postgres-abcde", "postgres", 5432, "192.168.0.1", "192.168.0.2")
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(svc, endpoints).Build()
+
+	r := NewServiceReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:        "my-cluster",
+			LoadBalancerClass:  lbClass,
+			DefaultVIPL7RuleID: 1,
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(svc)})
+	require.NoError(t, err)
+
+	pool := fakeNetworkAPIClient.Pools[vipName+"_5432"]
+	assert.Equal(t, 5432, pool.DefaultPort)
+	assert.Len(t, pool.Members, 2)
+
+	require.Len(t, fakeNetworkAPIClient.VIPUpdates, 1)
+	vip := fakeNetworkAPIClient.VIPUpdates[0]
+	require.Len(t, vip.Ports, 1)
+	assert.Equal(t, 5432, vip.Ports[0].Port)
+	assert.Equal(t, []int{99}, fakeNetworkAPIClient.VIPDeploys)
+
+	updatedSvc := &corev1.Service{}
+	err = client.Get(ctx, types.NamespacedName{Name: "postgres", Namespace: "default"}, updatedSvc)
+	require.NoError(t, err)
+	assert.Equal(t, []string{config.FinalizerName}, updatedSvc.Finalizers)
+	assert.Equal(t, "100.10.10.10", updatedSvc.Status.LoadBalancer.Ingress[0].IP)
+}
+
+func TestReconcileServiceIgnoresOtherClasses(t *testing.T) {
+	otherClass := "other"
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "postgres",
+			Namespace: "default",
+		},
+		Spec: corev1.ServiceSpec{
+			Type:              corev1.ServiceTypeLoadBalancer,
+			LoadBalancerClass: &otherClass,
+			Ports:             []corev1.ServicePort{{Port: 5432}},
+		},
+	}
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(svc).Build()
+
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{}
+	r := NewServiceReconciler(client, &record.FakeRecorder{}, config.Config{
+		LoadBalancerClass: "kube-napi-ingress.tsuru.io/networkapi",
+	})
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	_, err := r.Reconcile(context.TODO(), reconcile.Request{NamespacedName: namespacedName(svc)})
+	require.NoError(t, err)
+	assert.Len(t, fakeNetworkAPIClient.Pools, 0)
+
+	updatedSvc := &corev1.Service{}
+	err = client.Get(context.TODO(), namespacedName(svc), updatedSvc)
+	require.NoError(t, err)
+	assert.Empty(t, updatedSvc.Finalizers)
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// splitBackend is a Service receiving a share of the traffic of a route.
+type splitBackend struct {
+	Service string
+	Weight  int
+}
+
+// parseTrafficSplit parses a comma separated list of service=weight entries.
+// Weights are relative shares, usually percentages.
+func parseTrafficSplit(value string) ([]splitBackend, error) {
+	var split []splitBackend
+	seen := map[string]bool{}
+	total := 0
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, errors.Errorf("invalid traffic split entry %q, must be service=weight", entry)
+		}
+		svcName := strings.TrimSpace(parts[0])
+		weight, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || weight < 0 {
+			return nil, errors.Errorf("invalid traffic split weight %q for service %s", parts[1], svcName)
+		}
+		if seen[svcName] {
+			return nil, errors.Errorf("duplicated traffic split service %s", svcName)
+		}
+		seen[svcName] = true
+		total += weight
+		split = append(split, splitBackend{Service: svcName, Weight: weight})
+	}
+
+	if len(split) > 0 && total == 0 {
+		return nil, errors.New("traffic split must have at least one service with weight")
+	}
+	return split, nil
+}
+
+// splitFor returns the traffic split including the backend Service, if any.
+func splitFor(split []splitBackend, svcName string) []splitBackend {
+	for _, b := range split {
+		if b.Service == svcName {
+			return split
+		}
+	}
+	return nil
+}
+
+type serviceTargets struct {
+	weight  int
+	targets []target
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// splitTargets combines the targets of the Services, setting the member
+// weights so each Service receives its share of the traffic regardless of its
+// number of endpoints. Weights from the pods are kept within each Service.
+func splitTargets(services []serviceTargets) []target {
+	var result []target
+	for _, s := range services {
+		if s.weight == 0 {
+			continue
+		}
+
+		total := 0
+		for _, tg := range s.targets {
+			if !tg.Draining {
+				total += targetWeight(tg)
+			}
+		}
+
+		for _, tg := range s.targets {
+			weight := 1
+			if total > 0 && !tg.Draining {
+				weight = int(math.Round(float64(s.weight*100*targetWeight(tg)) / float64(total)))
+			}
+			if weight < 1 {
+				weight = 1
+			}
+			tg.Weight = weight
+			result = append(result, tg)
+		}
+	}
+
+	divisor := 0
+	for _, tg := range result {
+		divisor = gcd(tg.Weight, divisor)
+	}
+	for i := range result {
+		result[i].Weight /= divisor
+	}
+	return result
+}
+
+func targetWeight(tg target) int {
+	if tg.Weight == 0 {
+		return 1
+	}
+	return tg.Weight
+}
+
+// splitRouteTargets returns the combined targets of the traffic split Services
+// on the ports matching the route backend Service ports.
+func (r *reconcileIngress) splitRouteTargets(ctx context.Context, ing *networkingv1.Ingress, split []splitBackend, ports []corev1.ServicePort) ([]target, error) {
+	var services []serviceTargets
+	for _, b := range split {
+		svc, err := r.backendService(ctx, ing.Namespace, b.Service)
+		if err != nil {
+			return nil, err
+		}
+
+		var svcPorts []corev1.ServicePort
+		for _, p := range ports {
+			svcPort, ok := matchServicePort(svc, networkingv1.ServiceBackendPort{Name: p.Name, Number: p.Port})
+			if !ok {
+				return nil, errors.Errorf("cannot match service port %d for traffic split service %s", p.Port, b.Service)
+			}
+			svcPorts = append(svcPorts, svcPort)
+		}
+
+		targets, err := r.targetsForService(ctx, svc, svcPorts)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, serviceTargets{weight: b.Weight, targets: targets})
+	}
+	return splitTargets(services), nil
+}
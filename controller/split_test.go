@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestParseTrafficSplit(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []splitBackend
+		err      string
+	}{
+		{value: ""},
+		{
+			value:    "app-v1=90, app-v2=10",
+			expected: []splitBackend{{Service: "app-v1", Weight: 90}, {Service: "app-v2", Weight: 10}},
+		},
+		{
+			value:    "blue=0,green=100",
+			expected: []splitBackend{{Service: "blue", Weight: 0}, {Service: "green", Weight: 100}},
+		},
+		{value: "app-v1", err: `invalid traffic split entry "app-v1", must be service=weight`},
+		{value: "app-v1=-1", err: `invalid traffic split weight "-1" for service app-v1`},
+		{value: "app-v1=10,app-v1=20", err: "duplicated traffic split service app-v1"},
+		{value: "blue=0,green=0", err: "traffic split must have at least one service with weight"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			split, err := parseTrafficSplit(tt.value)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, split)
+		})
+	}
+}
+
+func TestSplitTargets(t *testing.T) {
+	tg := func(ip string, weight int) target {
+		return target{IP: net.ParseIP(ip), Port: 8080, Weight: weight}
+	}
+
+	targets := splitTargets([]serviceTargets{
+		{weight: 90, targets: []target{tg("10.0.0.1", 0), tg("10.0.0.2", 0), tg("10.0.0.3", 0)}},
+		{weight: 10, targets: []target{tg("10.0.1.1", 0)}},
+		{weight: 0, targets: []target{tg("10.0.2.1", 0)}},
+	})
+
+	var weights []int
+	for _, tg := range targets {
+		weights = append(weights, tg.Weight)
+	}
+	assert.Equal(t, []int{3, 3, 3, 1}, weights)
+
+	targets = splitTargets([]serviceTargets{
+		{weight: 50, targets: []target{tg("10.0.0.1", 3), tg("10.0.0.2", 1)}},
+		{weight: 50, targets: []target{tg("10.0.1.1", 0)}},
+	})
+	weights = nil
+	for _, tg := range targets {
+		weights = append(weights, tg.Weight)
+	}
+	assert.Equal(t, []int{3, 1, 4}, weights)
+}
+
+func TestReconcileIngressWithTrafficSplit(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			vipName: {
+				ID:   99,
+				Name: vipName,
+				IPv4: &networkapi.IntOrID{ID: 8000},
+			},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10, Description: vipName},
+		},
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1",
+			Namespace: "default",
+			Annotations: map[string]string{
+				"kube-napi-ingress.tsuru.io/TrafficSplit": "app-v1=90,app-v2=10",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: StringPtr("globo-networkapi"),
+			DefaultBackend: &networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: "app-v1",
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				},
+			},
+		},
+	}
+
+	appV1 := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-v1", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	appV2 := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app-v2", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	appV1Slice := endpointSlice("app-v1", "app-v1-1", "http", 8080, "192.168.0.1", "192.168.0.2", "192.168.0.3")
+	appV2Slice := endpointSlice("app-v2", "app-v2-1", "http", 8080, "192.168.1.1")
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress, appV1, appV2, appV1Slice, appV2Slice).Build()
+
+	r := NewReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:      "my-cluster",
+			IngressClassName: "globo-networkapi",
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(ingress)})
+	require.NoError(t, err)
+
+	require.Len(t, fakeNetworkAPIClient.Pools, 1)
+	pool := fakeNetworkAPIClient.Pools[vipName+"_http"]
+	assert.Equal(t, "weighted", pool.LBMethod)
+	weights := map[string]int{}
+	for _, m := range pool.Members {
+		weights[m.IP.IPFormated] = m.Weight
+	}
+	assert.Equal(t, map[string]int{
+		"192.168.0.1": 3,
+		"192.168.0.2": 3,
+		"192.168.0.3": 3,
+		"192.168.1.1": 1,
+	}, weights)
+
+	reqs := r.serviceWatcher.mapFunc(appV2)
+	assert.Equal(t, []reconcile.Request{{NamespacedName: namespacedName(ingress)}}, reqs)
+}
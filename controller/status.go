@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// statusAnnotations are written by the controller to report the state of the
+// NetworkAPI objects of an Ingress, as Ingresses have no status conditions.
+var statusAnnotations = []string{
+	config.VIPIDAnnotation,
+	config.PoolIDsAnnotation,
+	config.VIPCreatedAnnotation,
+	config.PoolCreatedAnnotation,
+	config.LastReconcileAnnotation,
+	config.LastErrorAnnotation,
+}
+
+// vipStatusAnnotations returns the annotations describing the VIP and its
+// pools. Deploying the VIP also creates its pools in the load balancer.
+func vipStatusAnnotations(vip *networkapi.VIP, entries []vipPoolEntry, deployed bool) map[string]string {
+	seen := map[int]bool{}
+	var poolIDs []int
+	poolCreated := true
+	for _, entry := range entries {
+		if seen[entry.Pool.ID] {
+			continue
+		}
+		seen[entry.Pool.ID] = true
+		poolIDs = append(poolIDs, entry.Pool.ID)
+		poolCreated = poolCreated && entry.Pool.PoolCreated
+	}
+	sort.Ints(poolIDs)
+
+	ids := make([]string, len(poolIDs))
+	for i, id := range poolIDs {
+		ids[i] = strconv.Itoa(id)
+	}
+
+	return map[string]string{
+		config.VIPIDAnnotation:       strconv.Itoa(vip.ID),
+		config.PoolIDsAnnotation:     strings.Join(ids, ","),
+		config.VIPCreatedAnnotation:  strconv.FormatBool(deployed || vip.Created),
+		config.PoolCreatedAnnotation: strconv.FormatBool(deployed || poolCreated),
+	}
+}
+
+// lastErrorAnnotations returns the annotation with the error of the last
+// reconcile, removed on success.
+func lastErrorAnnotations(reconcileErr error) map[string]string {
+	var lastError string
+	if reconcileErr != nil {
+		lastError = reconcileErr.Error()
+	}
+	return map[string]string{
+		config.LastErrorAnnotation: lastError,
+	}
+}
+
+// patchAnnotations sets the annotations on the object, removing the ones with
+// empty values, and stamps the last reconcile time. Nothing is written when
+// the annotations are up to date, so reconciles without changes on the
+// NetworkAPI objects or on the error do not update the object.
+func (r *baseReconciler) patchAnnotations(ctx context.Context, obj client.Object, values map[string]string) error {
+	current := obj.GetAnnotations()
+	changes := map[string]interface{}{}
+	for key, value := range values {
+		currentValue, ok := current[key]
+		switch {
+		case value == "" && ok:
+			changes[key] = nil
+		case value != "" && currentValue != value:
+			changes[key] = value
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	changes[config.LastReconcileAnnotation] = time.Now().UTC().Format(time.RFC3339)
+
+	data, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": changes,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(r.client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data)), "could not update status annotations")
+}
+
+// withoutStatusAnnotations returns a copy of the annotations without the
+// status annotations.
+func withoutStatusAnnotations(annotations map[string]string) map[string]string {
+	result := map[string]string{}
+	for key, value := range annotations {
+		result[key] = value
+	}
+	for _, key := range statusAnnotations {
+		delete(result, key)
+	}
+	return result
+}
+
+// metadataChanged ignores the updates made by the controller to the status
+// annotations and status, which would otherwise enqueue a new reconcile.
+func metadataChanged(e event.UpdateEvent) bool {
+	oldObj, newObj := e.ObjectOld, e.ObjectNew
+	return oldObj.GetGeneration() != newObj.GetGeneration() ||
+		!equality.Semantic.DeepEqual(oldObj.GetLabels(), newObj.GetLabels()) ||
+		!equality.Semantic.DeepEqual(oldObj.GetFinalizers(), newObj.GetFinalizers()) ||
+		!equality.Semantic.DeepEqual(oldObj.GetDeletionTimestamp(), newObj.GetDeletionTimestamp()) ||
+		!equality.Semantic.DeepEqual(withoutStatusAnnotations(oldObj.GetAnnotations()), withoutStatusAnnotations(newObj.GetAnnotations()))
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileIngressStatusAnnotations(t *testing.T) {
+	vipName := "kube-napi-ingress_my-cluster_default_ingress-1"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			vipName: {
+				ID:   99,
+				Name: vipName,
+				IPv4: &networkapi.IntOrID{ID: 8000},
+			},
+		},
+		IPsByID: map[int]networkapi.IP{
+			8000: {ID: 8000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 10, Description: vipName},
+		},
+		Pools: map[string]networkapi.Pool{
+			vipName + "_http": {ID: 7, Identifier: vipName + "_http"},
+		},
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "ingress-1",
+			Namespace: "default",
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: StringPtr("globo-networkapi"),
+			DefaultBackend: &networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: "app",
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				},
+			},
+		},
+	}
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80}}},
+	}
+	slice := endpointSlice("app", "app-1", "http", 8080, "192.168.0.1")
+
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress, svc, slice).Build()
+
+	r := NewReconciler(
+		client,
+		&record.FakeRecorder{
+			Events: make(chan string, 10000),
+		},
+		config.Config{
+			ClusterName:      "my-cluster",
+			IngressClassName: "globo-networkapi",
+		},
+	)
+	r.networkAPIClient = fakeNetworkAPIClient
+
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	_, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(ingress)})
+	require.NoError(t, err)
+
+	var updatedIngress networkingv1.Ingress
+	err = client.Get(ctx, namespacedName(ingress), &updatedIngress)
+	require.NoError(t, err)
+	assert.Equal(t, "99", updatedIngress.Annotations[config.VIPIDAnnotation])
+	assert.Equal(t, "7", updatedIngress.Annotations[config.PoolIDsAnnotation])
+	assert.Equal(t, "true", updatedIngress.Annotations[config.VIPCreatedAnnotation])
+	assert.Equal(t, "true", updatedIngress.Annotations[config.PoolCreatedAnnotation])
+	assert.NotEmpty(t, updatedIngress.Annotations[config.LastReconcileAnnotation])
+	assert.NotContains(t, updatedIngress.Annotations, config.LastErrorAnnotation)
+
+	updatedIngress.Annotations[config.LastReconcileAnnotation] = "2021-08-01T10:00:00Z"
+	err = client.Update(ctx, &updatedIngress)
+	require.NoError(t, err)
+	resourceVersion := updatedIngress.ResourceVersion
+
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(ingress)})
+	require.NoError(t, err)
+
+	err = client.Get(ctx, namespacedName(ingress), &updatedIngress)
+	require.NoError(t, err)
+	assert.Equal(t, resourceVersion, updatedIngress.ResourceVersion, "unchanged status is not patched")
+	assert.Equal(t, "2021-08-01T10:00:00Z", updatedIngress.Annotations[config.LastReconcileAnnotation])
+
+	updatedIngress.Annotations["kube-napi-ingress.tsuru.io/LBMethod"] = "random"
+	err = client.Update(ctx, &updatedIngress)
+	require.NoError(t, err)
+
+	_, err = r.Reconcile(ctx, reconcile.Request{NamespacedName: namespacedName(ingress)})
+	require.Error(t, err)
+
+	err = client.Get(ctx, namespacedName(ingress), &updatedIngress)
+	require.NoError(t, err)
+	assert.Equal(t, "99", updatedIngress.Annotations[config.VIPIDAnnotation])
+	assert.Equal(t, `invalid LB method "random", must be one of round-robin, least-conn, weighted, uri-hash`, updatedIngress.Annotations[config.LastErrorAnnotation])
+	assert.NotEqual(t, "2021-08-01T10:00:00Z", updatedIngress.Annotations[config.LastReconcileAnnotation])
+}
+
+func TestVIPStatusAnnotations(t *testing.T) {
+	entries := []vipPoolEntry{
+		{Port: 80, Pool: &networkapi.Pool{ID: 12, PoolCreated: true}},
+		{Port: 443, Pool: &networkapi.Pool{ID: 11}},
+		{Port: 443, Pool: &networkapi.Pool{ID: 12, PoolCreated: true}},
+	}
+
+	assert.Equal(t, map[string]string{
+		config.VIPIDAnnotation:       "5",
+		config.PoolIDsAnnotation:     "11,12",
+		config.VIPCreatedAnnotation:  "false",
+		config.PoolCreatedAnnotation: "false",
+	}, vipStatusAnnotations(&networkapi.VIP{ID: 5}, entries, false))
+
+	annotations := vipStatusAnnotations(&networkapi.VIP{ID: 5}, entries, true)
+	assert.Equal(t, "true", annotations[config.VIPCreatedAnnotation])
+	assert.Equal(t, "true", annotations[config.PoolCreatedAnnotation])
+}
+
+func TestMetadataChanged(t *testing.T) {
+	ing := func(annotations map[string]string) *networkingv1.Ingress {
+		return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+	}
+
+	assert.False(t, metadataChanged(event.UpdateEvent{
+		ObjectOld: ing(map[string]string{"a": "1"}),
+		ObjectNew: ing(map[string]string{"a": "1", config.LastReconcileAnnotation: "2021-08-01T10:00:00Z"}),
+	}))
+	assert.True(t, metadataChanged(event.UpdateEvent{
+		ObjectOld: ing(map[string]string{"a": "1"}),
+		ObjectNew: ing(map[string]string{"a": "2"}),
+	}))
+}
@@ -0,0 +1,336 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
+)
+
+var _ manager.LeaderElectionRunnable = &Sweeper{}
+
+// orphan is a NetworkAPI object named after this cluster that no longer
+// belongs to any Ingress, Service or Gateway.
+type orphan struct {
+	Kind string
+	Name string
+	ID   int
+}
+
+func (o orphan) key() string {
+	return fmt.Sprintf("%s/%d", o.Kind, o.ID)
+}
+
+// Sweeper periodically removes the NetworkAPI objects left behind by the
+// controller, such as objects of Ingresses deleted while the controller was
+// down or whose finalizer was removed by hand. Objects are only removed after
+// being found orphaned in two consecutive sweeps, so objects being created by
+// a concurrent reconcile are not removed.
+type Sweeper struct {
+	baseReconciler
+	ingresses *reconcileIngress
+	services  *reconcileService
+	gateways  *reconcileGateway
+	suspects  map[string]bool
+}
+
+func NewSweeper(client client.Client, cfg config.Config) *Sweeper {
+	base := baseReconciler{
+		client:     client,
+		cfg:        cfg,
+		targetLock: &sync.RWMutex{},
+	}
+	return &Sweeper{
+		baseReconciler: base,
+		ingresses:      &reconcileIngress{baseReconciler: base},
+		services:       &reconcileService{baseReconciler: base},
+		gateways:       &reconcileGateway{baseReconciler: base},
+		suspects:       map[string]bool{},
+	}
+}
+
+func (s *Sweeper) NeedLeaderElection() bool {
+	return true
+}
+
+// Start runs a sweep every OrphanSweepInterval until the context is done.
+func (s *Sweeper) Start(ctx context.Context) error {
+	lg := log.FromContext(ctx).WithName("sweeper")
+	ctx = log.IntoContext(ctx, lg)
+
+	ticker := time.NewTicker(s.cfg.OrphanSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if _, err := s.Sweep(ctx); err != nil {
+			lg.Error(err, "Failed to sweep orphan NetworkAPI objects")
+		}
+	}
+}
+
+// isTargetName checks whether the name is the name of a target IP or
+// equipment, which are named after the target IP.
+func (s *Sweeper) isTargetName(name string) bool {
+	return net.ParseIP(strings.TrimPrefix(name, s.clusterPrefix())) != nil
+}
+
+// liveVIPNames returns the VIP names of every Ingress, Service and Gateway in
+// the cluster, including VIPs taken over by Ingresses.
+func (s *Sweeper) liveVIPNames(ctx context.Context) (map[string]bool, error) {
+	names := map[string]bool{}
+
+	var ingresses networkingv1.IngressList
+	err := s.client.List(ctx, &ingresses)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list ingresses")
+	}
+	for i := range ingresses.Items {
+		ing := &ingresses.Items[i]
+		names[s.ingresses.vipName(namespacedName(ing))] = true
+		if takeOverVIPName := ing.Annotations[config.TakeOverAnnotation]; takeOverVIPName != "" {
+			names[takeOverVIPName] = true
+		}
+	}
+
+	var services corev1.ServiceList
+	err = s.client.List(ctx, &services)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not list services")
+	}
+	for i := range services.Items {
+		names[s.services.vipName(namespacedName(&services.Items[i]))] = true
+	}
+
+	if s.cfg.EnableGatewayAPI {
+		var gateways gatewayv1alpha1.GatewayList
+		err = s.client.List(ctx, &gateways)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not list gateways")
+		}
+		for i := range gateways.Items {
+			names[s.gateways.vipName(namespacedName(&gateways.Items[i]))] = true
+		}
+	}
+
+	return names, nil
+}
+
+// findOrphans lists the NetworkAPI objects named after this cluster and
+// returns the ones not owned by any live VIP name, in the order they must be
+// removed.
+func (s *Sweeper) findOrphans(ctx context.Context) ([]orphan, error) {
+	netapiCli := s.getNetworkAPI()
+	prefix := s.clusterPrefix()
+
+	// NetworkAPI objects are listed before the live objects, so objects
+	// created by a reconcile running meanwhile always have a live owner.
+	vips, err := netapiCli.ListVIPs(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	pools, err := netapiCli.ListPools(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := netapiCli.ListIPs(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	ipv6s, err := netapiCli.ListIPv6s(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	equipments, err := netapiCli.ListEquipments(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	live, err := s.liveVIPNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ownedByLiveVIP := func(name string) bool {
+		if live[name] {
+			return true
+		}
+		for _, vipName := range s.poolVIPNames(name) {
+			if live[vipName] {
+				return true
+			}
+		}
+		return false
+	}
+
+	var orphans []orphan
+	livePools := map[int]bool{}
+	for _, vip := range vips {
+		if live[vip.Name] {
+			for _, port := range vip.Ports {
+				for _, pool := range port.Pools {
+					livePools[pool.ServerPool.ID] = true
+				}
+			}
+			continue
+		}
+		orphans = append(orphans, orphan{Kind: "vip", Name: vip.Name, ID: vip.ID})
+	}
+
+	usedIPs := map[string]bool{}
+	for _, pool := range pools {
+		if !livePools[pool.ID] && !ownedByLiveVIP(pool.Identifier) {
+			orphans = append(orphans, orphan{Kind: "pool", Name: pool.Identifier, ID: pool.ID})
+			continue
+		}
+		for _, m := range pool.Members {
+			if m.IP != nil {
+				usedIPs[fmt.Sprintf("ipv4/%d", m.IP.ID)] = true
+			}
+			if m.IPv6 != nil {
+				usedIPs[fmt.Sprintf("ipv6/%d", m.IPv6.ID)] = true
+			}
+		}
+	}
+
+	targetIPs := map[string]bool{}
+	for _, ip := range ips {
+		switch {
+		case s.isTargetName(ip.Description):
+			targetIPs[ip.Description] = true
+			if !usedIPs[fmt.Sprintf("ipv4/%d", ip.ID)] {
+				orphans = append(orphans, orphan{Kind: "ipv4", Name: ip.Description, ID: ip.ID})
+			}
+		case !live[ip.Description]:
+			orphans = append(orphans, orphan{Kind: "ipv4", Name: ip.Description, ID: ip.ID})
+		}
+	}
+	for _, ip := range ipv6s {
+		switch {
+		case s.isTargetName(ip.Description):
+			targetIPs[ip.Description] = true
+			if !usedIPs[fmt.Sprintf("ipv6/%d", ip.ID)] {
+				orphans = append(orphans, orphan{Kind: "ipv6", Name: ip.Description, ID: ip.ID})
+			}
+		case !live[ip.Description]:
+			orphans = append(orphans, orphan{Kind: "ipv6", Name: ip.Description, ID: ip.ID})
+		}
+	}
+
+	for _, equip := range equipments {
+		if s.isTargetName(equip.Name) && !targetIPs[equip.Name] {
+			orphans = append(orphans, orphan{Kind: "equipment", Name: equip.Name, ID: equip.ID})
+		}
+	}
+
+	return orphans, nil
+}
+
+func (s *Sweeper) deleteOrphan(ctx context.Context, o orphan) error {
+	netapiCli := s.getNetworkAPI()
+
+	var err error
+	switch o.Kind {
+	case "vip":
+		var vip *networkapi.VIP
+		vip, err = netapiCli.GetVIP(ctx, o.Name)
+		if err == nil {
+			err = netapiCli.DeleteVIP(ctx, vip)
+		}
+		if err == nil {
+			objectOperations.WithLabelValues("vip", "delete").Inc()
+		}
+	case "pool":
+		err = s.deletePools(ctx, []int{o.ID})
+	case "ipv4":
+		if s.isTargetName(o.Name) {
+			err = s.releaseTargetIPv4(ctx, o.ID)
+		} else {
+			err = netapiCli.DeleteIP(ctx, o.ID)
+		}
+	case "ipv6":
+		if s.isTargetName(o.Name) {
+			err = s.releaseTargetIPv6(ctx, o.ID)
+		} else {
+			err = netapiCli.DeleteIPv6(ctx, o.ID)
+		}
+	case "equipment":
+		err = s.deleteOrphanEquipment(ctx, o)
+	}
+	if networkapi.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// deleteOrphanEquipment removes a target equipment holding the target lock,
+// unless a reconcile registered an IP for the target meanwhile.
+func (s *Sweeper) deleteOrphanEquipment(ctx context.Context, o orphan) error {
+	netapiCli := s.getNetworkAPI()
+	lock := s.targetLock
+	lock.Lock()
+	defer lock.Unlock()
+
+	_, err := netapiCli.GetIPByName(ctx, o.Name)
+	if !networkapi.IsNotFound(err) {
+		return err
+	}
+	_, err = netapiCli.GetIPv6ByName(ctx, o.Name)
+	if !networkapi.IsNotFound(err) {
+		return err
+	}
+	return netapiCli.DeleteEquipment(ctx, o.ID)
+}
+
+// Sweep removes the orphans also found by the previous sweep and returns
+// them. In dry-run mode orphans are only reported.
+func (s *Sweeper) Sweep(ctx context.Context) ([]orphan, error) {
+	lg := log.FromContext(ctx)
+
+	orphans, err := s.findOrphans(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var removed []orphan
+	suspects := map[string]bool{}
+	for _, o := range orphans {
+		suspects[o.key()] = true
+		if !s.suspects[o.key()] {
+			lg.Info("Found orphan NetworkAPI object", "kind", o.Kind, "name", o.Name, "id", o.ID)
+			continue
+		}
+
+		if s.cfg.OrphanSweepDryRun || s.cfg.DryRun {
+			lg.Info("Would remove orphan NetworkAPI object", "kind", o.Kind, "name", o.Name, "id", o.ID)
+			removed = append(removed, o)
+			continue
+		}
+
+		lg.Info("Removing orphan NetworkAPI object", "kind", o.Kind, "name", o.Name, "id", o.ID)
+		if err = s.deleteOrphan(ctx, o); err != nil {
+			return removed, errors.Wrapf(err, "could not remove %s %s", o.Kind, o.Name)
+		}
+		removed = append(removed, o)
+	}
+	s.suspects = suspects
+
+	return removed, nil
+}
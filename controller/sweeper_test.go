@@ -0,0 +1,143 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tsuru/networkapi-ingress-controller/config"
+	"github.com/tsuru/networkapi-ingress-controller/networkapi"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+func sweeperNetworkAPI() *networkapi.FakeNetworkAPI {
+	liveVIP := "kube-napi-ingress_my-cluster_default_ingress-1"
+	orphanVIP := "kube-napi-ingress_my-cluster_default_ingress-2"
+	member := func(ipID int, ip string) networkapi.PoolMember {
+		return networkapi.PoolMember{IP: &networkapi.PoolMemberIP{ID: ipID, IPFormated: ip}, PortReal: 8080}
+	}
+	return &networkapi.FakeNetworkAPI{
+		VIPs: map[string]networkapi.VIP{
+			liveVIP: {
+				ID:   1,
+				Name: liveVIP,
+				Ports: []networkapi.VIPPort{
+					{Port: 80, Pools: []networkapi.VIPPool{{ServerPool: networkapi.IntOrID{ID: 10}}}},
+				},
+			},
+			orphanVIP: {
+				ID:   2,
+				Name: orphanVIP,
+				Ports: []networkapi.VIPPort{
+					{Port: 80, Pools: []networkapi.VIPPool{{ServerPool: networkapi.IntOrID{ID: 20}}}},
+				},
+			},
+			"other-cluster-vip": {ID: 3, Name: "other-cluster-vip"},
+		},
+		Pools: map[string]networkapi.Pool{
+			liveVIP + "_http":   {ID: 10, Identifier: liveVIP + "_http", Members: []networkapi.PoolMember{member(100, "192.168.0.1")}},
+			liveVIP + "_8080":   {ID: 11, Identifier: liveVIP + "_8080"},
+			orphanVIP + "_http": {ID: 20, Identifier: orphanVIP + "_http", Members: []networkapi.PoolMember{member(101, "192.168.0.2")}},
+		},
+		IPsByID: map[int]networkapi.IP{
+			1000: {ID: 1000, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 1, Description: liveVIP},
+			1001: {ID: 1001, Oct1: 100, Oct2: 10, Oct3: 10, Oct4: 2, Description: orphanVIP},
+			100:  {ID: 100, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 1, Description: "kube-napi-ingress_my-cluster_192.168.0.1"},
+			101:  {ID: 101, Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 2, Description: "kube-napi-ingress_my-cluster_192.168.0.2"},
+		},
+		Equipments: map[string]networkapi.Equipment{
+			"kube-napi-ingress_my-cluster_192.168.0.1": {ID: 200, Name: "kube-napi-ingress_my-cluster_192.168.0.1"},
+			"kube-napi-ingress_my-cluster_192.168.0.2": {ID: 201, Name: "kube-napi-ingress_my-cluster_192.168.0.2"},
+			"kube-napi-ingress_my-cluster_192.168.0.3": {ID: 202, Name: "kube-napi-ingress_my-cluster_192.168.0.3"},
+		},
+	}
+}
+
+func newTestSweeper(cfg config.Config, fakeNetworkAPIClient *networkapi.FakeNetworkAPI) *Sweeper {
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "ingress-1", Namespace: "default"},
+	}
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress).Build()
+
+	s := NewSweeper(client, cfg)
+	s.networkAPIClient = fakeNetworkAPIClient
+	return s
+}
+
+func TestSweeper(t *testing.T) {
+	fakeNetworkAPIClient := sweeperNetworkAPI()
+	s := newTestSweeper(config.Config{ClusterName: "my-cluster"}, fakeNetworkAPIClient)
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	removed, err := s.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, removed, "orphans are only removed on the second sweep")
+	assert.Empty(t, fakeNetworkAPIClient.VIPDeletes)
+
+	removed, err = s.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []orphan{
+		{Kind: "vip", Name: "kube-napi-ingress_my-cluster_default_ingress-2", ID: 2},
+		{Kind: "pool", Name: "kube-napi-ingress_my-cluster_default_ingress-2_http", ID: 20},
+		{Kind: "ipv4", Name: "kube-napi-ingress_my-cluster_192.168.0.2", ID: 101},
+		{Kind: "ipv4", Name: "kube-napi-ingress_my-cluster_default_ingress-2", ID: 1001},
+		{Kind: "equipment", Name: "kube-napi-ingress_my-cluster_192.168.0.3", ID: 202},
+	}, removed)
+	assert.Equal(t, []int{2}, fakeNetworkAPIClient.VIPDeletes)
+	assert.Equal(t, []int{20}, fakeNetworkAPIClient.PoolDeletes)
+	assert.Equal(t, []int{101, 1001}, fakeNetworkAPIClient.IPDeletes)
+	assert.Equal(t, []int{201, 202}, fakeNetworkAPIClient.EquipmentDeletes)
+	assert.Contains(t, fakeNetworkAPIClient.VIPs, "other-cluster-vip")
+
+	removed, err = s.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+}
+
+func TestSweeperDryRun(t *testing.T) {
+	fakeNetworkAPIClient := sweeperNetworkAPI()
+	s := newTestSweeper(config.Config{ClusterName: "my-cluster", OrphanSweepDryRun: true}, fakeNetworkAPIClient)
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	for i := 0; i < 2; i++ {
+		_, err := s.Sweep(ctx)
+		require.NoError(t, err)
+	}
+	removed, err := s.Sweep(ctx)
+	require.NoError(t, err)
+	assert.Len(t, removed, 5)
+	assert.Empty(t, fakeNetworkAPIClient.VIPDeletes)
+	assert.Empty(t, fakeNetworkAPIClient.PoolDeletes)
+	assert.Empty(t, fakeNetworkAPIClient.IPDeletes)
+	assert.Empty(t, fakeNetworkAPIClient.EquipmentDeletes)
+}
+
+func TestSweeperPoolNamedAfterLiveIngressPrefix(t *testing.T) {
+	servicePool := "kube-napi-ingress_my-cluster_svc_web_api_80"
+	fakeNetworkAPIClient := &networkapi.FakeNetworkAPI{
+		Pools: map[string]networkapi.Pool{
+			servicePool: {ID: 10, Identifier: servicePool},
+		},
+	}
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "svc"},
+	}
+	client := fake.NewClientBuilder().
+		WithScheme(scheme.Scheme).
+		WithObjects(ingress).Build()
+	s := NewSweeper(client, config.Config{ClusterName: "my-cluster"})
+	s.networkAPIClient = fakeNetworkAPIClient
+	ctx := log.IntoContext(context.TODO(), zap.New(zap.UseDevMode(true)))
+
+	orphans, err := s.findOrphans(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []orphan{{Kind: "pool", Name: servicePool, ID: 10}}, orphans)
+}
@@ -1,24 +1,37 @@
 package controller
 
 import (
+	"context"
 	"sync"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	networkingv1Beta1 "k8s.io/api/networking/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// serviceWatcher tracks the Services used by each owner object, an Ingress or
+// a Gateway, so changes on Services, Endpoints and backend Pods enqueue their
+// owners.
 type serviceWatcher struct {
 	sync.RWMutex
-	ingressToService map[types.NamespacedName]types.NamespacedName
+	ownerToServices map[types.NamespacedName]map[types.NamespacedName]struct{}
+}
+
+func newServiceWatcher() *serviceWatcher {
+	return &serviceWatcher{
+		ownerToServices: map[types.NamespacedName]map[types.NamespacedName]struct{}{},
+	}
 }
 
 func (w *serviceWatcher) mapFunc(obj client.Object) []reconcile.Request {
@@ -26,24 +39,132 @@ func (w *serviceWatcher) mapFunc(obj client.Object) []reconcile.Request {
 	defer w.RUnlock()
 	fullName := namespacedName(obj)
 	var reqs []reconcile.Request
-	for ing, svc := range w.ingressToService {
-		if svc == fullName {
-			reqs = append(reqs, reconcile.Request{NamespacedName: ing})
+	for owner, svcs := range w.ownerToServices {
+		if _, ok := svcs[fullName]; ok {
+			reqs = append(reqs, reconcile.Request{NamespacedName: owner})
 		}
 	}
 	return reqs
 }
 
-func (w *serviceWatcher) addIngressService(ingName, svcName types.NamespacedName) {
+// endpointSliceMapFunc maps an EndpointSlice to the owners of its Service.
+func (w *serviceWatcher) endpointSliceMapFunc(obj client.Object) []reconcile.Request {
+	svcName, ok := obj.GetLabels()[discoveryv1.LabelServiceName]
+	if !ok {
+		return nil
+	}
+	return w.mapFunc(&corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: svcName, Namespace: obj.GetNamespace()},
+	})
+}
+
+// podMapFunc maps a Pod to the owners of the Services it is an endpoint of,
+// as health checks and member weights are read from the backend pods.
+func (w *serviceWatcher) podMapFunc(c client.Client) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		if !w.watchesNamespace(obj.GetNamespace()) {
+			return nil
+		}
+		var reqs []reconcile.Request
+		for _, svcName := range podServices(c, obj) {
+			reqs = append(reqs, w.mapFunc(&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: svcName.Name, Namespace: svcName.Namespace},
+			})...)
+		}
+		return reqs
+	}
+}
+
+// watchesNamespace checks whether any owner uses a Service in the namespace.
+func (w *serviceWatcher) watchesNamespace(namespace string) bool {
+	w.RLock()
+	defer w.RUnlock()
+	for _, svcs := range w.ownerToServices {
+		for svcName := range svcs {
+			if svcName.Namespace == namespace {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// endpointSlicePodIndex indexes EndpointSlices by the names of their
+// endpoint pods.
+const endpointSlicePodIndex = "endpointSlicePods"
+
+func endpointSlicePods(obj client.Object) []string {
+	slice, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return nil
+	}
+	var pods []string
+	for _, ep := range slice.Endpoints {
+		if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
+			pods = append(pods, ep.TargetRef.Name)
+		}
+	}
+	return pods
+}
+
+// SetupIndexes registers the field indexes used to map watched objects to
+// the reconciled ones.
+func SetupIndexes(ctx context.Context, indexer client.FieldIndexer) error {
+	err := indexer.IndexField(ctx, &discoveryv1.EndpointSlice{}, endpointSlicePodIndex, endpointSlicePods)
+	if err != nil {
+		return errors.Wrap(err, "unable to index EndpointSlice pods")
+	}
+	return nil
+}
+
+// podServices returns the Services with the pod as an endpoint, looked up
+// through their EndpointSlices.
+func podServices(c client.Client, pod client.Object) []types.NamespacedName {
+	var slices discoveryv1.EndpointSliceList
+	err := c.List(context.Background(), &slices,
+		client.InNamespace(pod.GetNamespace()),
+		client.MatchingFields{endpointSlicePodIndex: pod.GetName()},
+	)
+	if err != nil {
+		log.Log.WithName("pod-watcher").Error(err, "Unable to list EndpointSlices", "pod", namespacedName(pod).String())
+		return nil
+	}
+
+	var svcNames []types.NamespacedName
+	seen := map[string]struct{}{}
+	for i := range slices.Items {
+		svcName, ok := slices.Items[i].Labels[discoveryv1.LabelServiceName]
+		if !ok {
+			continue
+		}
+		if _, ok := seen[svcName]; ok {
+			continue
+		}
+		for _, podName := range endpointSlicePods(&slices.Items[i]) {
+			if podName == pod.GetName() {
+				seen[svcName] = struct{}{}
+				svcNames = append(svcNames, types.NamespacedName{Namespace: pod.GetNamespace(), Name: svcName})
+				break
+			}
+		}
+	}
+	return svcNames
+}
+
+func (w *serviceWatcher) setServices(owner types.NamespacedName, svcNames []types.NamespacedName) {
 	w.Lock()
 	defer w.Unlock()
-	w.ingressToService[ingName] = svcName
+	svcs := make(map[types.NamespacedName]struct{}, len(svcNames))
+	for _, svcName := range svcNames {
+		svcs[svcName] = struct{}{}
+	}
+	w.ownerToServices[owner] = svcs
 }
 
-func (w *serviceWatcher) removeIngress(ingName types.NamespacedName) {
+func (w *serviceWatcher) remove(owner types.NamespacedName) {
 	w.Lock()
 	defer w.Unlock()
-	delete(w.ingressToService, ingName)
+	delete(w.ownerToServices, owner)
 }
 
 func hasIngressClass(obj client.Object, ingressClassName string) bool {
@@ -61,6 +182,7 @@ func (r *reconcileIngress) Watch(c controller.Controller) error {
 		&handler.EnqueueRequestForObject{}, predicate.NewPredicateFuncs(func(obj client.Object) bool {
 			return hasIngressClass(obj, r.cfg.IngressClassName)
 		}),
+		predicate.Funcs{UpdateFunc: metadataChanged},
 	)
 	if err != nil {
 		return errors.Wrap(err, "unable to watch Ingress")
@@ -71,9 +193,14 @@ func (r *reconcileIngress) Watch(c controller.Controller) error {
 		return errors.Wrap(err, "unable to watch Service")
 	}
 
-	err = c.Watch(&source.Kind{Type: &corev1.Endpoints{}}, handler.EnqueueRequestsFromMapFunc(r.serviceWatcher.mapFunc))
+	err = c.Watch(&source.Kind{Type: &discoveryv1.EndpointSlice{}}, handler.EnqueueRequestsFromMapFunc(r.serviceWatcher.endpointSliceMapFunc))
+	if err != nil {
+		return errors.Wrap(err, "unable to watch EndpointSlice")
+	}
+
+	err = c.Watch(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(r.serviceWatcher.podMapFunc(r.client)), predicate.Funcs{UpdateFunc: metadataChanged})
 	if err != nil {
-		return errors.Wrap(err, "unable to watch Endpoints")
+		return errors.Wrap(err, "unable to watch Pod")
 	}
 	return nil
 }
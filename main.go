@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -19,6 +20,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	"sigs.k8s.io/controller-runtime/pkg/manager"
 	"sigs.k8s.io/controller-runtime/pkg/manager/signals"
+	gatewayv1alpha1 "sigs.k8s.io/gateway-api/apis/v1alpha1"
 )
 
 var (
@@ -59,6 +61,13 @@ func run() error {
 		return errors.Wrap(err, "unable to read config")
 	}
 
+	if cfg.EnableGatewayAPI {
+		err = gatewayv1alpha1.AddToScheme(scheme.Scheme)
+		if err != nil {
+			return errors.Wrap(err, "unable to register gateway api types")
+		}
+	}
+
 	mgrOpts, err := manager.Options{
 		Scheme:                     scheme.Scheme,
 		LeaderElectionID:           ingConfig.IngressControllerName,
@@ -75,11 +84,22 @@ func run() error {
 	mgr.AddHealthzCheck("ping", healthz.Ping)
 	mgr.AddReadyzCheck("ping", healthz.Ping)
 
+	err = ingController.SetupIndexes(context.Background(), mgr.GetFieldIndexer())
+	if err != nil {
+		return errors.Wrap(err, "unable to set up field indexes")
+	}
+
+	networkAPI, err := ingController.NewNetworkAPI(cfg)
+	if err != nil {
+		return errors.Wrap(err, "unable to set up networkapi client")
+	}
+
 	ingressReconciler := ingController.NewReconciler(
 		mgr.GetClient(),
 		mgr.GetEventRecorderFor(ingConfig.IngressControllerName),
 		cfg,
 	)
+	ingressReconciler.SetNetworkAPI(networkAPI)
 
 	c, err := controller.New(ingConfig.IngressControllerName, mgr, controller.Options{
 		Reconciler: ingressReconciler,
@@ -93,6 +113,55 @@ func run() error {
 		return errors.Wrap(err, "unable to watch resources")
 	}
 
+	serviceReconciler := ingController.NewServiceReconciler(
+		mgr.GetClient(),
+		mgr.GetEventRecorderFor(ingConfig.ServiceControllerName),
+		cfg,
+	)
+	serviceReconciler.SetNetworkAPI(networkAPI)
+
+	svcController, err := controller.New(ingConfig.ServiceControllerName, mgr, controller.Options{
+		Reconciler: serviceReconciler,
+	})
+	if err != nil {
+		return errors.Wrap(err, "unable to set up service controller")
+	}
+
+	err = serviceReconciler.Watch(svcController)
+	if err != nil {
+		return errors.Wrap(err, "unable to watch service resources")
+	}
+
+	if cfg.EnableGatewayAPI {
+		gatewayReconciler := ingController.NewGatewayReconciler(
+			mgr.GetClient(),
+			mgr.GetEventRecorderFor(ingConfig.GatewayControllerName),
+			cfg,
+		)
+		gatewayReconciler.SetNetworkAPI(networkAPI)
+
+		gwController, err := controller.New(ingConfig.GatewayControllerName, mgr, controller.Options{
+			Reconciler: gatewayReconciler,
+		})
+		if err != nil {
+			return errors.Wrap(err, "unable to set up gateway controller")
+		}
+
+		err = gatewayReconciler.Watch(gwController)
+		if err != nil {
+			return errors.Wrap(err, "unable to watch gateway resources")
+		}
+	}
+
+	if cfg.OrphanSweepInterval > 0 {
+		sweeper := ingController.NewSweeper(mgr.GetClient(), cfg)
+		sweeper.SetNetworkAPI(networkAPI)
+		err = mgr.Add(sweeper)
+		if err != nil {
+			return errors.Wrap(err, "unable to set up orphan sweeper")
+		}
+	}
+
 	entryLog.Info("starting manager")
 	if err := mgr.Start(signals.SetupSignalHandler()); err != nil {
 		return errors.Wrap(err, "unable to run manager")
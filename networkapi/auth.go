@@ -0,0 +1,194 @@
+package networkapi
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// Authenticator sets the credentials of the NetworkAPI requests.
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request) error
+}
+
+// BasicAuth authenticates with a username and password.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a *BasicAuth) Authenticate(ctx context.Context, req *http.Request) error {
+	if a.Username != "" && a.Password != "" {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	return nil
+}
+
+// BearerToken authenticates with a static token.
+type BearerToken struct {
+	Token string
+}
+
+func (a *BearerToken) Authenticate(ctx context.Context, req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+a.Token)
+	return nil
+}
+
+// ClientCredentials authenticates with OAuth2 tokens from the client
+// credentials flow, requesting a new token when the current one expires.
+type ClientCredentials struct {
+	tokenSource oauth2.TokenSource
+}
+
+// NewClientCredentials returns an authenticator requesting tokens with
+// httpClient, so the token endpoint shares the NetworkAPI transport options.
+func NewClientCredentials(cfg clientcredentials.Config, httpClient *http.Client) *ClientCredentials {
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+	return &ClientCredentials{tokenSource: cfg.TokenSource(ctx)}
+}
+
+func (a *ClientCredentials) Authenticate(ctx context.Context, req *http.Request) error {
+	token, err := a.tokenSource.Token()
+	if err != nil {
+		return errors.Wrap(err, "unable to get oauth2 token")
+	}
+	token.SetAuthHeader(req)
+	return nil
+}
+
+// SecretFile authenticates with the credentials of a Kubernetes Secret
+// mounted in Dir, either a token key or username and password keys. The files
+// are read again whenever they change, so rotated credentials are used
+// without restarting the controller.
+type SecretFile struct {
+	Dir string
+
+	mu      sync.Mutex
+	modTime time.Time
+	auth    Authenticator
+}
+
+func (a *SecretFile) Authenticate(ctx context.Context, req *http.Request) error {
+	auth, err := a.current()
+	if err != nil {
+		return err
+	}
+	return auth.Authenticate(ctx, req)
+}
+
+func (a *SecretFile) current() (Authenticator, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// Mounted Secrets are updated by replacing the directory the files link
+	// to, so the modification time changes on every update.
+	var modTime time.Time
+	for _, key := range []string{"token", "username", "password"} {
+		info, err := os.Stat(filepath.Join(a.Dir, key))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read credentials")
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	if a.auth != nil && modTime.Equal(a.modTime) {
+		return a.auth, nil
+	}
+
+	token, err := a.readKey("token")
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		a.auth = &BearerToken{Token: token}
+	} else {
+		basic := &BasicAuth{}
+		if basic.Username, err = a.readKey("username"); err != nil {
+			return nil, err
+		}
+		if basic.Password, err = a.readKey("password"); err != nil {
+			return nil, err
+		}
+		if basic.Username == "" || basic.Password == "" {
+			return nil, errors.Errorf("no token or username and password found in %s", a.Dir)
+		}
+		a.auth = basic
+	}
+	a.modTime = modTime
+	return a.auth, nil
+}
+
+func (a *SecretFile) readKey(key string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(a.Dir, key))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "unable to read credentials")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+const (
+	AuthTypeBasic             = "basic"
+	AuthTypeBearer            = "bearer"
+	AuthTypeClientCredentials = "oauth2"
+	AuthTypeSecretFile        = "secret-file"
+)
+
+// AuthOptions selects the authenticator of the client, basic auth by default.
+type AuthOptions struct {
+	Type     string
+	Username string
+	Password string
+	// Token is the static token for AuthTypeBearer.
+	Token string
+	// TokenURL, ClientID, ClientSecret and Scopes configure the client
+	// credentials flow for AuthTypeClientCredentials.
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// SecretDir is the mounted Secret directory for AuthTypeSecretFile.
+	SecretDir string
+}
+
+func newAuthenticator(opts AuthOptions, httpClient *http.Client) (Authenticator, error) {
+	switch opts.Type {
+	case "", AuthTypeBasic:
+		return &BasicAuth{Username: opts.Username, Password: opts.Password}, nil
+	case AuthTypeBearer:
+		if opts.Token == "" {
+			return nil, errors.New("token required for bearer authentication")
+		}
+		return &BearerToken{Token: opts.Token}, nil
+	case AuthTypeClientCredentials:
+		if opts.TokenURL == "" || opts.ClientID == "" || opts.ClientSecret == "" {
+			return nil, errors.New("token URL, client ID and client secret required for oauth2 authentication")
+		}
+		return NewClientCredentials(clientcredentials.Config{
+			ClientID:     opts.ClientID,
+			ClientSecret: opts.ClientSecret,
+			TokenURL:     opts.TokenURL,
+			Scopes:       opts.Scopes,
+		}, httpClient), nil
+	case AuthTypeSecretFile:
+		if opts.SecretDir == "" {
+			return nil, errors.New("secret directory required for secret-file authentication")
+		}
+		return &SecretFile{Dir: opts.SecretDir}, nil
+	}
+	return nil, errors.Errorf("invalid authentication type %q, must be one of %s, %s, %s, %s", opts.Type, AuthTypeBasic, AuthTypeBearer, AuthTypeClientCredentials, AuthTypeSecretFile)
+}
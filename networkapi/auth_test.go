@@ -0,0 +1,86 @@
+package networkapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func authorization(t *testing.T, auth Authenticator) string {
+	req, err := http.NewRequest(http.MethodGet, "http://networkapi.example.com", nil)
+	require.NoError(t, err)
+	require.NoError(t, auth.Authenticate(context.TODO(), req))
+	return req.Header.Get("Authorization")
+}
+
+func TestSecretFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	write := func(key, value string, modTime time.Time) {
+		name := filepath.Join(dir, key)
+		require.NoError(t, os.WriteFile(name, []byte(value), 0600))
+		require.NoError(t, os.Chtimes(name, modTime, modTime))
+	}
+	now := time.Now()
+
+	auth := &SecretFile{Dir: dir}
+	_, err := auth.current()
+	assert.Error(t, err)
+
+	write("username", "admin", now)
+	write("password", "secret\n", now)
+	assert.Equal(t, "Basic YWRtaW46c2VjcmV0", authorization(t, auth))
+
+	write("token", "token-1", now.Add(time.Second))
+	assert.Equal(t, "Bearer token-1", authorization(t, auth))
+
+	write("token", "token-2", now.Add(2*time.Second))
+	assert.Equal(t, "Bearer token-2", authorization(t, auth))
+}
+
+func TestClientCredentials(t *testing.T) {
+	var tokenRequests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		user, password, _ := r.BasicAuth()
+		assert.Equal(t, "controller", user)
+		assert.Equal(t, "secret", password)
+		assert.Equal(t, "client_credentials", r.FormValue("grant_type"))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token": "abc", "token_type": "bearer", "expires_in": 3600}`))
+	}))
+	defer srv.Close()
+
+	auth, err := newAuthenticator(AuthOptions{
+		Type:         AuthTypeClientCredentials,
+		TokenURL:     srv.URL,
+		ClientID:     "controller",
+		ClientSecret: "secret",
+	}, srv.Client())
+	require.NoError(t, err)
+
+	assert.Equal(t, "Bearer abc", authorization(t, auth))
+	assert.Equal(t, "Bearer abc", authorization(t, auth))
+	assert.Equal(t, 1, tokenRequests, "token is reused until it expires")
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	auth, err := newAuthenticator(AuthOptions{Username: "admin", Password: "secret"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Basic YWRtaW46c2VjcmV0", authorization(t, auth))
+
+	auth, err = newAuthenticator(AuthOptions{Type: AuthTypeBearer, Token: "abc"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer abc", authorization(t, auth))
+
+	_, err = newAuthenticator(AuthOptions{Type: AuthTypeBearer}, nil)
+	assert.EqualError(t, err, "token required for bearer authentication")
+	_, err = newAuthenticator(AuthOptions{Type: "kerberos"}, nil)
+	assert.EqualError(t, err, `invalid authentication type "kerberos", must be one of basic, bearer, oauth2, secret-file`)
+}
@@ -0,0 +1,343 @@
+package networkapi
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "kube_napi_ingress_networkapi_cache_requests_total",
+	Help: "Number of NetworkAPI lookups served by the cache, by kind and result.",
+}, []string{"kind", "result"})
+
+func init() {
+	metrics.Registry.MustRegister(cacheRequests)
+}
+
+type cacheEntry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// cachedNetworkAPI caches the lookups of VIPs, pools, IPs and equipments for
+// a TTL. Every create, update or delete drops the cached objects of the same
+// kind. Lists and searches of pools by member are never cached, as the
+// sweeper and the release of target IPs rely on them being up to date.
+type cachedNetworkAPI struct {
+	NetworkAPI
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	// generation changes on every invalidation, so lookups started before
+	// an invalidation do not cache stale objects.
+	generation int
+}
+
+// NewCache returns a NetworkAPI caching the lookups of cli for ttl.
+func NewCache(cli NetworkAPI, ttl time.Duration) NetworkAPI {
+	return &cachedNetworkAPI{
+		NetworkAPI: cli,
+		ttl:        ttl,
+		now:        time.Now,
+		entries:    map[string]cacheEntry{},
+	}
+}
+
+func cacheKind(key string) string {
+	return key[:strings.Index(key, "/")]
+}
+
+// get returns a copy of the cached object and the current generation.
+func (c *cachedNetworkAPI) get(key string) (interface{}, int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && c.now().After(entry.expires) {
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		cacheRequests.WithLabelValues(cacheKind(key), "miss").Inc()
+		return nil, c.generation, false
+	}
+	cacheRequests.WithLabelValues(cacheKind(key), "hit").Inc()
+	return deepCopy(entry.value), c.generation, true
+}
+
+func (c *cachedNetworkAPI) set(key string, generation int, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	c.entries[key] = cacheEntry{value: deepCopy(value), expires: c.now().Add(c.ttl)}
+}
+
+// invalidate drops the cached objects of the kinds.
+func (c *cachedNetworkAPI) invalidate(kinds ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for key := range c.entries {
+		for _, kind := range kinds {
+			if cacheKind(key) == kind {
+				delete(c.entries, key)
+			}
+		}
+	}
+}
+
+// deepCopy copies the object, including the values referenced by pointers,
+// slices and maps, as callers may change the objects returned.
+func deepCopy(v interface{}) interface{} {
+	return copyValue(reflect.ValueOf(v)).Interface()
+}
+
+func copyValue(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Elem().Type())
+		c.Elem().Set(copyValue(v.Elem()))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(copyValue(v.Field(i)))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(copyValue(v.Index(i)))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(iter.Key(), copyValue(iter.Value()))
+		}
+		return c
+	}
+	return v
+}
+
+func (c *cachedNetworkAPI) GetVIP(ctx context.Context, name string) (*VIP, error) {
+	key := "vip/name/" + name
+	cached, generation, ok := c.get(key)
+	if ok {
+		return cached.(*VIP), nil
+	}
+	vip, err := c.NetworkAPI.GetVIP(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	c.set(key, generation, vip)
+	return vip, nil
+}
+
+func (c *cachedNetworkAPI) GetPool(ctx context.Context, name string) (*Pool, error) {
+	key := "pool/name/" + name
+	cached, generation, ok := c.get(key)
+	if ok {
+		return cached.(*Pool), nil
+	}
+	pool, err := c.NetworkAPI.GetPool(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	c.set(key, generation, pool)
+	return pool, nil
+}
+
+func (c *cachedNetworkAPI) GetPoolByID(ctx context.Context, id int) (*Pool, error) {
+	key := "pool/id/" + strconv.Itoa(id)
+	cached, generation, ok := c.get(key)
+	if ok {
+		return cached.(*Pool), nil
+	}
+	pool, err := c.NetworkAPI.GetPoolByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	c.set(key, generation, pool)
+	return pool, nil
+}
+
+func (c *cachedNetworkAPI) GetIPByID(ctx context.Context, id int) (*IP, error) {
+	return c.getIP(ctx, "ipv4/id/"+strconv.Itoa(id), func() (*IP, error) {
+		return c.NetworkAPI.GetIPByID(ctx, id)
+	})
+}
+
+func (c *cachedNetworkAPI) GetIPByName(ctx context.Context, name string) (*IP, error) {
+	return c.getIP(ctx, "ipv4/name/"+name, func() (*IP, error) {
+		return c.NetworkAPI.GetIPByName(ctx, name)
+	})
+}
+
+func (c *cachedNetworkAPI) GetIPByNetIP(ctx context.Context, ip net.IP) (*IP, error) {
+	return c.getIP(ctx, "ipv4/ip/"+ip.String(), func() (*IP, error) {
+		return c.NetworkAPI.GetIPByNetIP(ctx, ip)
+	})
+}
+
+func (c *cachedNetworkAPI) getIP(ctx context.Context, key string, lookup func() (*IP, error)) (*IP, error) {
+	cached, generation, ok := c.get(key)
+	if ok {
+		return cached.(*IP), nil
+	}
+	ip, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+	c.set(key, generation, ip)
+	return ip, nil
+}
+
+func (c *cachedNetworkAPI) GetIPv6ByID(ctx context.Context, id int) (*IPv6, error) {
+	return c.getIPv6(ctx, "ipv6/id/"+strconv.Itoa(id), func() (*IPv6, error) {
+		return c.NetworkAPI.GetIPv6ByID(ctx, id)
+	})
+}
+
+func (c *cachedNetworkAPI) GetIPv6ByName(ctx context.Context, name string) (*IPv6, error) {
+	return c.getIPv6(ctx, "ipv6/name/"+name, func() (*IPv6, error) {
+		return c.NetworkAPI.GetIPv6ByName(ctx, name)
+	})
+}
+
+func (c *cachedNetworkAPI) GetIPv6ByNetIP(ctx context.Context, ip net.IP) (*IPv6, error) {
+	return c.getIPv6(ctx, "ipv6/ip/"+ip.String(), func() (*IPv6, error) {
+		return c.NetworkAPI.GetIPv6ByNetIP(ctx, ip)
+	})
+}
+
+func (c *cachedNetworkAPI) getIPv6(ctx context.Context, key string, lookup func() (*IPv6, error)) (*IPv6, error) {
+	cached, generation, ok := c.get(key)
+	if ok {
+		return cached.(*IPv6), nil
+	}
+	ip, err := lookup()
+	if err != nil {
+		return nil, err
+	}
+	c.set(key, generation, ip)
+	return ip, nil
+}
+
+func (c *cachedNetworkAPI) GetEquipment(ctx context.Context, name string) (*Equipment, error) {
+	key := "equipment/name/" + name
+	cached, generation, ok := c.get(key)
+	if ok {
+		return cached.(*Equipment), nil
+	}
+	equip, err := c.NetworkAPI.GetEquipment(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	c.set(key, generation, equip)
+	return equip, nil
+}
+
+func (c *cachedNetworkAPI) CreateVIP(ctx context.Context, vip *VIP) (*VIP, error) {
+	defer c.invalidate("vip")
+	return c.NetworkAPI.CreateVIP(ctx, vip)
+}
+
+func (c *cachedNetworkAPI) UpdateVIP(ctx context.Context, vip *VIP) (*VIP, error) {
+	defer c.invalidate("vip")
+	return c.NetworkAPI.UpdateVIP(ctx, vip)
+}
+
+// DeployVIP also creates the pools of the VIP in the load balancer.
+func (c *cachedNetworkAPI) DeployVIP(ctx context.Context, vipID int) error {
+	defer c.invalidate("vip", "pool")
+	return c.NetworkAPI.DeployVIP(ctx, vipID)
+}
+
+func (c *cachedNetworkAPI) DeleteVIP(ctx context.Context, vip *VIP) error {
+	defer c.invalidate("vip")
+	return c.NetworkAPI.DeleteVIP(ctx, vip)
+}
+
+func (c *cachedNetworkAPI) CreatePool(ctx context.Context, pool *Pool) (*Pool, error) {
+	defer c.invalidate("pool")
+	return c.NetworkAPI.CreatePool(ctx, pool)
+}
+
+func (c *cachedNetworkAPI) UpdatePool(ctx context.Context, pool *Pool) (*Pool, error) {
+	defer c.invalidate("pool")
+	return c.NetworkAPI.UpdatePool(ctx, pool)
+}
+
+func (c *cachedNetworkAPI) DeletePool(ctx context.Context, id int) error {
+	defer c.invalidate("pool")
+	return c.NetworkAPI.DeletePool(ctx, id)
+}
+
+func (c *cachedNetworkAPI) CreateVIPIPv4(ctx context.Context, name string, vipEnvironmentID int) (*IP, error) {
+	defer c.invalidate("ipv4")
+	return c.NetworkAPI.CreateVIPIPv4(ctx, name, vipEnvironmentID)
+}
+
+func (c *cachedNetworkAPI) CreateIP(ctx context.Context, ip *IP) (*IP, error) {
+	defer c.invalidate("ipv4")
+	return c.NetworkAPI.CreateIP(ctx, ip)
+}
+
+func (c *cachedNetworkAPI) DeleteIP(ctx context.Context, id int) error {
+	defer c.invalidate("ipv4")
+	return c.NetworkAPI.DeleteIP(ctx, id)
+}
+
+func (c *cachedNetworkAPI) CreateVIPIPv6(ctx context.Context, name string, vipEnvironmentID int) (*IPv6, error) {
+	defer c.invalidate("ipv6")
+	return c.NetworkAPI.CreateVIPIPv6(ctx, name, vipEnvironmentID)
+}
+
+func (c *cachedNetworkAPI) CreateIPv6(ctx context.Context, ip *IPv6) (*IPv6, error) {
+	defer c.invalidate("ipv6")
+	return c.NetworkAPI.CreateIPv6(ctx, ip)
+}
+
+func (c *cachedNetworkAPI) DeleteIPv6(ctx context.Context, id int) error {
+	defer c.invalidate("ipv6")
+	return c.NetworkAPI.DeleteIPv6(ctx, id)
+}
+
+func (c *cachedNetworkAPI) CreateEquipment(ctx context.Context, equip *Equipment) (*Equipment, error) {
+	defer c.invalidate("equipment")
+	return c.NetworkAPI.CreateEquipment(ctx, equip)
+}
+
+// DeleteEquipment also drops the IPs, as they reference their equipments.
+func (c *cachedNetworkAPI) DeleteEquipment(ctx context.Context, id int) error {
+	defer c.invalidate("equipment", "ipv4", "ipv6")
+	return c.NetworkAPI.DeleteEquipment(ctx, id)
+}
@@ -0,0 +1,71 @@
+package networkapi
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingNetworkAPI struct {
+	*FakeNetworkAPI
+	poolLookups int
+}
+
+func (c *countingNetworkAPI) GetPool(ctx context.Context, name string) (*Pool, error) {
+	c.poolLookups++
+	return c.FakeNetworkAPI.GetPool(ctx, name)
+}
+
+func TestCache(t *testing.T) {
+	fake := &countingNetworkAPI{FakeNetworkAPI: &FakeNetworkAPI{
+		Pools: map[string]Pool{
+			"pool-1": {ID: 1, Identifier: "pool-1", Members: []PoolMember{{ID: 10, PortReal: 8080}}},
+		},
+	}}
+	now := time.Now()
+	cache := NewCache(fake, time.Minute).(*cachedNetworkAPI)
+	cache.now = func() time.Time { return now }
+	ctx := context.TODO()
+
+	pool, err := cache.GetPool(ctx, "pool-1")
+	require.NoError(t, err)
+	pool.Members[0].PortReal = 9090
+
+	pool, err = cache.GetPool(ctx, "pool-1")
+	require.NoError(t, err)
+	assert.Equal(t, 8080, pool.Members[0].PortReal, "changes to returned objects are not cached")
+	assert.Equal(t, 1, fake.poolLookups)
+
+	_, err = cache.UpdatePool(ctx, &Pool{ID: 1, Identifier: "pool-1"})
+	require.NoError(t, err)
+	pool, err = cache.GetPool(ctx, "pool-1")
+	require.NoError(t, err)
+	assert.Empty(t, pool.Members)
+	assert.Equal(t, 2, fake.poolLookups, "updates drop the cached pools")
+
+	now = now.Add(2 * time.Minute)
+	_, err = cache.GetPool(ctx, "pool-1")
+	require.NoError(t, err)
+	assert.Equal(t, 3, fake.poolLookups, "expired pools are looked up again")
+
+	for i := 0; i < 2; i++ {
+		_, err = cache.GetPool(ctx, "pool-2")
+		assert.True(t, IsNotFound(err))
+	}
+	assert.Equal(t, 5, fake.poolLookups, "missing pools are not cached")
+}
+
+func TestCacheDiscardsLookupsRacingInvalidation(t *testing.T) {
+	cache := NewCache(&FakeNetworkAPI{}, time.Minute).(*cachedNetworkAPI)
+
+	_, generation, ok := cache.get("vip/name/vip-1")
+	require.False(t, ok)
+	cache.invalidate("vip")
+	cache.set("vip/name/vip-1", generation, &VIP{ID: 1})
+
+	_, _, ok = cache.get("vip/name/vip-1")
+	assert.False(t, ok)
+}
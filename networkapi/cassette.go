@@ -0,0 +1,255 @@
+package networkapi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const redacted = "REDACTED"
+
+// sensitiveFields are the JSON and form fields redacted from the recordings.
+var sensitiveFields = map[string]bool{
+	"password":      true,
+	"client_secret": true,
+	"access_token":  true,
+	"refresh_token": true,
+	"id_token":      true,
+	"token":         true,
+}
+
+// cassette holds recorded NetworkAPI requests and their responses. Cassette
+// files have one JSON encoded interaction per line. Request headers are not
+// recorded, so credentials sent in them never reach the cassette file.
+type cassette struct {
+	Interactions []interaction
+}
+
+type interaction struct {
+	Method string `json:"method"`
+	// URL is the request path and query, so recordings can be replayed
+	// against any host.
+	URL          string `json:"url"`
+	RequestBody  string `json:"request_body,omitempty"`
+	StatusCode   int    `json:"status_code,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	ResponseBody string `json:"response_body,omitempty"`
+	// Error is the transport error of requests without a response.
+	Error string `json:"error,omitempty"`
+}
+
+func (i *interaction) matches(method, u, body string) bool {
+	return i.Method == method && i.URL == u && i.RequestBody == body
+}
+
+func loadCassette(path string) (*cassette, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read cassette")
+	}
+	defer f.Close()
+
+	var c cassette
+	reader := bufio.NewReader(f)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var entry interaction
+			if jsonErr := json.Unmarshal(line, &entry); jsonErr != nil {
+				return nil, errors.Wrapf(jsonErr, "unable to unmarshal cassette %s line %d", path, lineNumber)
+			}
+			c.Interactions = append(c.Interactions, entry)
+		}
+		if err == io.EOF {
+			return &c, nil
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read cassette")
+		}
+	}
+}
+
+func readRequestBody(req *http.Request) (string, error) {
+	if req.Body == nil {
+		return "", nil
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return "", err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return string(data), nil
+}
+
+// redact replaces the values of sensitive fields of JSON and form encoded
+// bodies.
+func redact(body string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err == nil {
+		if redactJSON(v) {
+			data, err := json.Marshal(v)
+			if err == nil {
+				return string(data)
+			}
+		}
+		return body
+	}
+	if values, err := url.ParseQuery(body); err == nil && strings.Contains(body, "=") {
+		changed := false
+		for key := range values {
+			if sensitiveFields[strings.ToLower(key)] {
+				values.Set(key, redacted)
+				changed = true
+			}
+		}
+		if changed {
+			return values.Encode()
+		}
+	}
+	return body
+}
+
+func redactJSON(v interface{}) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if sensitiveFields[strings.ToLower(key)] {
+				v[key] = redacted
+				changed = true
+				continue
+			}
+			changed = redactJSON(value) || changed
+		}
+	case []interface{}:
+		for _, value := range v {
+			changed = redactJSON(value) || changed
+		}
+	}
+	return changed
+}
+
+// recordTransport records every request and its response to a cassette
+// file, appending one line for each request.
+type recordTransport struct {
+	next http.RoundTripper
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newRecordTransport creates the cassette file, truncating it if it exists.
+func newRecordTransport(next http.RoundTripper, path string) (*recordTransport, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create cassette")
+	}
+	return &recordTransport{next: next, file: f}, nil
+}
+
+func (t *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	entry := interaction{
+		Method:      req.Method,
+		URL:         req.URL.RequestURI(),
+		RequestBody: redact(reqBody),
+	}
+
+	resp, rtErr := t.next.RoundTrip(req)
+	if rtErr != nil {
+		entry.Error = rtErr.Error()
+	} else {
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+		entry.StatusCode = resp.StatusCode
+		entry.ContentType = resp.Header.Get("Content-Type")
+		entry.ResponseBody = redact(string(data))
+	}
+
+	line, err := json.Marshal(entry)
+	if err == nil {
+		t.mu.Lock()
+		_, err = t.file.Write(append(line, '\n'))
+		t.mu.Unlock()
+	}
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, errors.Wrap(err, "unable to write cassette")
+	}
+	return resp, rtErr
+}
+
+// replayTransport answers requests with the responses recorded in a
+// cassette. Each recording is used once, in the order recorded for the
+// same method, URL and body, so repeated lookups get the responses of the
+// recorded run. Requests without recordings left fail.
+type replayTransport struct {
+	mu       sync.Mutex
+	cassette *cassette
+	used     []bool
+}
+
+func newReplayTransport(path string) (*replayTransport, error) {
+	c, err := loadCassette(path)
+	if err != nil {
+		return nil, err
+	}
+	return &replayTransport{cassette: c, used: make([]bool, len(c.Interactions))}, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	u := req.URL.RequestURI()
+	reqBody = redact(reqBody)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.cassette.Interactions {
+		entry := &t.cassette.Interactions[i]
+		if t.used[i] || !entry.matches(req.Method, u, reqBody) {
+			continue
+		}
+		t.used[i] = true
+		if entry.Error != "" {
+			return nil, errors.New(entry.Error)
+		}
+		header := http.Header{}
+		if entry.ContentType != "" {
+			header.Set("Content-Type", entry.ContentType)
+		}
+		return &http.Response{
+			Status:        http.StatusText(entry.StatusCode),
+			StatusCode:    entry.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          ioutil.NopCloser(strings.NewReader(entry.ResponseBody)),
+			ContentLength: int64(len(entry.ResponseBody)),
+			Request:       req,
+		}, nil
+	}
+	return nil, errors.Errorf("no recorded response left for %s %s with body %q", req.Method, u, reqBody)
+}
@@ -0,0 +1,79 @@
+package networkapi
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.TODO()
+	sim := NewSimulator()
+	srv := httptest.NewServer(sim)
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "cassette.jsonl")
+
+	cli, err := Client(ClientOptions{
+		BaseURL:   srv.URL,
+		Auth:      AuthOptions{Username: "admin", Password: "s3cr3t"},
+		Transport: TransportOptions{RecordFile: path},
+	})
+	require.NoError(t, err)
+
+	_, err = cli.GetEquipment(ctx, "eq")
+	require.True(t, IsNotFound(err))
+	created, err := cli.CreateEquipment(ctx, &Equipment{Name: "eq"})
+	require.NoError(t, err)
+	vipIP, err := cli.CreateVIPIPv4(ctx, "vip", 12)
+	require.NoError(t, err)
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "s3cr3t")
+	assert.Equal(t, 5, strings.Count(string(data), "\n"), "one line for each request")
+	c, err := loadCassette(path)
+	require.NoError(t, err)
+	assert.Len(t, c.Interactions, 5)
+
+	srv.Close()
+	replay, err := Client(ClientOptions{
+		BaseURL:   "http://networkapi.invalid",
+		Transport: TransportOptions{ReplayFile: path},
+	})
+	require.NoError(t, err)
+
+	_, err = replay.GetEquipment(ctx, "eq")
+	require.True(t, IsNotFound(err))
+	replayed, err := replay.CreateEquipment(ctx, &Equipment{Name: "eq"})
+	require.NoError(t, err)
+	assert.Equal(t, created, replayed)
+	replayedIP, err := replay.CreateVIPIPv4(ctx, "vip", 12)
+	require.NoError(t, err)
+	assert.Equal(t, vipIP, replayedIP)
+
+	_, err = replay.CreateEquipment(ctx, &Equipment{Name: "other"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no recorded response left for POST /api/v3/equipment/")
+}
+
+func TestRecordReplayFilesExclusive(t *testing.T) {
+	_, err := newHTTPClient(TransportOptions{RecordFile: "a.jsonl", ReplayFile: "b.jsonl"})
+	assert.EqualError(t, err, "record and replay files cannot be set together")
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, `{"access_token":"REDACTED","expires_in":3600,"token_type":"Bearer"}`,
+		redact(`{"access_token": "abc", "token_type": "Bearer", "expires_in": 3600}`))
+	assert.Equal(t, `[{"users":[{"name":"admin","password":"REDACTED"}]}]`,
+		redact(`[{"users": [{"name": "admin", "password": "s3cr3t"}]}]`))
+	assert.Equal(t, "client_secret=REDACTED&grant_type=client_credentials",
+		redact("grant_type=client_credentials&client_secret=s3cr3t"))
+	assert.Equal(t, `{"vips": []}`, redact(`{"vips": []}`))
+	assert.Equal(t, "<networkapi/>", redact("<networkapi/>"))
+}
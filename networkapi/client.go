@@ -8,23 +8,77 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
-func getClient() *http.Client {
-	return http.DefaultClient
+// defaultBackoff is used to retry GET requests failing with server or
+// connection errors, and requests throttled by NetworkAPI.
+var defaultBackoff = wait.Backoff{
+	Duration: 100 * time.Millisecond,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    3,
 }
 
+// maxRetryAfter is the longest Retry-After delay waited for before retrying a
+// throttled request, longer delays are left to the reconcile requeue.
+const maxRetryAfter = 30 * time.Second
+
 type baseClient struct {
-	baseURL  string
-	username string
-	password string
+	baseURL    string
+	auth       Authenticator
+	httpClient *http.Client
+	backoff    wait.Backoff
+	limiter    *limiter
+}
+
+func (c *baseClient) getClient() *http.Client {
+	if c.httpClient == nil {
+		return http.DefaultClient
+	}
+	return c.httpClient
 }
 
+// doRequest sends the request to NetworkAPI, retrying GET requests with
+// temporary errors while the backoff has steps left. Throttled requests are
+// retried for every method, as NetworkAPI did not process them, waiting at
+// least the Retry-After delay.
 func (c *baseClient) doRequest(ctx context.Context, method string, u string, qs url.Values, bodyData []byte) ([]byte, error) {
+	backoff := c.backoff
+	for {
+		rspData, err := c.doRequestOnce(ctx, method, u, qs, bodyData)
+		if err == nil || !IsTemporary(err) || backoff.Steps < 1 {
+			return rspData, err
+		}
+		var apiErr *Error
+		throttled := errors.As(err, &apiErr) && apiErr.Kind == ErrorKindThrottled
+		if method != http.MethodGet && !throttled {
+			return rspData, err
+		}
+		if throttled && apiErr.RetryAfter > maxRetryAfter {
+			return rspData, err
+		}
+
+		delay := backoff.Step()
+		if throttled && apiErr.RetryAfter > delay {
+			delay = apiErr.RetryAfter
+		}
+		log.FromContext(ctx).V(1).Info("Retrying NetworkAPI request", "method", method, "url", u, "delay", delay, "error", err.Error())
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *baseClient) doRequestOnce(ctx context.Context, method string, u string, qs url.Values, bodyData []byte) ([]byte, error) {
 	logger := log.FromContext(ctx).WithValues("method", method)
 	var body io.Reader
 	if bodyData != nil {
@@ -44,29 +98,60 @@ func (c *baseClient) doRequest(ctx context.Context, method string, u string, qs
 		return nil, err
 	}
 	req = req.WithContext(ctx)
-	if c.username != "" && c.password != "" {
-		req.SetBasicAuth(c.username, c.password)
+	if c.auth != nil {
+		if err = c.auth.Authenticate(ctx, req); err != nil {
+			return nil, err
+		}
 	}
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
-	resp, err := getClient().Do(req)
+	release, err := c.limiter.acquire(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to request %s %s", method, fullURL)
+	}
+	defer release()
+
+	start := time.Now()
+	status := "error"
+	defer func() {
+		requestDuration.WithLabelValues(method, metricsEndpoint(u), status).Observe(time.Since(start).Seconds())
+	}()
+
+	apiErr := &Error{
+		Method:      method,
+		URL:         fullURL,
+		RequestBody: string(bodyData),
+	}
+
+	resp, err := c.getClient().Do(req)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to request %s %s with body %s", method, fullURL, string(bodyData))
+		apiErr.Kind = ErrorKindNetwork
+		apiErr.Err = err
+		return nil, apiErr
 	}
 	defer resp.Body.Close()
 
 	rspData, err := ioutil.ReadAll(resp.Body)
+	status = strconv.Itoa(resp.StatusCode)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to read response %d for %s %s with body %s", resp.StatusCode, method, fullURL, string(bodyData))
+		apiErr.Kind = ErrorKindNetwork
+		apiErr.Err = errors.Wrapf(err, "unable to read response %d", resp.StatusCode)
+		return nil, apiErr
 	}
 
 	logger = logger.WithValues("status", resp.StatusCode, "response_body", string(rspData))
 	logger.V(2).Info("NetworkAPI response")
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
-		return nil, errors.Errorf("invalid response %d for %s %s with body %s: %s", resp.StatusCode, method, fullURL, string(bodyData), string(rspData))
+		apiErr.Kind = errorKindForStatus(method, "/"+strings.TrimPrefix(u, "/"), resp.StatusCode)
+		apiErr.StatusCode = resp.StatusCode
+		apiErr.Body = string(rspData)
+		if apiErr.Kind == ErrorKindThrottled {
+			apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return nil, apiErr
 	}
 
 	return rspData, nil
@@ -0,0 +1,204 @@
+package networkapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func testClient(url string) *baseClient {
+	return &baseClient{
+		baseURL: url,
+		backoff: wait.Backoff{Duration: time.Millisecond, Factor: 2, Steps: 3},
+	}
+}
+
+func TestDoRequestRetriesTemporaryErrors(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"vips": []}`))
+	}))
+	defer srv.Close()
+
+	data, err := testClient(srv.URL).doRequest(context.TODO(), http.MethodGet, "/api/v3/vip-request/", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, `{"vips": []}`, string(data))
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	_, err = testClient(srv.URL).doRequest(context.TODO(), http.MethodPost, "/api/v3/vip-request/", nil, []byte(`{}`))
+	require.Error(t, err)
+	assert.True(t, IsServerError(err))
+	assert.Equal(t, 1, calls, "only GET requests are retried")
+}
+
+func TestDoRequestRetriesThrottledRequests(t *testing.T) {
+	var calls int
+	retryAfter := "1"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 2 {
+			w.Header().Set("Retry-After", retryAfter)
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"ids": [1]}`))
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	data, err := testClient(srv.URL).doRequest(context.TODO(), http.MethodPost, "/api/v3/pool/", nil, []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, `{"ids": [1]}`, string(data))
+	assert.Equal(t, 2, calls, "throttled requests are retried for every method")
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(time.Second), "the Retry-After delay is honoured")
+
+	calls = 0
+	retryAfter = "3600"
+	_, err = testClient(srv.URL).doRequest(context.TODO(), http.MethodGet, "/api/v3/pool/", nil, nil)
+	require.Error(t, err)
+	assert.True(t, IsThrottled(err))
+	assert.True(t, IsTemporary(err))
+	assert.Equal(t, time.Hour, err.(*Error).RetryAfter)
+	assert.Equal(t, 1, calls, "long Retry-After delays are not waited for")
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2021, 8, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, 2*time.Minute, parseRetryAfter("Sun, 01 Aug 2021 10:02:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("Sun, 01 Aug 2021 09:00:00 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+}
+
+func TestDoRequestErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v3/pool/1/", "/api/v3/removed/", "/api/v3/pool/4/":
+			w.WriteHeader(http.StatusNotFound)
+		case "/api/v3/pool/2/":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		w.Write([]byte(`{"detail": "invalid pool"}`))
+	}))
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+	_, err := c.doRequest(context.TODO(), http.MethodGet, "/api/v3/pool/1/", nil, nil)
+	assert.True(t, IsNotFound(err))
+	_, err = c.doRequest(context.TODO(), http.MethodDelete, "/api/v3/pool/2/", nil, nil)
+	assert.True(t, IsConflict(err))
+	_, err = c.doRequest(context.TODO(), http.MethodGet, "/api/v3/removed/", nil, nil)
+	assert.False(t, IsNotFound(err), "404 on an unexpected path is not a missing object")
+	assert.Equal(t, ErrorKindOther, KindOf(err))
+	_, err = c.doRequest(context.TODO(), http.MethodPut, "/api/v3/pool/4/", nil, []byte(`{}`))
+	assert.False(t, IsNotFound(err), "404 on an update is not a missing object")
+	_, err = c.doRequest(context.TODO(), http.MethodPut, "/api/v3/pool/3/", nil, []byte(`{}`))
+	require.True(t, IsValidation(err))
+	assert.False(t, IsTemporary(err))
+
+	apiErr := err.(*Error)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, `{"detail": "invalid pool"}`, apiErr.Body)
+	assert.Equal(t, `invalid response 400 for PUT `+srv.URL+`/api/v3/pool/3/: {"detail": "invalid pool"}`, err.Error())
+	assert.Equal(t, "{}", apiErr.RequestBody)
+
+	srv.Close()
+	_, err = c.doRequest(context.TODO(), http.MethodGet, "/api/v3/pool/1/", nil, nil)
+	assert.True(t, IsNetworkError(err))
+	assert.True(t, IsTemporary(err))
+}
+
+func TestDoRequestLimits(t *testing.T) {
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	c := testClient(srv.URL)
+	c.limiter = newLimiter(0, 0, 2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.doRequest(context.TODO(), http.MethodGet, "/api/v3/vip-request/", nil, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), maxInFlight)
+
+	c.limiter = newLimiter(20, 1, 0)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		_, err := c.doRequest(context.TODO(), http.MethodGet, "/api/v3/vip-request/", nil, nil)
+		require.NoError(t, err)
+	}
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond), "requests after the burst wait for the rate limit")
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	cancel()
+	_, err := c.doRequest(ctx, http.MethodGet, "/api/v3/vip-request/", nil, nil)
+	assert.Error(t, err)
+}
+
+func TestListSearchFields(t *testing.T) {
+	searches := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		searches[r.URL.Path] = r.URL.Query().Get("search")
+		w.Write([]byte(`{"vips": [], "server_pools": [], "ips": [], "equipments": []}`))
+	}))
+	defer srv.Close()
+
+	ctx := context.TODO()
+	cli := &networkAPI{baseClient: *testClient(srv.URL)}
+	_, err := cli.ListVIPs(ctx, "prefix_")
+	require.NoError(t, err)
+	_, err = cli.ListPools(ctx, "prefix_")
+	require.NoError(t, err)
+	_, err = cli.ListIPs(ctx, "prefix_")
+	require.NoError(t, err)
+	_, err = cli.ListIPv6s(ctx, "prefix_")
+	require.NoError(t, err)
+	_, err = cli.ListEquipments(ctx, "prefix_")
+	require.NoError(t, err)
+
+	search := func(field string) string {
+		return `{"end_record":100,"extends_search":[{"` + field + `__startswith":"prefix_"}],"start_record":0}`
+	}
+	assert.Equal(t, map[string]string{
+		"/api/v3/vip-request/": search("name"),
+		"/api/v3/pool/":        search("identifier"),
+		"/api/v3/ipv4/":        search("descricao"),
+		"/api/v3/ipv6/":        search("description"),
+		"/api/v3/equipment/":   search("name"),
+	}, searches)
+}
@@ -0,0 +1,151 @@
+package networkapi
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorKind classifies the errors returned by the NetworkAPI client.
+type ErrorKind string
+
+const (
+	ErrorKindNotFound   ErrorKind = "not_found"
+	ErrorKindConflict   ErrorKind = "conflict"
+	ErrorKindValidation ErrorKind = "validation"
+	ErrorKindServer     ErrorKind = "server"
+	ErrorKindThrottled  ErrorKind = "throttled"
+	ErrorKindNetwork    ErrorKind = "network"
+	ErrorKindOther      ErrorKind = "other"
+)
+
+var errNotFound = &Error{Kind: ErrorKindNotFound}
+
+// Error is a failed NetworkAPI request, or a search with no results for
+// ErrorKindNotFound errors without a StatusCode.
+type Error struct {
+	Kind       ErrorKind
+	StatusCode int
+	Method     string
+	URL        string
+	// RequestBody is the body sent to NetworkAPI. It is left out of the error
+	// message, which ends up in events and annotations, and is only logged.
+	RequestBody string
+	// Body is the response body, with the NetworkAPI error message.
+	Body string
+	// Err is the connection error for ErrorKindNetwork errors.
+	Err error
+	// RetryAfter is the delay asked by the Retry-After header of
+	// ErrorKindThrottled errors, zero when not sent.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("unable to request %s %s: %v", e.Method, e.URL, e.Err)
+	case e.StatusCode != 0 && e.URL == "":
+		return fmt.Sprintf("networkapi error %d: %s", e.StatusCode, e.Body)
+	case e.StatusCode != 0:
+		return fmt.Sprintf("invalid response %d for %s %s: %s", e.StatusCode, e.Method, e.URL, e.Body)
+	}
+	return "not found"
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether the request may succeed if retried.
+func (e *Error) Temporary() bool {
+	return e.Kind == ErrorKindServer || e.Kind == ErrorKindNetwork || e.Kind == ErrorKindThrottled
+}
+
+// objectPath matches the paths of a single NetworkAPI object by ID.
+var objectPath = regexp.MustCompile(`^/api/v3/[a-z0-9-]+/(deploy/)?[0-9]+/$`)
+
+// errorKindForStatus classifies the response status of the request. A 404 is
+// only a missing object for GET and DELETE requests of an object by ID, as
+// other 404s may come from a wrong URL or a proxy.
+func errorKindForStatus(method, u string, statusCode int) ErrorKind {
+	switch {
+	case statusCode == http.StatusNotFound:
+		if (method == http.MethodGet || method == http.MethodDelete) && objectPath.MatchString(u) {
+			return ErrorKindNotFound
+		}
+		return ErrorKindOther
+	case statusCode == http.StatusConflict:
+		return ErrorKindConflict
+	case statusCode == http.StatusBadRequest || statusCode == http.StatusUnprocessableEntity:
+		return ErrorKindValidation
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorKindThrottled
+	case statusCode >= 500:
+		return ErrorKindServer
+	}
+	return ErrorKindOther
+}
+
+// KindOf returns the kind of the NetworkAPI error wrapped by err, or an empty
+// kind for other errors.
+func KindOf(err error) ErrorKind {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Kind
+	}
+	return ""
+}
+
+func IsNotFound(err error) bool {
+	return KindOf(err) == ErrorKindNotFound
+}
+
+func IsConflict(err error) bool {
+	return KindOf(err) == ErrorKindConflict
+}
+
+func IsValidation(err error) bool {
+	return KindOf(err) == ErrorKindValidation
+}
+
+func IsServerError(err error) bool {
+	return KindOf(err) == ErrorKindServer
+}
+
+func IsNetworkError(err error) bool {
+	return KindOf(err) == ErrorKindNetwork
+}
+
+func IsThrottled(err error) bool {
+	return KindOf(err) == ErrorKindThrottled
+}
+
+// IsTemporary reports whether err is a NetworkAPI error that may not happen
+// again, such as server, connection and throttling errors.
+func IsTemporary(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Temporary()
+}
+
+// parseRetryAfter returns the delay of a Retry-After header, given in seconds
+// or as an HTTP date, or zero when it is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	date, err := http.ParseTime(value)
+	if err != nil || !date.After(now) {
+		return 0
+	}
+	return date.Sub(now)
+}
@@ -2,134 +2,740 @@ package networkapi
 
 import (
 	"context"
+	"fmt"
 	"net"
-
-	"github.com/pkg/errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
 )
 
 var _ NetworkAPI = &FakeNetworkAPI{}
 
+// FakeNetworkAPI is an in-memory NetworkAPI for tests. Like NetworkAPI, it
+// allocates the object IDs, rejects duplicated names and addresses, refuses
+// to remove objects still referenced by others, and tracks the VIPs and pools
+// created in the load balancer by deploys. The maps may be filled by tests
+// to set up existing objects, which are not validated.
 type FakeNetworkAPI struct {
 	Pools      map[string]Pool
 	IPsByID    map[int]IP
+	IPv6sByID  map[int]IPv6
 	VIPs       map[string]VIP
 	Equipments map[string]Equipment
 
-	VIPUpdates []VIP
-	VIPDeploys []int
+	// Calls is the log of the calls made, as the method name followed by
+	// the name or ID of the object.
+	Calls []string
+
+	VIPUpdates       []VIP
+	VIPDeploys       []int
+	VIPDeletes       []int
+	PoolUpdates      []Pool
+	PoolDeletes      []int
+	IPDeletes        []int
+	IPv6Deletes      []int
+	EquipmentDeletes []int
+
+	mu     sync.Mutex
+	lastID int
 }
 
-func (f *FakeNetworkAPI) GetVIP(ctx context.Context, name string) (*VIP, error) {
-	if f.VIPs == nil {
-		return nil, errNotFound
+func fakeError(kind ErrorKind, format string, args ...interface{}) error {
+	statusCode := map[ErrorKind]int{
+		ErrorKindNotFound:   http.StatusNotFound,
+		ErrorKindConflict:   http.StatusConflict,
+		ErrorKindValidation: http.StatusBadRequest,
+	}[kind]
+	return &Error{Kind: kind, StatusCode: statusCode, Body: fmt.Sprintf(format, args...)}
+}
+
+func (f *FakeNetworkAPI) call(method string, object interface{}) {
+	f.Calls = append(f.Calls, fmt.Sprintf("%s %v", method, object))
+}
+
+// nextID returns an ID not used by any object in the fake, nor returned
+// before.
+func (f *FakeNetworkAPI) nextID() int {
+	max := f.lastID
+	track := func(id int) {
+		if id > max {
+			max = id
+		}
+	}
+	for _, vip := range f.VIPs {
+		track(vip.ID)
+		for _, port := range vip.Ports {
+			track(port.ID)
+			for _, pool := range port.Pools {
+				track(pool.ID)
+			}
+		}
+	}
+	for _, pool := range f.Pools {
+		track(pool.ID)
+		for _, m := range pool.Members {
+			track(m.ID)
+		}
+	}
+	for id := range f.IPsByID {
+		track(id)
+	}
+	for id := range f.IPv6sByID {
+		track(id)
+	}
+	for _, equipment := range f.Equipments {
+		track(equipment.ID)
+	}
+	f.lastID = max + 1
+	return f.lastID
+}
+
+func (f *FakeNetworkAPI) vipByID(id int) (VIP, bool) {
+	for _, vip := range f.VIPs {
+		if vip.ID == id {
+			return vip, true
+		}
+	}
+	return VIP{}, false
+}
+
+func (f *FakeNetworkAPI) poolByID(id int) (Pool, bool) {
+	for _, pool := range f.Pools {
+		if pool.ID == id {
+			return pool, true
+		}
+	}
+	return Pool{}, false
+}
+
+func (f *FakeNetworkAPI) equipmentByID(id int) (Equipment, bool) {
+	for _, equipment := range f.Equipments {
+		if equipment.ID == id {
+			return equipment, true
+		}
 	}
+	return Equipment{}, false
+}
+
+// validateVIP checks the pools and IPs referenced by the VIP exist, and
+// allocates the IDs of new ports and pool bindings.
+func (f *FakeNetworkAPI) validateVIP(vip *VIP) error {
+	if vip.IPv4 == nil && vip.IPv6 == nil {
+		return fakeError(ErrorKindValidation, "vip %s must have an ipv4 or ipv6", vip.Name)
+	}
+	if vip.IPv4 != nil {
+		if _, ok := f.IPsByID[vip.IPv4.ID]; !ok {
+			return fakeError(ErrorKindValidation, "ipv4 %d of vip %s does not exist", vip.IPv4.ID, vip.Name)
+		}
+	}
+	if vip.IPv6 != nil {
+		if _, ok := f.IPv6sByID[vip.IPv6.ID]; !ok {
+			return fakeError(ErrorKindValidation, "ipv6 %d of vip %s does not exist", vip.IPv6.ID, vip.Name)
+		}
+	}
+	for i := range vip.Ports {
+		port := &vip.Ports[i]
+		for j := range port.Pools {
+			if _, ok := f.poolByID(port.Pools[j].ServerPool.ID); !ok {
+				return fakeError(ErrorKindValidation, "pool %d of vip %s does not exist", port.Pools[j].ServerPool.ID, vip.Name)
+			}
+		}
+	}
+	for i := range vip.Ports {
+		port := &vip.Ports[i]
+		if port.ID == 0 {
+			port.ID = f.nextID()
+		}
+		for j := range port.Pools {
+			if port.Pools[j].ID == 0 {
+				port.Pools[j].ID = f.nextID()
+			}
+		}
+	}
+	return nil
+}
+
+// validatePool checks the IPs of the pool members exist, and allocates the
+// IDs of new members.
+func (f *FakeNetworkAPI) validatePool(pool *Pool) error {
+	for _, m := range pool.Members {
+		if m.IP != nil {
+			if _, ok := f.IPsByID[m.IP.ID]; !ok {
+				return fakeError(ErrorKindValidation, "ipv4 %d of pool %s does not exist", m.IP.ID, pool.Identifier)
+			}
+		}
+		if m.IPv6 != nil {
+			if _, ok := f.IPv6sByID[m.IPv6.ID]; !ok {
+				return fakeError(ErrorKindValidation, "ipv6 %d of pool %s does not exist", m.IPv6.ID, pool.Identifier)
+			}
+		}
+	}
+	for i := range pool.Members {
+		if pool.Members[i].ID == 0 {
+			pool.Members[i].ID = f.nextID()
+		}
+	}
+	return nil
+}
+
+func (f *FakeNetworkAPI) GetVIP(ctx context.Context, name string) (*VIP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	vip, ok := f.VIPs[name]
 	if !ok {
 		return nil, errNotFound
 	}
-	return &vip, nil
+	return deepCopy(&vip).(*VIP), nil
 }
 
 func (f *FakeNetworkAPI) CreateVIP(ctx context.Context, vip *VIP) (*VIP, error) {
-	return nil, errors.New("CreateVIP is not implemented yet")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("CreateVIP", vip.Name)
+
+	if _, ok := f.VIPs[vip.Name]; ok {
+		return nil, fakeError(ErrorKindConflict, "vip %s already exists", vip.Name)
+	}
+	created := deepCopy(vip).(*VIP)
+	if err := f.validateVIP(created); err != nil {
+		return nil, err
+	}
+	created.ID = f.nextID()
+	created.Created = false
+	if f.VIPs == nil {
+		f.VIPs = make(map[string]VIP)
+	}
+	f.VIPs[created.Name] = *created
+	return deepCopy(created).(*VIP), nil
 }
 
 func (f *FakeNetworkAPI) UpdateVIP(ctx context.Context, vip *VIP) (*VIP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("UpdateVIP", vip.ID)
 	f.VIPUpdates = append(f.VIPUpdates, *vip)
-	return vip, nil
+
+	existing, ok := f.vipByID(vip.ID)
+	if !ok {
+		return nil, fakeError(ErrorKindNotFound, "vip %d does not exist", vip.ID)
+	}
+	if existing.Name != vip.Name {
+		return nil, fakeError(ErrorKindValidation, "vip %d name cannot be changed", vip.ID)
+	}
+	updated := deepCopy(vip).(*VIP)
+	if err := f.validateVIP(updated); err != nil {
+		return nil, err
+	}
+	updated.Created = existing.Created
+	f.VIPs[updated.Name] = *updated
+	return deepCopy(updated).(*VIP), nil
 }
 
+// DeployVIP creates the VIP and its pools in the load balancer.
 func (f *FakeNetworkAPI) DeployVIP(ctx context.Context, vipID int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("DeployVIP", vipID)
 	f.VIPDeploys = append(f.VIPDeploys, vipID)
+
+	vip, ok := f.vipByID(vipID)
+	if !ok {
+		return fakeError(ErrorKindNotFound, "vip %d does not exist", vipID)
+	}
+	vip.Created = true
+	f.VIPs[vip.Name] = vip
+	for _, port := range vip.Ports {
+		for _, vipPool := range port.Pools {
+			if pool, ok := f.poolByID(vipPool.ServerPool.ID); ok {
+				pool.PoolCreated = true
+				f.Pools[pool.Identifier] = pool
+			}
+		}
+	}
 	return nil
 }
 
 func (f *FakeNetworkAPI) GetPool(ctx context.Context, name string) (*Pool, error) {
-	if f.Pools == nil {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pool, ok := f.Pools[name]
+	if !ok {
 		return nil, errNotFound
 	}
-	pool, ok := f.Pools[name]
+	return deepCopy(&pool).(*Pool), nil
+}
+
+func (f *FakeNetworkAPI) GetPoolByID(ctx context.Context, id int) (*Pool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pool, ok := f.poolByID(id)
 	if !ok {
 		return nil, errNotFound
 	}
+	return deepCopy(&pool).(*Pool), nil
+}
+
+func (f *FakeNetworkAPI) getPoolsByMember(memberIP func(PoolMember) *PoolMemberIP, ipID int) []Pool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var pools []Pool
+	for _, pool := range f.Pools {
+		for _, m := range pool.Members {
+			if ip := memberIP(m); ip != nil && ip.ID == ipID {
+				pools = append(pools, *deepCopy(&pool).(*Pool))
+				break
+			}
+		}
+	}
+	sort.Slice(pools, func(i, j int) bool { return pools[i].ID < pools[j].ID })
+	return pools
+}
+
+func (f *FakeNetworkAPI) GetPoolsByMemberIP(ctx context.Context, ipID int) ([]Pool, error) {
+	return f.getPoolsByMember(func(m PoolMember) *PoolMemberIP { return m.IP }, ipID), nil
+}
 
-	return &pool, nil
+func (f *FakeNetworkAPI) GetPoolsByMemberIPv6(ctx context.Context, ipID int) ([]Pool, error) {
+	return f.getPoolsByMember(func(m PoolMember) *PoolMemberIP { return m.IPv6 }, ipID), nil
 }
 
 func (f *FakeNetworkAPI) CreatePool(ctx context.Context, pool *Pool) (*Pool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("CreatePool", pool.Identifier)
+
+	if _, ok := f.Pools[pool.Identifier]; ok {
+		return nil, fakeError(ErrorKindConflict, "pool %s already exists", pool.Identifier)
+	}
+	created := deepCopy(pool).(*Pool)
+	if err := f.validatePool(created); err != nil {
+		return nil, err
+	}
+	created.ID = f.nextID()
+	created.PoolCreated = false
 	if f.Pools == nil {
 		f.Pools = make(map[string]Pool)
 	}
-	f.Pools[pool.Identifier] = *pool
-	return pool, nil
+	f.Pools[created.Identifier] = *created
+	return deepCopy(created).(*Pool), nil
 }
 
 func (f *FakeNetworkAPI) UpdatePool(ctx context.Context, pool *Pool) (*Pool, error) {
-	return nil, errors.New("UpdatePool is not implemented yet")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("UpdatePool", pool.ID)
+	f.PoolUpdates = append(f.PoolUpdates, *pool)
+
+	existing, ok := f.poolByID(pool.ID)
+	if !ok {
+		return nil, fakeError(ErrorKindNotFound, "pool %d does not exist", pool.ID)
+	}
+	if existing.Identifier != pool.Identifier {
+		return nil, fakeError(ErrorKindValidation, "pool %d identifier cannot be changed", pool.ID)
+	}
+	updated := deepCopy(pool).(*Pool)
+	if err := f.validatePool(updated); err != nil {
+		return nil, err
+	}
+	updated.PoolCreated = existing.PoolCreated
+	f.Pools[updated.Identifier] = *updated
+	return deepCopy(updated).(*Pool), nil
 }
 
+// CreateVIPIPv4 allocates the next free address of 10.0.0.0/16 for the VIP.
 func (f *FakeNetworkAPI) CreateVIPIPv4(ctx context.Context, name string, vipEnvironmentID int) (*IP, error) {
-	return nil, errors.New("CreateVIPIPv4 is not implemented yet")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("CreateVIPIPv4", name)
+
+	for n := 1; n < 1<<16; n++ {
+		ip := IPFromNetIP(net.IPv4(10, 0, byte(n>>8), byte(n)))
+		if _, ok := f.ipByAddress(ip.ToNetIP()); ok {
+			continue
+		}
+		ip.ID = f.nextID()
+		ip.Description = name
+		return f.storeIP(ip), nil
+	}
+	return nil, fakeError(ErrorKindConflict, "no vip ipv4 available")
+}
+
+func (f *FakeNetworkAPI) ipByAddress(netIP net.IP) (IP, bool) {
+	for _, ip := range f.IPsByID {
+		if ip.ToNetIP().Equal(netIP) {
+			return ip, true
+		}
+	}
+	return IP{}, false
+}
+
+func (f *FakeNetworkAPI) storeIP(ip IP) *IP {
+	if f.IPsByID == nil {
+		f.IPsByID = make(map[int]IP)
+	}
+	f.IPsByID[ip.ID] = ip
+	return deepCopy(&ip).(*IP)
 }
 
 func (f *FakeNetworkAPI) CreateIP(ctx context.Context, ip *IP) (*IP, error) {
-	return nil, errors.New("CreateIP is not implemented yet")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("CreateIP", ip.ToNetIP())
+
+	if _, ok := f.ipByAddress(ip.ToNetIP()); ok {
+		return nil, fakeError(ErrorKindConflict, "ipv4 %s already exists", ip.ToNetIP())
+	}
+	for _, equip := range ip.Equipments {
+		if _, ok := f.equipmentByID(equip.ID); !ok {
+			return nil, fakeError(ErrorKindValidation, "equipment %d of ipv4 %s does not exist", equip.ID, ip.ToNetIP())
+		}
+	}
+	created := *deepCopy(ip).(*IP)
+	created.ID = f.nextID()
+	return f.storeIP(created), nil
 }
 
 func (f *FakeNetworkAPI) GetIPByName(ctx context.Context, name string) (*IP, error) {
-	return nil, errors.New("GetIPByID is not implemented yet")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ip := range f.IPsByID {
+		if ip.Description == name {
+			return deepCopy(&ip).(*IP), nil
+		}
+	}
+	return nil, errNotFound
 }
 
-func (f *FakeNetworkAPI) GetIPByNetIP(ctx context.Context, ip net.IP) (*IP, error) {
+func (f *FakeNetworkAPI) GetIPByNetIP(ctx context.Context, netIP net.IP) (*IP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
 
-	return &IP{
-		ID:   1,
-		Oct1: ip.To4()[0],
-		Oct2: ip.To4()[1],
-		Oct3: ip.To4()[2],
-		Oct4: ip.To4()[3],
-	}, nil
+	ip, ok := f.ipByAddress(netIP)
+	if !ok {
+		return nil, errNotFound
+	}
+	return deepCopy(&ip).(*IP), nil
 }
 
 func (f *FakeNetworkAPI) GetIPByID(ctx context.Context, id int) (*IP, error) {
-	if f.IPsByID == nil {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ip, ok := f.IPsByID[id]
+	if !ok {
 		return nil, errNotFound
 	}
+	return deepCopy(&ip).(*IP), nil
+}
 
-	ip, ok := f.IPsByID[id]
+// CreateVIPIPv6 allocates the next free address of fd00::/112 for the VIP.
+func (f *FakeNetworkAPI) CreateVIPIPv6(ctx context.Context, name string, vipEnvironmentID int) (*IPv6, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("CreateVIPIPv6", name)
+
+	for n := 1; n < 1<<16; n++ {
+		netIP := net.ParseIP(fmt.Sprintf("fd00::%x", n))
+		if _, ok := f.ipv6ByAddress(netIP); ok {
+			continue
+		}
+		ip := IPv6FromNetIP(netIP)
+		ip.ID = f.nextID()
+		ip.Description = name
+		return f.storeIPv6(ip), nil
+	}
+	return nil, fakeError(ErrorKindConflict, "no vip ipv6 available")
+}
+
+func (f *FakeNetworkAPI) ipv6ByAddress(netIP net.IP) (IPv6, bool) {
+	for _, ip := range f.IPv6sByID {
+		if ip.ToNetIP().Equal(netIP) {
+			return ip, true
+		}
+	}
+	return IPv6{}, false
+}
+
+func (f *FakeNetworkAPI) storeIPv6(ip IPv6) *IPv6 {
+	if f.IPv6sByID == nil {
+		f.IPv6sByID = make(map[int]IPv6)
+	}
+	f.IPv6sByID[ip.ID] = ip
+	return deepCopy(&ip).(*IPv6)
+}
+
+func (f *FakeNetworkAPI) CreateIPv6(ctx context.Context, ip *IPv6) (*IPv6, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("CreateIPv6", ip.ToNetIP())
+
+	if _, ok := f.ipv6ByAddress(ip.ToNetIP()); ok {
+		return nil, fakeError(ErrorKindConflict, "ipv6 %s already exists", ip.ToNetIP())
+	}
+	for _, equip := range ip.Equipments {
+		if _, ok := f.equipmentByID(equip.ID); !ok {
+			return nil, fakeError(ErrorKindValidation, "equipment %d of ipv6 %s does not exist", equip.ID, ip.ToNetIP())
+		}
+	}
+	created := *deepCopy(ip).(*IPv6)
+	created.ID = f.nextID()
+	return f.storeIPv6(created), nil
+}
+
+func (f *FakeNetworkAPI) GetIPv6ByName(ctx context.Context, name string) (*IPv6, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, ip := range f.IPv6sByID {
+		if ip.Description == name {
+			return deepCopy(&ip).(*IPv6), nil
+		}
+	}
+	return nil, errNotFound
+}
+
+func (f *FakeNetworkAPI) GetIPv6ByNetIP(ctx context.Context, netIP net.IP) (*IPv6, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ip, ok := f.ipv6ByAddress(netIP)
+	if !ok {
+		return nil, errNotFound
+	}
+	return deepCopy(&ip).(*IPv6), nil
+}
+
+func (f *FakeNetworkAPI) GetIPv6ByID(ctx context.Context, id int) (*IPv6, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ip, ok := f.IPv6sByID[id]
 	if !ok {
 		return nil, errNotFound
 	}
-	return &ip, nil
+	return deepCopy(&ip).(*IPv6), nil
 }
 
 func (f *FakeNetworkAPI) CreateEquipment(ctx context.Context, equip *Equipment) (*Equipment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("CreateEquipment", equip.Name)
+
+	if _, ok := f.Equipments[equip.Name]; ok {
+		return nil, fakeError(ErrorKindConflict, "equipment %s already exists", equip.Name)
+	}
+	created := deepCopy(equip).(*Equipment)
+	created.ID = f.nextID()
 	if f.Equipments == nil {
 		f.Equipments = make(map[string]Equipment)
 	}
-	f.Equipments[equip.Name] = *equip
-	return equip, nil
+	f.Equipments[created.Name] = *created
+	return deepCopy(created).(*Equipment), nil
 }
 
 func (f *FakeNetworkAPI) GetEquipment(ctx context.Context, name string) (*Equipment, error) {
-	if f.Equipments == nil {
-		return nil, errNotFound
-	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
 	equipment, ok := f.Equipments[name]
 	if !ok {
 		return nil, errNotFound
 	}
-	return &equipment, nil
+	return deepCopy(&equipment).(*Equipment), nil
+}
+
+func (f *FakeNetworkAPI) DeleteEquipment(ctx context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("DeleteEquipment", id)
+	f.EquipmentDeletes = append(f.EquipmentDeletes, id)
+
+	equipment, ok := f.equipmentByID(id)
+	if !ok {
+		return fakeError(ErrorKindNotFound, "equipment %d does not exist", id)
+	}
+	usedBy := func(equipments []IDOnly) bool {
+		for _, equip := range equipments {
+			if equip.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+	for _, ip := range f.IPsByID {
+		if usedBy(ip.Equipments) {
+			return fakeError(ErrorKindConflict, "equipment %d is used by ipv4 %d", id, ip.ID)
+		}
+	}
+	for _, ip := range f.IPv6sByID {
+		if usedBy(ip.Equipments) {
+			return fakeError(ErrorKindConflict, "equipment %d is used by ipv6 %d", id, ip.ID)
+		}
+	}
+	delete(f.Equipments, equipment.Name)
+	return nil
+}
+
+// ipUsedBy returns the VIP or pool using the IP, if any.
+func (f *FakeNetworkAPI) ipUsedBy(vipIP func(VIP) *IntOrID, memberIP func(PoolMember) *PoolMemberIP, id int) string {
+	for _, vip := range f.VIPs {
+		if ip := vipIP(vip); ip != nil && ip.ID == id {
+			return "vip " + vip.Name
+		}
+	}
+	for _, pool := range f.Pools {
+		for _, m := range pool.Members {
+			if ip := memberIP(m); ip != nil && ip.ID == id {
+				return "pool " + pool.Identifier
+			}
+		}
+	}
+	return ""
 }
 
 func (f *FakeNetworkAPI) DeleteIP(ctx context.Context, id int) error {
-	return errors.New("DeleteIP is not implemented yet")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("DeleteIP", id)
+	f.IPDeletes = append(f.IPDeletes, id)
+
+	if _, ok := f.IPsByID[id]; !ok {
+		return fakeError(ErrorKindNotFound, "ipv4 %d does not exist", id)
+	}
+	usedBy := f.ipUsedBy(func(v VIP) *IntOrID { return v.IPv4 }, func(m PoolMember) *PoolMemberIP { return m.IP }, id)
+	if usedBy != "" {
+		return fakeError(ErrorKindConflict, "ipv4 %d is used by %s", id, usedBy)
+	}
+	delete(f.IPsByID, id)
+	return nil
+}
+
+func (f *FakeNetworkAPI) DeleteIPv6(ctx context.Context, id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("DeleteIPv6", id)
+	f.IPv6Deletes = append(f.IPv6Deletes, id)
+
+	if _, ok := f.IPv6sByID[id]; !ok {
+		return fakeError(ErrorKindNotFound, "ipv6 %d does not exist", id)
+	}
+	usedBy := f.ipUsedBy(func(v VIP) *IntOrID { return v.IPv6 }, func(m PoolMember) *PoolMemberIP { return m.IPv6 }, id)
+	if usedBy != "" {
+		return fakeError(ErrorKindConflict, "ipv6 %d is used by %s", id, usedBy)
+	}
+	delete(f.IPv6sByID, id)
+	return nil
 }
 
 func (f *FakeNetworkAPI) DeletePool(ctx context.Context, id int) error {
-	return errors.New("DeletePool is not implemented yet")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("DeletePool", id)
+	f.PoolDeletes = append(f.PoolDeletes, id)
+
+	pool, ok := f.poolByID(id)
+	if !ok {
+		return fakeError(ErrorKindNotFound, "pool %d does not exist", id)
+	}
+	for _, vip := range f.VIPs {
+		for _, port := range vip.Ports {
+			for _, vipPool := range port.Pools {
+				if vipPool.ServerPool.ID == id {
+					return fakeError(ErrorKindConflict, "pool %d is used by vip %s", id, vip.Name)
+				}
+			}
+		}
+	}
+	delete(f.Pools, pool.Identifier)
+	return nil
 }
 
 func (f *FakeNetworkAPI) DeleteVIP(ctx context.Context, vip *VIP) error {
-	return errors.New("DeleteVIP is not implemented yet")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.call("DeleteVIP", vip.ID)
+	f.VIPDeletes = append(f.VIPDeletes, vip.ID)
+
+	existing, ok := f.vipByID(vip.ID)
+	if !ok {
+		return fakeError(ErrorKindNotFound, "vip %d does not exist", vip.ID)
+	}
+	delete(f.VIPs, existing.Name)
+	return nil
+}
+
+func (f *FakeNetworkAPI) ListVIPs(ctx context.Context, prefix string) ([]VIP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result []VIP
+	for _, vip := range f.VIPs {
+		if strings.HasPrefix(vip.Name, prefix) {
+			result = append(result, *deepCopy(&vip).(*VIP))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (f *FakeNetworkAPI) ListPools(ctx context.Context, prefix string) ([]Pool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result []Pool
+	for _, pool := range f.Pools {
+		if strings.HasPrefix(pool.Identifier, prefix) {
+			result = append(result, *deepCopy(&pool).(*Pool))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (f *FakeNetworkAPI) ListIPs(ctx context.Context, prefix string) ([]IP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result []IP
+	for _, ip := range f.IPsByID {
+		if strings.HasPrefix(ip.Description, prefix) {
+			result = append(result, *deepCopy(&ip).(*IP))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (f *FakeNetworkAPI) ListIPv6s(ctx context.Context, prefix string) ([]IPv6, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result []IPv6
+	for _, ip := range f.IPv6sByID {
+		if strings.HasPrefix(ip.Description, prefix) {
+			result = append(result, *deepCopy(&ip).(*IPv6))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
+}
+
+func (f *FakeNetworkAPI) ListEquipments(ctx context.Context, prefix string) ([]Equipment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result []Equipment
+	for _, equipment := range f.Equipments {
+		if strings.HasPrefix(equipment.Name, prefix) {
+			result = append(result, *deepCopy(&equipment).(*Equipment))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result, nil
 }
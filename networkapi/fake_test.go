@@ -0,0 +1,74 @@
+package networkapi
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeNetworkAPIIntegrity(t *testing.T) {
+	f := &FakeNetworkAPI{}
+	ctx := context.TODO()
+
+	equip, err := f.CreateEquipment(ctx, &Equipment{Name: "target"})
+	require.NoError(t, err)
+	_, err = f.CreateEquipment(ctx, &Equipment{Name: "target"})
+	assert.True(t, IsConflict(err))
+
+	ip := IPFromNetIP(net.ParseIP("192.168.0.1"))
+	ip.Equipments = []IDOnly{{ID: equip.ID}}
+	targetIP, err := f.CreateIP(ctx, &ip)
+	require.NoError(t, err)
+	_, err = f.CreateIP(ctx, &ip)
+	assert.True(t, IsConflict(err))
+
+	_, err = f.CreatePool(ctx, &Pool{Identifier: "pool", Members: []PoolMember{{IP: &PoolMemberIP{ID: 999}}}})
+	assert.True(t, IsValidation(err))
+	pool, err := f.CreatePool(ctx, &Pool{Identifier: "pool", Members: []PoolMember{{IP: &PoolMemberIP{ID: targetIP.ID}}}})
+	require.NoError(t, err)
+	assert.NotZero(t, pool.Members[0].ID)
+
+	vipIP, err := f.CreateVIPIPv4(ctx, "vip", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", vipIP.ToNetIP().String())
+	vip, err := f.CreateVIP(ctx, &VIP{
+		Name:  "vip",
+		IPv4:  &IntOrID{ID: vipIP.ID},
+		Ports: []VIPPort{{Port: 80, Pools: []VIPPool{{ServerPool: IntOrID{ID: pool.ID}}}}},
+	})
+	require.NoError(t, err)
+	assert.False(t, vip.Created)
+
+	require.NoError(t, f.DeployVIP(ctx, vip.ID))
+	pool, err = f.GetPoolByID(ctx, pool.ID)
+	require.NoError(t, err)
+	assert.True(t, pool.PoolCreated)
+
+	assert.True(t, IsConflict(f.DeletePool(ctx, pool.ID)))
+	assert.True(t, IsConflict(f.DeleteIP(ctx, vipIP.ID)))
+	assert.True(t, IsConflict(f.DeleteIP(ctx, targetIP.ID)))
+	assert.True(t, IsConflict(f.DeleteEquipment(ctx, equip.ID)))
+
+	require.NoError(t, f.DeleteVIP(ctx, vip))
+	require.NoError(t, f.DeletePool(ctx, pool.ID))
+	require.NoError(t, f.DeleteIP(ctx, vipIP.ID))
+	require.NoError(t, f.DeleteIP(ctx, targetIP.ID))
+	require.NoError(t, f.DeleteEquipment(ctx, equip.ID))
+	assert.True(t, IsNotFound(f.DeleteVIP(ctx, vip)))
+
+	assert.Equal(t, []string{
+		"CreateEquipment target",
+		"CreateEquipment target",
+		"CreateIP 192.168.0.1",
+		"CreateIP 192.168.0.1",
+		"CreatePool pool",
+		"CreatePool pool",
+		"CreateVIPIPv4 vip",
+		"CreateVIP vip",
+		fmt.Sprintf("DeployVIP %d", vip.ID),
+	}, f.Calls[:9])
+}
@@ -0,0 +1,55 @@
+package networkapi
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// limiter caps the rate of NetworkAPI requests with a token bucket and the
+// number of requests in flight.
+type limiter struct {
+	rate     *rate.Limiter
+	inFlight chan struct{}
+}
+
+func newLimiter(rateLimit float64, burst, maxInFlight int) *limiter {
+	l := &limiter{}
+	if rateLimit > 0 {
+		if burst < 1 {
+			burst = 1
+		}
+		l.rate = rate.NewLimiter(rate.Limit(rateLimit), burst)
+	}
+	if maxInFlight > 0 {
+		l.inFlight = make(chan struct{}, maxInFlight)
+	}
+	return l
+}
+
+// acquire waits for a request slot, the returned function must be called
+// once the request is done.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if l.inFlight != nil {
+		select {
+		case l.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if l.inFlight != nil {
+			<-l.inFlight
+		}
+	}
+	if l.rate != nil {
+		if err := l.rate.Wait(ctx); err != nil {
+			release()
+			return nil, err
+		}
+	}
+	return release, nil
+}
@@ -0,0 +1,82 @@
+package networkapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+const searchPageSize = 100
+
+// listByPrefix returns every object from the v3 endpoint whose field starts
+// with prefix, fetching the search results page by page.
+func (n *networkAPI) listByPrefix(ctx context.Context, u, resultField, searchField, prefix string, v interface{}) error {
+	var items []json.RawMessage
+	for start := 0; ; start += searchPageSize {
+		search, err := json.Marshal(map[string]interface{}{
+			"start_record": start,
+			"end_record":   start + searchPageSize,
+			"extends_search": []interface{}{
+				map[string]string{searchField + "__startswith": prefix},
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		data, err := n.doRequest(ctx, http.MethodGet, u, url.Values{
+			"search": []string{string(search)},
+			"kind":   []string{"details"},
+		}, nil)
+		if err != nil {
+			return err
+		}
+
+		var page []json.RawMessage
+		err = unmarshalField(data, resultField, &page)
+		if err != nil {
+			return err
+		}
+		items = append(items, page...)
+		if len(page) < searchPageSize {
+			break
+		}
+	}
+
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (n *networkAPI) ListVIPs(ctx context.Context, prefix string) ([]VIP, error) {
+	var result []VIP
+	err := n.listByPrefix(ctx, "/api/v3/vip-request/", "vips", "name", prefix, &result)
+	return result, err
+}
+
+func (n *networkAPI) ListPools(ctx context.Context, prefix string) ([]Pool, error) {
+	var result []Pool
+	err := n.listByPrefix(ctx, "/api/v3/pool/", "server_pools", "identifier", prefix, &result)
+	return result, err
+}
+
+func (n *networkAPI) ListIPs(ctx context.Context, prefix string) ([]IP, error) {
+	var result []IP
+	err := n.listByPrefix(ctx, "/api/v3/ipv4/", "ips", "descricao", prefix, &result)
+	return result, err
+}
+
+func (n *networkAPI) ListIPv6s(ctx context.Context, prefix string) ([]IPv6, error) {
+	var result []IPv6
+	err := n.listByPrefix(ctx, "/api/v3/ipv6/", "ips", "description", prefix, &result)
+	return result, err
+}
+
+func (n *networkAPI) ListEquipments(ctx context.Context, prefix string) ([]Equipment, error) {
+	var result []Equipment
+	err := n.listByPrefix(ctx, "/api/v3/equipment/", "equipments", "name", prefix, &result)
+	return result, err
+}
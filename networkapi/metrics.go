@@ -0,0 +1,29 @@
+package networkapi
+
+import (
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "kube_napi_ingress_networkapi_request_duration_seconds",
+	Help:    "Duration of the NetworkAPI requests by method, endpoint and response status.",
+	Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+}, []string{"method", "endpoint", "status"})
+
+func init() {
+	metrics.Registry.MustRegister(requestDuration)
+}
+
+var idSegment = regexp.MustCompile(`/[0-9;]+(/|$)`)
+
+// metricsEndpoint replaces the object IDs in the request path, so requests
+// to the same endpoint share their metrics.
+func metricsEndpoint(u string) string {
+	for idSegment.MatchString(u) {
+		u = idSegment.ReplaceAllString(u, "/:id$1")
+	}
+	return u
+}
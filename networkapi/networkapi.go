@@ -9,18 +9,20 @@ import (
 	"net/http"
 	"net/url"
 	"reflect"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
-var errNotFound = errors.New("not found")
-
 type NetworkAPI interface {
 	GetVIP(ctx context.Context, name string) (*VIP, error)
 	CreateVIP(ctx context.Context, vip *VIP) (*VIP, error)
 	UpdateVIP(ctx context.Context, vip *VIP) (*VIP, error)
 	DeployVIP(ctx context.Context, vipID int) error
 	GetPool(ctx context.Context, name string) (*Pool, error)
+	GetPoolByID(ctx context.Context, id int) (*Pool, error)
+	GetPoolsByMemberIP(ctx context.Context, ipID int) ([]Pool, error)
+	GetPoolsByMemberIPv6(ctx context.Context, ipID int) ([]Pool, error)
 	CreatePool(ctx context.Context, pool *Pool) (*Pool, error)
 	UpdatePool(ctx context.Context, pool *Pool) (*Pool, error)
 	CreateVIPIPv4(ctx context.Context, name string, vipEnvironmentID int) (*IP, error)
@@ -28,11 +30,23 @@ type NetworkAPI interface {
 	GetIPByID(ctx context.Context, id int) (*IP, error)
 	GetIPByName(ctx context.Context, name string) (*IP, error)
 	GetIPByNetIP(ctx context.Context, ip net.IP) (*IP, error)
+	CreateVIPIPv6(ctx context.Context, name string, vipEnvironmentID int) (*IPv6, error)
+	CreateIPv6(ctx context.Context, ip *IPv6) (*IPv6, error)
+	GetIPv6ByID(ctx context.Context, id int) (*IPv6, error)
+	GetIPv6ByName(ctx context.Context, name string) (*IPv6, error)
+	GetIPv6ByNetIP(ctx context.Context, ip net.IP) (*IPv6, error)
 	CreateEquipment(ctx context.Context, equip *Equipment) (*Equipment, error)
 	GetEquipment(ctx context.Context, name string) (*Equipment, error)
+	DeleteEquipment(ctx context.Context, id int) error
 	DeleteIP(ctx context.Context, id int) error
+	DeleteIPv6(ctx context.Context, id int) error
 	DeletePool(ctx context.Context, id int) error
 	DeleteVIP(ctx context.Context, vip *VIP) error
+	ListVIPs(ctx context.Context, prefix string) ([]VIP, error)
+	ListPools(ctx context.Context, prefix string) ([]Pool, error)
+	ListIPs(ctx context.Context, prefix string) ([]IP, error)
+	ListIPv6s(ctx context.Context, prefix string) ([]IPv6, error)
+	ListEquipments(ctx context.Context, prefix string) ([]Equipment, error)
 }
 
 type VIP struct {
@@ -70,6 +84,8 @@ type VIPPool struct {
 	ID         int     `json:"id,omitempty"`
 	ServerPool IntOrID `json:"server_pool,omitempty"`
 	L7Rule     IntOrID `json:"l7_rule"`
+	L7Value    string  `json:"l7_value,omitempty"`
+	Order      int     `json:"order,omitempty"`
 }
 
 type VIPPortOptions struct {
@@ -156,8 +172,23 @@ type IP struct {
 	Equipments    []IDOnly `json:"equipments,omitempty"`
 }
 
+type IPv6 struct {
+	ID            int      `json:"id,omitempty" xml:"id"`
+	Block1        string   `json:"block1,omitempty"`
+	Block2        string   `json:"block2,omitempty"`
+	Block3        string   `json:"block3,omitempty"`
+	Block4        string   `json:"block4,omitempty"`
+	Block5        string   `json:"block5,omitempty"`
+	Block6        string   `json:"block6,omitempty"`
+	Block7        string   `json:"block7,omitempty"`
+	Block8        string   `json:"block8,omitempty"`
+	NetworkIPv6ID int      `json:"networkipv6,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Equipments    []IDOnly `json:"equipments,omitempty"`
+}
+
 type IDOnly struct {
-	ID int `json:"id,omitempty"`
+	ID int `json:"id,omitempty" xml:"id"`
 }
 
 type Environment struct {
@@ -190,6 +221,31 @@ func (ip *IP) ToNetIP() net.IP {
 	return net.IPv4(ip.Oct1, ip.Oct2, ip.Oct3, ip.Oct4)
 }
 
+func IPv6FromNetIP(netIP net.IP) IPv6 {
+	netIP = netIP.To16()
+	var blocks [8]string
+	for i := range blocks {
+		blocks[i] = fmt.Sprintf("%04x", uint16(netIP[2*i])<<8|uint16(netIP[2*i+1]))
+	}
+	return IPv6{
+		Block1: blocks[0],
+		Block2: blocks[1],
+		Block3: blocks[2],
+		Block4: blocks[3],
+		Block5: blocks[4],
+		Block6: blocks[5],
+		Block7: blocks[6],
+		Block8: blocks[7],
+	}
+}
+
+func (ip *IPv6) ToNetIP() net.IP {
+	return net.ParseIP(strings.Join([]string{
+		ip.Block1, ip.Block2, ip.Block3, ip.Block4,
+		ip.Block5, ip.Block6, ip.Block7, ip.Block8,
+	}, ":"))
+}
+
 type networkAPI struct {
 	baseClient
 }
@@ -310,7 +366,7 @@ func (n *networkAPI) GetPool(ctx context.Context, name string) (*Pool, error) {
 	return parsePool(data)
 }
 
-func (n *networkAPI) getPoolByID(ctx context.Context, id int) (*Pool, error) {
+func (n *networkAPI) GetPoolByID(ctx context.Context, id int) (*Pool, error) {
 	u := fmt.Sprintf("/api/v3/pool/%d/", id)
 	data, err := n.doRequest(ctx, http.MethodGet, u, url.Values{
 		"kind": []string{"details"},
@@ -321,12 +377,45 @@ func (n *networkAPI) getPoolByID(ctx context.Context, id int) (*Pool, error) {
 	return parsePool(data)
 }
 
+func (n *networkAPI) getPoolsByMember(ctx context.Context, field string, ipID int) ([]Pool, error) {
+	search, err := json.Marshal(map[string]interface{}{
+		"extends_search": []interface{}{
+			map[string]int{field: ipID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := n.doRequest(ctx, http.MethodGet, "/api/v3/pool/", url.Values{
+		"search": []string{string(search)},
+		"kind":   []string{"details"},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var result []Pool
+	err = unmarshalField(data, "server_pools", &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (n *networkAPI) GetPoolsByMemberIP(ctx context.Context, ipID int) ([]Pool, error) {
+	return n.getPoolsByMember(ctx, "serverpoolmember__ip", ipID)
+}
+
+func (n *networkAPI) GetPoolsByMemberIPv6(ctx context.Context, ipID int) ([]Pool, error) {
+	return n.getPoolsByMember(ctx, "serverpoolmember__ipv6", ipID)
+}
+
 func (n *networkAPI) CreatePool(ctx context.Context, pool *Pool) (*Pool, error) {
 	id, err := n.doPost(ctx, "/api/v3/pool/", "server_pools", pool)
 	if err != nil {
 		return nil, err
 	}
-	return n.getPoolByID(ctx, id)
+	return n.GetPoolByID(ctx, id)
 }
 
 func (n *networkAPI) UpdatePool(ctx context.Context, pool *Pool) (*Pool, error) {
@@ -346,29 +435,44 @@ func (n *networkAPI) UpdatePool(ctx context.Context, pool *Pool) (*Pool, error)
 	if err != nil {
 		return nil, err
 	}
-	return n.getPoolByID(ctx, pool.ID)
+	return n.GetPoolByID(ctx, pool.ID)
 }
 
-func (n *networkAPI) CreateVIPIPv4(ctx context.Context, name string, vipEnvironmentID int) (*IP, error) {
+func (n *networkAPI) createVIPIP(ctx context.Context, u, name string, vipEnvironmentID int) (int, error) {
 	const vipIPRequestTpl = `<?xml version="1.0" encoding="UTF-8"?><networkapi versao="1.0"><ip_map><id_evip>%d</id_evip><name>%s</name></ip_map></networkapi>`
 	body := fmt.Sprintf(vipIPRequestTpl, vipEnvironmentID, name)
-	u := fmt.Sprintf("/ip/availableip4/vip/%d/", vipEnvironmentID)
 	data, err := n.doRequest(ctx, http.MethodPost, u, nil, []byte(body))
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	var xmlData struct {
 		XMLName xml.Name `xml:"networkapi"`
-		IP      IP       `xml:"ip"`
+		IP      IDOnly   `xml:"ip"`
 	}
 	err = xml.Unmarshal(data, &xmlData)
 	if err != nil {
-		return nil, errors.Wrapf(err, "unable to unmarshal %q", string(data))
+		return 0, errors.Wrapf(err, "unable to unmarshal %q", string(data))
 	}
 	if xmlData.IP.ID != 0 {
-		return n.GetIPByID(ctx, xmlData.IP.ID)
+		return xmlData.IP.ID, nil
+	}
+	return 0, errors.Errorf("unable to parse ID from %q", string(data))
+}
+
+func (n *networkAPI) CreateVIPIPv4(ctx context.Context, name string, vipEnvironmentID int) (*IP, error) {
+	id, err := n.createVIPIP(ctx, fmt.Sprintf("/ip/availableip4/vip/%d/", vipEnvironmentID), name, vipEnvironmentID)
+	if err != nil {
+		return nil, err
 	}
-	return nil, errors.Errorf("unable to parse ID from %q", string(data))
+	return n.GetIPByID(ctx, id)
+}
+
+func (n *networkAPI) CreateVIPIPv6(ctx context.Context, name string, vipEnvironmentID int) (*IPv6, error) {
+	id, err := n.createVIPIP(ctx, fmt.Sprintf("/ip/availableip6/vip/%d/", vipEnvironmentID), name, vipEnvironmentID)
+	if err != nil {
+		return nil, err
+	}
+	return n.GetIPv6ByID(ctx, id)
 }
 
 func (n *networkAPI) CreateEquipment(ctx context.Context, equip *Equipment) (*Equipment, error) {
@@ -475,6 +579,80 @@ func (n *networkAPI) GetIPByName(ctx context.Context, name string) (*IP, error)
 	return parseIP(data)
 }
 
+func (n *networkAPI) CreateIPv6(ctx context.Context, ip *IPv6) (*IPv6, error) {
+	id, err := n.doPost(ctx, "/api/v3/ipv6/", "ips", ip)
+	if err != nil {
+		return nil, err
+	}
+	return n.GetIPv6ByID(ctx, id)
+}
+
+func parseIPv6(data []byte) (*IPv6, error) {
+	var result []IPv6
+	err := unmarshalField(data, "ips", &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
+		return nil, errNotFound
+	}
+	if len(result) > 1 {
+		return nil, errors.Errorf("multiple IPs found when one was expected: %#v", result)
+	}
+	return &result[0], nil
+}
+
+func (n *networkAPI) GetIPv6ByID(ctx context.Context, id int) (*IPv6, error) {
+	u := fmt.Sprintf("/api/v3/ipv6/%d/", id)
+	data, err := n.doRequest(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseIPv6(data)
+}
+
+func (n *networkAPI) GetIPv6ByNetIP(ctx context.Context, ip net.IP) (*IPv6, error) {
+	if ip.To4() != nil || ip.To16() == nil {
+		return nil, errors.New("ipv6 required")
+	}
+
+	search, err := json.Marshal(map[string]interface{}{
+		"extends_search": []interface{}{
+			IPv6FromNetIP(ip),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := n.doRequest(ctx, http.MethodGet, "/api/v3/ipv6/", url.Values{
+		"search": []string{string(search)},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseIPv6(data)
+}
+
+func (n *networkAPI) GetIPv6ByName(ctx context.Context, name string) (*IPv6, error) {
+	search, err := json.Marshal(map[string]interface{}{
+		"extends_search": []interface{}{
+			map[string]string{"description": name},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := n.doRequest(ctx, http.MethodGet, "/api/v3/ipv6/", url.Values{
+		"search": []string{string(search)},
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseIPv6(data)
+}
+
 func (n *networkAPI) delete(ctx context.Context, urlName string, id int) error {
 	u := fmt.Sprintf("/api/v3/%s/%d/", urlName, id)
 	_, err := n.doRequest(ctx, http.MethodDelete, u, nil, nil)
@@ -485,6 +663,14 @@ func (n *networkAPI) DeleteIP(ctx context.Context, id int) error {
 	return n.delete(ctx, "ipv4", id)
 }
 
+func (n *networkAPI) DeleteIPv6(ctx context.Context, id int) error {
+	return n.delete(ctx, "ipv6", id)
+}
+
+func (n *networkAPI) DeleteEquipment(ctx context.Context, id int) error {
+	return n.delete(ctx, "equipment", id)
+}
+
 func (n *networkAPI) DeletePool(ctx context.Context, id int) error {
 	return n.delete(ctx, "pool", id)
 }
@@ -500,16 +686,38 @@ func (n *networkAPI) DeleteVIP(ctx context.Context, vip *VIP) error {
 	return n.delete(ctx, "vip-request", vip.ID)
 }
 
-func Client(baseURL, user, password string) NetworkAPI {
+// ClientOptions configures the NetworkAPI client.
+type ClientOptions struct {
+	BaseURL   string
+	Auth      AuthOptions
+	Transport TransportOptions
+	// RateLimit is the maximum number of requests per second, with bursts
+	// of up to RateBurst requests. Requests are not rate limited when zero.
+	RateLimit float64
+	RateBurst int
+	// MaxInFlight is the maximum number of concurrent requests, unlimited
+	// when zero.
+	MaxInFlight int
+}
+
+// Client returns a NetworkAPI client. The client is safe for concurrent use
+// and should be shared, so the request limits apply to every caller.
+func Client(opts ClientOptions) (NetworkAPI, error) {
+	httpClient, err := newHTTPClient(opts.Transport)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := newAuthenticator(opts.Auth, httpClient)
+	if err != nil {
+		return nil, err
+	}
 	return &networkAPI{
 		baseClient: baseClient{
-			baseURL:  baseURL,
-			username: user,
-			password: password,
+			baseURL:    opts.BaseURL,
+			auth:       auth,
+			httpClient: httpClient,
+			backoff:    defaultBackoff,
+			limiter:    newLimiter(opts.RateLimit, opts.RateBurst, opts.MaxInFlight),
 		},
-	}
-}
-
-func IsNotFound(err error) bool {
-	return err != nil && err == errNotFound
+	}, nil
 }
@@ -0,0 +1,699 @@
+package networkapi
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// defaultSearchPageSize is the number of objects returned by NetworkAPI
+// searches without end_record.
+const defaultSearchPageSize = 25
+
+// Simulator is an http.Handler serving the NetworkAPI endpoints used by the
+// client, backed by a FakeNetworkAPI. Like NetworkAPI, it answers searches
+// with the v3 JSON payloads, expands the IDs of related objects with
+// kind=details, allocates VIP IPs through the XML endpoints and refuses to
+// update deployed objects outside of the deploy endpoints. It can be served
+// with httptest in tests or as a standalone server for local runs of the
+// controller.
+type Simulator struct {
+	// State holds the NetworkAPI objects, it may be filled to set up
+	// existing objects.
+	State *FakeNetworkAPI
+
+	mu       sync.Mutex
+	failures []*Failure
+	requests []string
+}
+
+var _ http.Handler = &Simulator{}
+
+// Failure makes the Simulator answer the matching requests with an error.
+type Failure struct {
+	// Method of the requests failed, any method when empty.
+	Method string
+	// Path is the prefix of the paths of the requests failed.
+	Path string
+	// StatusCode is the status of the response, the connection is closed
+	// without a response when zero.
+	StatusCode int
+	// Body of the response, a NetworkAPI error detail by default.
+	Body string
+	// Times is the number of requests failed, every request when zero.
+	Times int
+}
+
+func NewSimulator() *Simulator {
+	return &Simulator{State: &FakeNetworkAPI{}}
+}
+
+// Fail injects a failure for the next requests matching it.
+func (s *Simulator) Fail(f Failure) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, &f)
+}
+
+// Requests returns the requests served, as the method followed by the path.
+func (s *Simulator) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Simulator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	if f := s.failure(r); f != nil {
+		if f.StatusCode == 0 {
+			closeConnection(w)
+			return
+		}
+		body := f.Body
+		if body == "" {
+			body = fmt.Sprintf(`{"detail": "injected failure %d"}`, f.StatusCode)
+		}
+		w.WriteHeader(f.StatusCode)
+		w.Write([]byte(body))
+		return
+	}
+
+	status, rsp, err := s.handle(r)
+	if err != nil {
+		writeSimulatorError(w, err)
+		return
+	}
+	if data, ok := rsp.([]byte); ok {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(status)
+		w.Write(data)
+		return
+	}
+	data, err := json.Marshal(rsp)
+	if err != nil {
+		writeSimulatorError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func (s *Simulator) failure(r *http.Request) *Failure {
+	for i, f := range s.failures {
+		if (f.Method != "" && f.Method != r.Method) || !strings.HasPrefix(r.URL.Path, f.Path) {
+			continue
+		}
+		if f.Times > 0 {
+			f.Times--
+			if f.Times == 0 {
+				s.failures = append(s.failures[:i], s.failures[i+1:]...)
+			}
+		}
+		return f
+	}
+	return nil
+}
+
+func closeConnection(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	conn, _, err := hj.Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func writeSimulatorError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	detail := err.Error()
+	if apiErr, ok := err.(*Error); ok {
+		status = apiErr.StatusCode
+		if status == 0 {
+			status = map[ErrorKind]int{
+				ErrorKindNotFound:   http.StatusNotFound,
+				ErrorKindConflict:   http.StatusConflict,
+				ErrorKindValidation: http.StatusBadRequest,
+			}[apiErr.Kind]
+		}
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		if apiErr.Body != "" {
+			detail = apiErr.Body
+		}
+	}
+	data, _ := json.Marshal(map[string]string{"detail": detail})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// handle serves the request, returning the response status and either the
+// object to be encoded as JSON or the raw XML data.
+func (s *Simulator) handle(r *http.Request) (int, interface{}, error) {
+	ctx := r.Context()
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	route := strings.Join(segments, "/")
+	var id int
+	if last := segments[len(segments)-1]; len(segments) > 1 {
+		if id, err = strconv.Atoi(last); err == nil {
+			route = strings.Join(segments[:len(segments)-1], "/") + "/:id"
+		}
+	}
+	details := r.URL.Query().Get("kind") == "details"
+
+	switch r.Method + " " + route {
+	case "GET api/v3/vip-request":
+		vips, _ := s.State.ListVIPs(ctx, "")
+		return s.search(r, "vips", vips, details, nil)
+	case "GET api/v3/vip-request/:id":
+		vip, err := s.State.getVIPByID(id)
+		if err != nil {
+			return 0, nil, err
+		}
+		return s.objects("vips", []VIP{*vip}, details)
+	case "POST api/v3/vip-request":
+		var vips []VIP
+		if err = unmarshalField(body, "vips", &vips); err != nil {
+			return 0, nil, simulatorValidationError(err)
+		}
+		return s.create(len(vips), func(i int) (int, error) {
+			created, err := s.State.CreateVIP(ctx, &vips[i])
+			if err != nil {
+				return 0, err
+			}
+			return created.ID, nil
+		})
+	case "PUT api/v3/vip-request/:id", "PUT api/v3/vip-request/deploy/:id":
+		var vips []VIP
+		if err = unmarshalField(body, "vips", &vips); err != nil {
+			return 0, nil, simulatorValidationError(err)
+		}
+		return s.create(len(vips), func(i int) (int, error) {
+			existing, err := s.State.getVIPByID(vips[i].ID)
+			if err != nil {
+				return 0, err
+			}
+			if err = checkDeployEndpoint("vip", vips[i].ID, existing.Created, segments); err != nil {
+				return 0, err
+			}
+			updated, err := s.State.UpdateVIP(ctx, &vips[i])
+			if err != nil {
+				return 0, err
+			}
+			return updated.ID, nil
+		})
+	case "POST api/v3/vip-request/deploy/:id":
+		if err = s.State.DeployVIP(ctx, id); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, []IDOnly{{ID: id}}, nil
+	case "DELETE api/v3/vip-request/deploy/:id":
+		if err = s.State.undeployVIP(id); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, []IDOnly{{ID: id}}, nil
+	case "DELETE api/v3/vip-request/:id":
+		vip, err := s.State.getVIPByID(id)
+		if err != nil {
+			return 0, nil, err
+		}
+		if vip.Created {
+			return 0, nil, fakeError(ErrorKindValidation, "vip %d is deployed, it must be undeployed first", id)
+		}
+		if err = s.State.DeleteVIP(ctx, vip); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, []IDOnly{}, nil
+
+	case "GET api/v3/pool":
+		pools, _ := s.State.ListPools(ctx, "")
+		return s.search(r, "server_pools", pools, details, nil)
+	case "GET api/v3/pool/:id":
+		pool, err := s.State.GetPoolByID(ctx, id)
+		if err != nil {
+			return 0, nil, err
+		}
+		return s.objects("server_pools", []Pool{*pool}, details)
+	case "POST api/v3/pool":
+		var pools []Pool
+		if err = unmarshalField(body, "server_pools", &pools); err != nil {
+			return 0, nil, simulatorValidationError(err)
+		}
+		return s.create(len(pools), func(i int) (int, error) {
+			created, err := s.State.CreatePool(ctx, &pools[i])
+			if err != nil {
+				return 0, err
+			}
+			return created.ID, nil
+		})
+	case "PUT api/v3/pool/:id", "PUT api/v3/pool/deploy/:id":
+		var pools []Pool
+		if err = unmarshalField(body, "server_pools", &pools); err != nil {
+			return 0, nil, simulatorValidationError(err)
+		}
+		return s.create(len(pools), func(i int) (int, error) {
+			existing, err := s.State.GetPoolByID(ctx, pools[i].ID)
+			if err != nil {
+				return 0, err
+			}
+			if err = checkDeployEndpoint("pool", pools[i].ID, existing.PoolCreated, segments); err != nil {
+				return 0, err
+			}
+			updated, err := s.State.UpdatePool(ctx, &pools[i])
+			if err != nil {
+				return 0, err
+			}
+			return updated.ID, nil
+		})
+	case "DELETE api/v3/pool/:id":
+		if err = s.State.DeletePool(ctx, id); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, []IDOnly{}, nil
+
+	case "GET api/v3/ipv4":
+		ips, _ := s.State.ListIPs(ctx, "")
+		return s.search(r, "ips", ips, false, ipv4SearchFields)
+	case "GET api/v3/ipv4/:id":
+		ip, err := s.State.GetIPByID(ctx, id)
+		if err != nil {
+			return 0, nil, err
+		}
+		return s.objects("ips", []IP{*ip}, false)
+	case "POST api/v3/ipv4":
+		var ips []IP
+		if err = unmarshalField(body, "ips", &ips); err != nil {
+			return 0, nil, simulatorValidationError(err)
+		}
+		return s.create(len(ips), func(i int) (int, error) {
+			created, err := s.State.CreateIP(ctx, &ips[i])
+			if err != nil {
+				return 0, err
+			}
+			return created.ID, nil
+		})
+	case "DELETE api/v3/ipv4/:id":
+		if err = s.State.DeleteIP(ctx, id); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, []IDOnly{}, nil
+
+	case "GET api/v3/ipv6":
+		ips, _ := s.State.ListIPv6s(ctx, "")
+		return s.search(r, "ips", ips, false, nil)
+	case "GET api/v3/ipv6/:id":
+		ip, err := s.State.GetIPv6ByID(ctx, id)
+		if err != nil {
+			return 0, nil, err
+		}
+		return s.objects("ips", []IPv6{*ip}, false)
+	case "POST api/v3/ipv6":
+		var ips []IPv6
+		if err = unmarshalField(body, "ips", &ips); err != nil {
+			return 0, nil, simulatorValidationError(err)
+		}
+		return s.create(len(ips), func(i int) (int, error) {
+			created, err := s.State.CreateIPv6(ctx, &ips[i])
+			if err != nil {
+				return 0, err
+			}
+			return created.ID, nil
+		})
+	case "DELETE api/v3/ipv6/:id":
+		if err = s.State.DeleteIPv6(ctx, id); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, []IDOnly{}, nil
+
+	case "GET api/v3/equipment":
+		equipments, _ := s.State.ListEquipments(ctx, "")
+		return s.search(r, "equipments", equipments, false, nil)
+	case "GET api/v4/equipment":
+		equipments, _ := s.State.ListEquipments(ctx, "")
+		if name := r.URL.Query().Get("name"); name != "" {
+			var found []Equipment
+			for _, equip := range equipments {
+				if equip.Name == name {
+					found = append(found, equip)
+				}
+			}
+			return s.objects("equipments", found, false)
+		}
+		return s.search(r, "equipments", equipments, false, nil)
+	case "POST api/v3/equipment":
+		var equipments []Equipment
+		if err = unmarshalField(body, "equipments", &equipments); err != nil {
+			return 0, nil, simulatorValidationError(err)
+		}
+		return s.create(len(equipments), func(i int) (int, error) {
+			created, err := s.State.CreateEquipment(ctx, &equipments[i])
+			if err != nil {
+				return 0, err
+			}
+			return created.ID, nil
+		})
+	case "DELETE api/v3/equipment/:id":
+		if err = s.State.DeleteEquipment(ctx, id); err != nil {
+			return 0, nil, err
+		}
+		return http.StatusOK, []IDOnly{}, nil
+
+	case "POST ip/availableip4/vip/:id", "POST ip/availableip6/vip/:id":
+		return s.createVIPIP(ctx, segments[1], id, body)
+	}
+	return 0, nil, fakeError(ErrorKindNotFound, "%s %s not found", r.Method, r.URL.Path)
+}
+
+func simulatorValidationError(err error) error {
+	return fakeError(ErrorKindValidation, "invalid request body: %v", err)
+}
+
+// checkDeployEndpoint refuses updates of deployed objects outside of the
+// deploy endpoint, and of objects not deployed through it.
+func checkDeployEndpoint(kind string, id int, deployed bool, segments []string) error {
+	viaDeploy := segments[len(segments)-2] == "deploy"
+	if deployed && !viaDeploy {
+		return fakeError(ErrorKindValidation, "%s %d is deployed, it must be updated with the deploy endpoint", kind, id)
+	}
+	if !deployed && viaDeploy {
+		return fakeError(ErrorKindValidation, "%s %d is not deployed", kind, id)
+	}
+	return nil
+}
+
+// create runs fn for each of the n objects of the request, returning their
+// IDs like NetworkAPI.
+func (s *Simulator) create(n int, fn func(i int) (int, error)) (int, interface{}, error) {
+	if n == 0 {
+		return 0, nil, fakeError(ErrorKindValidation, "no objects in request")
+	}
+	ids := make([]IDOnly, n)
+	for i := range ids {
+		id, err := fn(i)
+		if err != nil {
+			return 0, nil, err
+		}
+		ids[i].ID = id
+	}
+	return http.StatusCreated, ids, nil
+}
+
+func (s *Simulator) createVIPIP(ctx context.Context, family string, vipEnvironmentID int, body []byte) (int, interface{}, error) {
+	var req struct {
+		XMLName xml.Name `xml:"networkapi"`
+		IPMap   struct {
+			EnvironmentVIP int    `xml:"id_evip"`
+			Name           string `xml:"name"`
+		} `xml:"ip_map"`
+	}
+	if err := xml.Unmarshal(body, &req); err != nil {
+		return 0, nil, simulatorValidationError(err)
+	}
+
+	var ip interface{}
+	if family == "availableip6" {
+		created, err := s.State.CreateVIPIPv6(ctx, req.IPMap.Name, vipEnvironmentID)
+		if err != nil {
+			return 0, nil, err
+		}
+		ip = struct {
+			ID          int    `xml:"id"`
+			Block1      string `xml:"block1"`
+			Block2      string `xml:"block2"`
+			Block3      string `xml:"block3"`
+			Block4      string `xml:"block4"`
+			Block5      string `xml:"block5"`
+			Block6      string `xml:"block6"`
+			Block7      string `xml:"block7"`
+			Block8      string `xml:"block8"`
+			Description string `xml:"descricao"`
+		}{
+			created.ID, created.Block1, created.Block2, created.Block3, created.Block4,
+			created.Block5, created.Block6, created.Block7, created.Block8, created.Description,
+		}
+	} else {
+		created, err := s.State.CreateVIPIPv4(ctx, req.IPMap.Name, vipEnvironmentID)
+		if err != nil {
+			return 0, nil, err
+		}
+		ip = struct {
+			ID          int    `xml:"id"`
+			Oct1        byte   `xml:"oct1"`
+			Oct2        byte   `xml:"oct2"`
+			Oct3        byte   `xml:"oct3"`
+			Oct4        byte   `xml:"oct4"`
+			Description string `xml:"descricao"`
+		}{created.ID, created.Oct1, created.Oct2, created.Oct3, created.Oct4, created.Description}
+	}
+	data, err := xml.Marshal(struct {
+		XMLName xml.Name    `xml:"networkapi"`
+		Version string      `xml:"versao,attr"`
+		IP      interface{} `xml:"ip"`
+	}{Version: "1.0", IP: ip})
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, append([]byte(xml.Header), data...), nil
+}
+
+// search returns the objects matching the search query parameter, with the
+// paging of NetworkAPI. searchFields maps the search field names of the
+// endpoint that differ from the JSON field names.
+func (s *Simulator) search(r *http.Request, field string, objects interface{}, details bool, searchFields map[string]string) (int, interface{}, error) {
+	var search struct {
+		StartRecord   int                      `json:"start_record"`
+		EndRecord     *int                     `json:"end_record"`
+		ExtendsSearch []map[string]interface{} `json:"extends_search"`
+	}
+	if raw := r.URL.Query().Get("search"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &search); err != nil {
+			return 0, nil, fakeError(ErrorKindValidation, "invalid search %q: %v", raw, err)
+		}
+	}
+	end := search.StartRecord + defaultSearchPageSize
+	if search.EndRecord != nil {
+		end = *search.EndRecord
+	}
+
+	items, err := simulatorItems(objects)
+	if err != nil {
+		return 0, nil, err
+	}
+	var found []map[string]interface{}
+	for _, item := range items {
+		if matchesSearch(searchView(item, searchFields), search.ExtendsSearch) {
+			found = append(found, item)
+		}
+	}
+	total := len(found)
+	if search.StartRecord > len(found) {
+		search.StartRecord = len(found)
+	}
+	if end > len(found) {
+		end = len(found)
+	}
+	if end < search.StartRecord {
+		end = search.StartRecord
+	}
+	found = found[search.StartRecord:end]
+	if details {
+		for _, item := range found {
+			expandIDs(item)
+		}
+	}
+	return http.StatusOK, map[string]interface{}{
+		field:   nonNilItems(found),
+		"total": total,
+	}, nil
+}
+
+// objects returns the objects as the response of a GET by ID.
+func (s *Simulator) objects(field string, objects interface{}, details bool) (int, interface{}, error) {
+	items, err := simulatorItems(objects)
+	if err != nil {
+		return 0, nil, err
+	}
+	if details {
+		for _, item := range items {
+			expandIDs(item)
+		}
+	}
+	return http.StatusOK, map[string]interface{}{field: nonNilItems(items)}, nil
+}
+
+func nonNilItems(items []map[string]interface{}) []map[string]interface{} {
+	if items == nil {
+		return []map[string]interface{}{}
+	}
+	return items
+}
+
+// simulatorItems converts the objects to their JSON representation.
+func simulatorItems(objects interface{}) ([]map[string]interface{}, error) {
+	data, err := json.Marshal(objects)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]interface{}
+	err = json.Unmarshal(data, &items)
+	return items, errors.WithStack(err)
+}
+
+// ipv4SearchFields maps the database field names searched by NetworkAPI on
+// IPv4 addresses to the names of the JSON fields, which cannot be searched.
+var ipv4SearchFields = map[string]string{
+	"descricao": "description",
+}
+
+// searchView returns the item with its fields renamed to the search field
+// names, so only the names accepted by the endpoint match.
+func searchView(item map[string]interface{}, searchFields map[string]string) map[string]interface{} {
+	if len(searchFields) == 0 {
+		return item
+	}
+	view := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		view[k] = v
+	}
+	for searchField, jsonField := range searchFields {
+		view[searchField] = item[jsonField]
+		delete(view, jsonField)
+	}
+	return view
+}
+
+// matchesSearch returns whether the item matches any of the extends_search
+// entries, every field of an entry must match.
+func matchesSearch(item map[string]interface{}, extendsSearch []map[string]interface{}) bool {
+	if len(extendsSearch) == 0 {
+		return true
+	}
+	for _, entry := range extendsSearch {
+		matches := true
+		for field, value := range entry {
+			if !matchesField(item, field, value) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesField(item map[string]interface{}, field string, value interface{}) bool {
+	if strings.HasPrefix(field, "serverpoolmember__") {
+		key := strings.TrimPrefix(field, "serverpoolmember__")
+		members, _ := item["server_pool_members"].([]interface{})
+		for _, m := range members {
+			member, _ := m.(map[string]interface{})
+			if ip, ok := member[key].(map[string]interface{}); ok && fmt.Sprint(ip["id"]) == fmt.Sprint(value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	startsWith := strings.HasSuffix(field, "__startswith")
+	field = strings.TrimSuffix(field, "__startswith")
+	fieldValue, ok := item[field]
+	if !ok {
+		return false
+	}
+	if startsWith {
+		return strings.HasPrefix(fmt.Sprint(fieldValue), fmt.Sprint(value))
+	}
+	return fmt.Sprint(fieldValue) == fmt.Sprint(value)
+}
+
+// detailFields are the fields holding the ID of related objects, which
+// NetworkAPI expands to the objects with kind=details.
+var detailFields = map[string]bool{
+	"environmentvip": true,
+	"environment":    true,
+	"ipv4":           true,
+	"ipv6":           true,
+	"server_pool":    true,
+	"l7_rule":        true,
+	"cache_group":    true,
+	"traffic_return": true,
+	"persistence":    true,
+	"timeout":        true,
+	"l4_protocol":    true,
+	"l7_protocol":    true,
+}
+
+func expandIDs(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if id, ok := value.(float64); ok && detailFields[key] && id != 0 {
+				v[key] = map[string]interface{}{"id": id}
+				continue
+			}
+			expandIDs(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			expandIDs(value)
+		}
+	}
+}
+
+func (f *FakeNetworkAPI) getVIPByID(id int) (*VIP, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	vip, ok := f.vipByID(id)
+	if !ok {
+		return nil, fakeError(ErrorKindNotFound, "vip %d does not exist", id)
+	}
+	return deepCopy(&vip).(*VIP), nil
+}
+
+// undeployVIP removes the VIP and its pools from the load balancer.
+func (f *FakeNetworkAPI) undeployVIP(id int) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	vip, ok := f.vipByID(id)
+	if !ok {
+		return fakeError(ErrorKindNotFound, "vip %d does not exist", id)
+	}
+	if !vip.Created {
+		return fakeError(ErrorKindValidation, "vip %d is not deployed", id)
+	}
+	vip.Created = false
+	f.VIPs[vip.Name] = vip
+	for _, port := range vip.Ports {
+		for _, vipPool := range port.Pools {
+			if pool, ok := f.poolByID(vipPool.ServerPool.ID); ok {
+				pool.PoolCreated = false
+				f.Pools[pool.Identifier] = pool
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package networkapi
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func simulatorClient(t *testing.T) (*Simulator, *networkAPI) {
+	sim := NewSimulator()
+	srv := httptest.NewServer(sim)
+	t.Cleanup(srv.Close)
+	return sim, &networkAPI{baseClient: *testClient(srv.URL)}
+}
+
+func TestSimulatorLifecycle(t *testing.T) {
+	ctx := context.TODO()
+	_, cli := simulatorClient(t)
+
+	equip, err := cli.CreateEquipment(ctx, &Equipment{Name: "kube-napi-ingress_c_192.168.0.1", EquipmentType: 10})
+	require.NoError(t, err)
+	assert.NotZero(t, equip.ID)
+
+	target, err := cli.CreateIP(ctx, &IP{Oct1: 192, Oct2: 168, Oct3: 0, Oct4: 1, Description: "target", Equipments: []IDOnly{{ID: equip.ID}}})
+	require.NoError(t, err)
+	found, err := cli.GetIPByNetIP(ctx, net.ParseIP("192.168.0.1"))
+	require.NoError(t, err)
+	assert.Equal(t, target, found)
+	found, err = cli.GetIPByName(ctx, "target")
+	require.NoError(t, err)
+	assert.Equal(t, target.ID, found.ID)
+	_, err = cli.GetIPByNetIP(ctx, net.ParseIP("192.168.0.2"))
+	assert.True(t, IsNotFound(err))
+
+	pool, err := cli.CreatePool(ctx, &Pool{
+		Identifier:  "vip_http",
+		DefaultPort: 8080,
+		Environment: IntOrID{ID: 3},
+		LBMethod:    "round-robin",
+		Members: []PoolMember{
+			{IP: &PoolMemberIP{ID: target.ID, IPFormated: "192.168.0.1"}, PortReal: 8080, Weight: 1, Priority: 1},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, IntOrID{ID: 3}, pool.Environment, "environment is expanded with kind=details")
+	require.Len(t, pool.Members, 1)
+	assert.NotZero(t, pool.Members[0].ID)
+
+	pools, err := cli.GetPoolsByMemberIP(ctx, target.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []Pool{*pool}, pools)
+
+	vipIP, err := cli.CreateVIPIPv4(ctx, "vip", 12)
+	require.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", vipIP.ToNetIP().String())
+	assert.Equal(t, "vip", vipIP.Description)
+
+	vip, err := cli.CreateVIP(ctx, &VIP{
+		Name:           "vip",
+		EnvironmentVIP: IntOrID{ID: 12},
+		IPv4:           &IntOrID{ID: vipIP.ID},
+		Ports: []VIPPort{{
+			Port:  80,
+			Pools: []VIPPool{{ServerPool: IntOrID{ID: pool.ID}, L7Rule: IntOrID{ID: 1}}},
+		}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, IntOrID{ID: vipIP.ID}, *vip.IPv4)
+	assert.Equal(t, pool.ID, vip.Ports[0].Pools[0].ServerPool.ID)
+	assert.False(t, vip.Created)
+
+	_, err = cli.CreateVIP(ctx, &VIP{Name: "vip", IPv4: &IntOrID{ID: vipIP.ID}})
+	assert.True(t, IsConflict(err))
+
+	require.NoError(t, cli.DeployVIP(ctx, vip.ID))
+	vip, err = cli.GetVIP(ctx, "vip")
+	require.NoError(t, err)
+	assert.True(t, vip.Created)
+
+	vip.Options.Timeout = IntOrID{ID: 5}
+	vip, err = cli.UpdateVIP(ctx, vip)
+	require.NoError(t, err)
+	assert.Equal(t, 5, vip.Options.Timeout.ID)
+	assert.True(t, vip.Created)
+
+	pool, err = cli.GetPool(ctx, "vip_http")
+	require.NoError(t, err)
+	assert.True(t, pool.PoolCreated)
+	pool.Members[0].Weight = 2
+	pool, err = cli.UpdatePool(ctx, pool)
+	require.NoError(t, err)
+	assert.Equal(t, 2, pool.Members[0].Weight)
+
+	assert.True(t, IsConflict(cli.DeletePool(ctx, pool.ID)), "pool is used by the vip")
+	assert.True(t, IsConflict(cli.DeleteIP(ctx, target.ID)), "ip is used by the pool")
+
+	require.NoError(t, cli.DeleteVIP(ctx, vip))
+	require.NoError(t, cli.DeletePool(ctx, pool.ID))
+	require.NoError(t, cli.DeleteIP(ctx, vipIP.ID))
+	require.NoError(t, cli.DeleteIP(ctx, target.ID))
+	require.NoError(t, cli.DeleteEquipment(ctx, equip.ID))
+
+	_, err = cli.GetVIP(ctx, "vip")
+	assert.True(t, IsNotFound(err))
+	_, err = cli.GetPoolByID(ctx, pool.ID)
+	assert.True(t, IsNotFound(err))
+	_, err = cli.GetEquipment(ctx, equip.Name)
+	assert.True(t, IsNotFound(err))
+}
+
+func TestSimulatorIPv6(t *testing.T) {
+	ctx := context.TODO()
+	_, cli := simulatorClient(t)
+
+	vipIP, err := cli.CreateVIPIPv6(ctx, "vip", 12)
+	require.NoError(t, err)
+	assert.Equal(t, "fd00::1", vipIP.ToNetIP().String())
+
+	ip := IPv6FromNetIP(net.ParseIP("2001:db8::1"))
+	target, err := cli.CreateIPv6(ctx, &ip)
+	require.NoError(t, err)
+	found, err := cli.GetIPv6ByNetIP(ctx, net.ParseIP("2001:db8::1"))
+	require.NoError(t, err)
+	assert.Equal(t, target.ID, found.ID)
+	found, err = cli.GetIPv6ByName(ctx, "vip")
+	require.NoError(t, err)
+	assert.Equal(t, vipIP.ID, found.ID)
+}
+
+func TestSimulatorList(t *testing.T) {
+	ctx := context.TODO()
+	sim, cli := simulatorClient(t)
+	sim.State.Pools = map[string]Pool{}
+	for i := 1; i <= 2*searchPageSize+1; i++ {
+		name := "kube-napi-ingress_c_" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		sim.State.Pools[name] = Pool{ID: i, Identifier: name}
+	}
+	sim.State.Pools["other"] = Pool{ID: 1000, Identifier: "other"}
+
+	pools, err := cli.ListPools(ctx, "kube-napi-ingress_c_")
+	require.NoError(t, err)
+	assert.Len(t, pools, 2*searchPageSize+1)
+	assert.Len(t, sim.Requests(), 3)
+}
+
+func TestSimulatorSearchFields(t *testing.T) {
+	ctx := context.TODO()
+	_, cli := simulatorClient(t)
+
+	vipIPv4, err := cli.CreateVIPIPv4(ctx, "kube-napi-ingress_c_vip", 12)
+	require.NoError(t, err)
+	vipIPv6, err := cli.CreateVIPIPv6(ctx, "kube-napi-ingress_c_vip", 12)
+	require.NoError(t, err)
+
+	ips, err := cli.ListIPs(ctx, "kube-napi-ingress_c_")
+	require.NoError(t, err)
+	require.Len(t, ips, 1)
+	assert.Equal(t, vipIPv4.ID, ips[0].ID)
+	ipv6s, err := cli.ListIPv6s(ctx, "kube-napi-ingress_c_")
+	require.NoError(t, err)
+	require.Len(t, ipv6s, 1)
+	assert.Equal(t, vipIPv6.ID, ipv6s[0].ID)
+
+	var found []IP
+	err = cli.listByPrefix(ctx, "/api/v3/ipv4/", "ips", "description", "kube-napi-ingress_c_", &found)
+	require.NoError(t, err)
+	assert.Empty(t, found, "IPv4 addresses are searched by descricao")
+	var foundIPv6 []IPv6
+	err = cli.listByPrefix(ctx, "/api/v3/ipv6/", "ips", "descricao", "kube-napi-ingress_c_", &foundIPv6)
+	require.NoError(t, err)
+	assert.Empty(t, foundIPv6, "IPv6 addresses are searched by description")
+}
+
+func TestSimulatorFailures(t *testing.T) {
+	ctx := context.TODO()
+	sim, cli := simulatorClient(t)
+	sim.State.Equipments = map[string]Equipment{"eq": {ID: 1, Name: "eq"}}
+
+	sim.Fail(Failure{Method: http.MethodGet, Path: "/api/v4/equipment/", StatusCode: http.StatusServiceUnavailable, Times: 2})
+	equip, err := cli.GetEquipment(ctx, "eq")
+	require.NoError(t, err)
+	assert.Equal(t, 1, equip.ID)
+	assert.Len(t, sim.Requests(), 3, "temporary errors are retried")
+
+	sim.Fail(Failure{Path: "/api/v3/equipment/", Times: 1})
+	_, err = cli.CreateEquipment(ctx, &Equipment{Name: "eq2"})
+	assert.True(t, IsNetworkError(err))
+	_, err = cli.CreateEquipment(ctx, &Equipment{Name: "eq2"})
+	require.NoError(t, err)
+
+	sim.Fail(Failure{Method: http.MethodDelete, Path: "/api/v3/", StatusCode: http.StatusBadRequest, Body: `{"detail": "locked"}`})
+	err = cli.DeleteEquipment(ctx, 1)
+	require.True(t, IsValidation(err))
+	assert.Equal(t, `{"detail": "locked"}`, err.(*Error).Body)
+	err = cli.DeleteEquipment(ctx, 1)
+	assert.True(t, IsValidation(err), "failures without times are permanent")
+}
+
+func TestSimulatorDeployedUpdates(t *testing.T) {
+	ctx := context.TODO()
+	sim, cli := simulatorClient(t)
+	sim.State.Pools = map[string]Pool{"pool": {ID: 1, Identifier: "pool", PoolCreated: true}}
+
+	_, err := cli.UpdatePool(ctx, &Pool{ID: 1, Identifier: "pool"})
+	require.True(t, IsValidation(err))
+	assert.Contains(t, err.(*Error).Body, "pool 1 is deployed")
+
+	_, err = cli.UpdatePool(ctx, &Pool{ID: 1, Identifier: "pool", PoolCreated: true, LBMethod: "least-conn"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GET /api/v3/pool/1/"}, sim.Requests()[len(sim.Requests())-1:])
+	assert.Equal(t, "PUT /api/v3/pool/deploy/1/", sim.Requests()[1])
+}
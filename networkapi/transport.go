@@ -0,0 +1,97 @@
+package networkapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TransportOptions configures the HTTP client used to reach NetworkAPI.
+type TransportOptions struct {
+	// Timeout limits the time of each request, including reading the
+	// response body. Requests have no timeout when zero.
+	Timeout time.Duration
+	// CAFile is a PEM bundle of the CAs trusted besides the system ones.
+	CAFile string
+	// CertFile and KeyFile are the PEM client certificate and key for
+	// mutual TLS.
+	CertFile           string
+	KeyFile            string
+	InsecureSkipVerify bool
+	// ProxyURL is the HTTP proxy for the requests, the proxy is read from
+	// the HTTP_PROXY, HTTPS_PROXY and NO_PROXY env vars when empty.
+	ProxyURL string
+	// RecordFile is the cassette file where every request and its response
+	// are appended as a JSON line, with credentials redacted. The file is
+	// truncated when the client is created.
+	RecordFile string
+	// ReplayFile is a cassette file recorded with RecordFile, whose
+	// responses are served instead of sending the requests.
+	ReplayFile string
+}
+
+func newHTTPClient(opts TransportOptions) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+	}
+	if opts.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		data, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read CA file")
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errors.Errorf("no certificates found in CA file %s", opts.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load client certificate")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	if opts.ProxyURL != "" {
+		proxyURL, err := url.Parse(opts.ProxyURL)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid proxy URL")
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	var roundTripper http.RoundTripper = transport
+	switch {
+	case opts.RecordFile != "" && opts.ReplayFile != "":
+		return nil, errors.New("record and replay files cannot be set together")
+	case opts.RecordFile != "":
+		record, err := newRecordTransport(transport, opts.RecordFile)
+		if err != nil {
+			return nil, err
+		}
+		roundTripper = record
+	case opts.ReplayFile != "":
+		replay, err := newReplayTransport(opts.ReplayFile)
+		if err != nil {
+			return nil, err
+		}
+		roundTripper = replay
+	}
+
+	return &http.Client{
+		Transport: roundTripper,
+		Timeout:   opts.Timeout,
+	}, nil
+}
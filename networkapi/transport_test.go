@@ -0,0 +1,64 @@
+package networkapi
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewHTTPClientTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+	require.NoError(t, err)
+
+	request := func(opts TransportOptions) error {
+		httpClient, err := newHTTPClient(opts)
+		require.NoError(t, err)
+		c := testClient(srv.URL)
+		c.httpClient = httpClient
+		_, err = c.doRequest(context.TODO(), http.MethodPost, "/api/v3/vip-request/", nil, nil)
+		return err
+	}
+
+	err = request(TransportOptions{})
+	assert.True(t, IsNetworkError(err), "server certificate not trusted")
+	assert.NoError(t, request(TransportOptions{CAFile: caFile}))
+	assert.NoError(t, request(TransportOptions{InsecureSkipVerify: true}))
+
+	_, err = newHTTPClient(TransportOptions{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	assert.Error(t, err)
+}
+
+func TestNewHTTPClientTimeoutAndProxy(t *testing.T) {
+	var proxied string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		if r.URL.Path == "/slow/" {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}))
+	defer proxy.Close()
+
+	httpClient, err := newHTTPClient(TransportOptions{Timeout: 20 * time.Millisecond, ProxyURL: proxy.URL})
+	require.NoError(t, err)
+	c := testClient("http://networkapi.example.com")
+	c.httpClient = httpClient
+
+	_, err = c.doRequest(context.TODO(), http.MethodPost, "/api/v3/vip-request/", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://networkapi.example.com/api/v3/vip-request/", proxied)
+
+	_, err = c.doRequest(context.TODO(), http.MethodPost, "/slow/", nil, nil)
+	assert.True(t, IsNetworkError(err))
+}